@@ -1,26 +1,39 @@
 package main
 
 import (
-	"fmt"
+	"bufio"
+	"context"
+	"errors"
+	"log/slog"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 
 	"github.com/theleywin/Backend-Talent-Nest/src/cluster"
 	"github.com/theleywin/Backend-Talent-Nest/src/lib"
+	"github.com/theleywin/Backend-Talent-Nest/src/logging"
+	"github.com/theleywin/Backend-Talent-Nest/src/middleware"
+	"github.com/theleywin/Backend-Talent-Nest/src/migrations"
 	"github.com/theleywin/Backend-Talent-Nest/src/routes"
+	"github.com/theleywin/Backend-Talent-Nest/src/tracing"
+	"gorm.io/gorm"
 )
 
 var ClusterState *cluster.ClusterState
 
 func main() {
+	// Logs estructurados (LOG_LEVEL, LOG_FORMAT)
+	logging.Setup()
 
 	app := fiber.New()
 
 	app.Use(cors.New(cors.Config{
-		AllowOrigins: "http://frontend-service:5173, http://localhost:5173",
-		AllowHeaders: "Origin, Content-Type, Accept, Authorization",
+		AllowOrigins:  "http://frontend-service:5173, http://localhost:5173",
+		AllowHeaders:  "Origin, Content-Type, Accept, Authorization, " + cluster.ReplicationPositionHeader + ", " + logging.RequestIDHeader,
+		ExposeHeaders: cluster.ReplicationPositionHeader + ", " + cluster.LeaderHeader + ", " + logging.RequestIDHeader,
 	}))
 
 	// Inicializar el sistema de cluster
@@ -31,69 +44,348 @@ func main() {
 
 	ClusterState = cluster.NewClusterState(serviceName)
 
-	// Connect to SQLite database
+	// Trazas de OpenTelemetry (OTEL_TRACES_EXPORTER); el nodo se identifica por su ID
+	shutdownTracing, err := tracing.Setup(context.Background(), ClusterState.GetCurrentNodeID())
+	if err != nil {
+		fatal("Failed to set up tracing", "error", err)
+	}
+
+	// ID de cada petición (X-Request-ID) para seguirla en los logs de todos los nodos
+	app.Use(middleware.RequestID)
+
+	// Un span por petición, continuando la traza del cliente o del nodo que la reenvía
+	app.Use(cluster.Tracing(ClusterState))
+
+	// Métricas de las peticiones HTTP por ruta (se exponen en /metrics)
+	app.Use(cluster.Metrics(ClusterState))
+
+	// Connect to the database (DB_DRIVER: sqlite, postgres or mysql)
 	lib.ConnectDB()
-	lib.AutoMigrate()
 
-	// Descubrimiento inicial de nodos
-	if err := ClusterState.DiscoverNodes(); err != nil {
-		fmt.Printf("Warning: Initial node discovery failed: %v\n", err)
-	}
+	// Con una base de datos externa todos los nodos ven los mismos datos: no se replican
+	ClusterState.SetSharedDatabase(lib.SharedDatabase())
 
-	// Elección inicial de líder
-	ClusterState.ElectLeader(lib.DB)
+	// Registrar los modelos replicados para decodificar las filas recibidas del líder
+	if err := ClusterState.RegisterModels(lib.DB(), lib.Models...); err != nil {
+		fatal("Failed to register replicated models", "error", err)
+	}
 
-	// Iniciar proceso de elección de líder cada 10 segundos (con acceso a la DB)
-	ClusterState.StartLeaderElection(lib.DB)
+	// Crear las tablas del log de replicación y de las migraciones aplicadas
+	if err := cluster.MigrateReplicationLog(lib.DB()); err != nil {
+		fatal("Failed to migrate replication log", "error", err)
+	}
 
-	// Registrar el hook de replicación en GORM
-	replicationHook := &cluster.ReplicationHook{
-		ClusterState: ClusterState,
+	// Migraciones versionadas del esquema: las aplica el líder al asumir el liderazgo y
+	// llegan a los seguidores por el log de replicación
+	migrationFiles, err := migrations.For(lib.DatabaseDriver())
+	if err != nil {
+		fatal("Invalid schema migrations", "error", err)
 	}
-	if err := lib.DB.Use(replicationHook); err != nil {
-		fmt.Printf("Error: Failed to register replication hook: %v\n", err)
+	schemaMigrations, err := cluster.LoadMigrations(migrationFiles)
+	if err != nil {
+		fatal("Invalid schema migrations", "error", err)
+	}
+	if err := ClusterState.SetMigrations(lib.DB(), schemaMigrations); err != nil {
+		fatal("Failed to read schema version", "error", err)
 	}
 
-	// Si el nodo es seguidor, solicitar sincronización completa del líder
-	if !ClusterState.IsLeader() && ClusterState.GetLeaderAddress() != "" {
-		fmt.Println("This node is a follower, requesting full sync from leader...")
-		if err := ClusterState.RequestFullSync(ClusterState.GetLeaderAddress()); err != nil {
-			fmt.Printf("Warning: Failed to sync from leader: %v\n", err)
-			fmt.Println("Node will start with local database")
-		}
+	// Descubrimiento inicial de nodos
+	if err := ClusterState.DiscoverNodes(); err != nil {
+		slog.Warn("Initial node discovery failed", "error", err)
 	}
 
-	// Si el nodo es líder, marcarlo como listo inmediatamente
-	if ClusterState.IsLeader() {
-		ClusterState.SetReady(true)
+	// Iniciar heartbeats y elección de líder por términos (con acceso a la DB).
+	// Un seguidor que no está listo se sincroniza al recibir el primer heartbeat del líder.
+	ClusterState.StartLeaderElection(lib.DB())
+
+	if !lib.SharedDatabase() {
+		// Registrar el hook de replicación en GORM
+		replicationHook := &cluster.ReplicationHook{
+			ClusterState: ClusterState,
+		}
+		if err := lib.DB().Use(replicationHook); err != nil {
+			slog.Error("Failed to register replication hook", "error", err)
+		}
+
+		// Tras instalar un snapshot del líder, reabrir la conexión y volver a registrar el
+		// hook. Mientras se reemplaza el archivo no se atienden peticiones.
+		ClusterState.DrainDatabase = lib.DrainDB
+		ClusterState.ReopenDatabase = func() (*gorm.DB, error) {
+			return lib.ReconnectDB(func(db *gorm.DB) error {
+				return db.Use(&cluster.ReplicationHook{ClusterState: ClusterState})
+			})
+		}
 	}
 
+	// Autenticar los mensajes entre nodos (CLUSTER_SECRET)
+	app.Use(cluster.ClusterAuth())
+
 	// Aplicar middleware de readiness check
 	app.Use(cluster.ReadinessCheck(ClusterState))
 
+	// Aplicar middleware de lectura de las propias escrituras en seguidores
+	app.Use(cluster.ReadYourWrites(ClusterState))
+
 	// Aplicar middleware de redirección al líder
 	app.Use(cluster.ReplicationMiddleware(ClusterState))
 
-	// Register routes
-	routes.UserRoutes(app)
-	routes.AuthRoutes(app)
-	routes.PostRoutes(app)
-	routes.NotificationRoutes(app)
-	routes.ConnectionRoutes(app)
+	// Cada petición del API que atiende este nodo usa una misma conexión a la base de
+	// datos hasta terminar; mientras un seguidor instala un snapshot del líder las
+	// peticiones nuevas reciben 503. Va después de ReplicationMiddleware: las peticiones
+	// reenviadas al líder no usan la base de datos local y no retrasan la instalación.
+	// Los endpoints del cluster que leen o escriben la base de datos toman la conexión en
+	// su ruta; los heartbeats, los votos y el gossip se atienden durante la instalación.
+	app.Use("/api", middleware.DatabaseLease)
+
+	// Register routes: cada ruta declara qué nodo la atiende (ReplicationMiddleware)
+	router := ClusterState.Router(app)
+	routes.UserRoutes(router)
+	routes.AuthRoutes(router)
+	routes.PostRoutes(router)
+	routes.NotificationRoutes(router)
+	routes.ConnectionRoutes(router)
+
+	// Liveness: el proceso está vivo y responde (no depende del estado del cluster)
+	router.Get("/healthz", cluster.RouteLocalOnly, func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{
+			"status":  "alive",
+			"node_id": ClusterState.GetCurrentNodeID(),
+		})
+	})
+
+	// Readiness: el nodo puede recibir tráfico (sincronizado, base de datos abierta y
+	// retraso de replicación bajo el límite); responde 503 si no
+	router.Get("/readyz", cluster.RouteLocalOnly, func(c *fiber.Ctx) error {
+		readiness := ClusterState.CheckReadiness()
+		if !readiness.Ready {
+			return c.Status(fiber.StatusServiceUnavailable).JSON(readiness)
+		}
+		return c.JSON(readiness)
+	})
+
+	// Métricas del nodo en el formato de Prometheus
+	router.Get("/metrics", cluster.RouteLocalOnly, ClusterState.MetricsHandler())
+
+	// Los endpoints del cluster los atiende el nodo que los recibe
+	clusterRoutes := router.Group("/cluster")
 
 	// Ruta para consultar estado del cluster
-	app.Get("/cluster/status", func(c *fiber.Ctx) error {
+	clusterRoutes.Get("/status", cluster.RouteLocalOnly, func(c *fiber.Ctx) error {
 		return c.JSON(ClusterState.GetClusterInfo())
 	})
 
-	// Ruta para recibir mensajes de replicación (solo seguidores)
-	app.Post("/cluster/replicate", func(c *fiber.Ctx) error {
-		if ClusterState.IsLeader() {
+	// Ruta para recibir solicitudes de voto de los candidatos
+	clusterRoutes.Post("/vote", cluster.RouteLocalOnly, func(c *fiber.Ctx) error {
+		var request cluster.VoteRequest
+		if err := c.BodyParser(&request); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid vote request",
+			})
+		}
+
+		return c.JSON(ClusterState.HandleVoteRequest(request))
+	})
+
+	// Ruta para recibir heartbeats del líder
+	clusterRoutes.Post("/heartbeat", cluster.RouteLocalOnly, func(c *fiber.Ctx) error {
+		var message cluster.HeartbeatMessage
+		if err := c.BodyParser(&message); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid heartbeat message",
+			})
+		}
+
+		return c.JSON(ClusterState.HandleHeartbeat(message))
+	})
+
+	// Ruta para recibir la cesión del liderazgo de un líder que se apaga
+	clusterRoutes.Post("/timeout-now", cluster.RouteLocalOnly, func(c *fiber.Ctx) error {
+		var request cluster.TimeoutNowRequest
+		if err := c.BodyParser(&request); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid timeout-now request",
+			})
+		}
+
+		return c.JSON(ClusterState.HandleTimeoutNow(request))
+	})
+
+	// Ruta para recibir el anuncio de salida de un nodo
+	clusterRoutes.Post("/leave", cluster.RouteLocalOnly, func(c *fiber.Ctx) error {
+		var notice cluster.LeaveNotice
+		if err := c.BodyParser(&notice); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid leave notice",
+			})
+		}
+
+		ClusterState.HandleLeave(notice)
+		return c.JSON(fiber.Map{"status": "ok"})
+	})
+
+	// Rutas de administración del cluster (requieren CLUSTER_ADMIN_TOKEN)
+	admin := clusterRoutes.Group("/admin", cluster.AdminAuth())
+
+	// Ceder el liderazgo al seguidor elegible más actualizado (o al nodo indicado)
+	transferLeadership := func(c *fiber.Ctx) error {
+		leaderID, err := ClusterState.TransferLeadership(c.Params("nodeId"))
+		if errors.Is(err, cluster.ErrNotLeader) {
+			leaderAddress := ClusterState.GetLeaderAddress()
+			if leaderAddress == "" {
+				return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+					"error": "No leader available",
+				})
+			}
+			return cluster.ForwardAdminRequest(c, ClusterState, leaderAddress)
+		}
+		if err != nil {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error":   "Leadership transfer failed",
+				"message": err.Error(),
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":    "transferred",
+			"leader_id": leaderID,
+		})
+	}
+	admin.Post("/step-down", cluster.RouteLocalOnly, transferLeadership)
+	admin.Post("/transfer/:nodeId", cluster.RouteLocalOnly, transferLeadership)
+
+	// Activar o desactivar el modo mantenimiento de un nodo (se reenvía al nodo indicado)
+	setMaintenance := func(enabled bool) fiber.Handler {
+		return func(c *fiber.Ctx) error {
+			nodeID := c.Params("nodeId")
+			if nodeID != ClusterState.GetCurrentNodeID() {
+				address, exists := ClusterState.NodeAddress(nodeID)
+				if !exists {
+					return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+						"error": "Unknown node",
+					})
+				}
+				return cluster.ForwardAdminRequest(c, ClusterState, address)
+			}
+
+			if err := ClusterState.SetMaintenance(enabled); err != nil {
+				return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+					"error":   "Could not change maintenance mode",
+					"message": err.Error(),
+				})
+			}
+
+			return c.JSON(fiber.Map{
+				"node_id":     nodeID,
+				"maintenance": enabled,
+			})
+		}
+	}
+	admin.Post("/nodes/:nodeId/maintenance", cluster.RouteLocalOnly, setMaintenance(true))
+	admin.Delete("/nodes/:nodeId/maintenance", cluster.RouteLocalOnly, setMaintenance(false))
+
+	// Quitar de la vista de este nodo a un miembro caído (el gossip nunca los elimina)
+	admin.Delete("/nodes/:nodeId", cluster.RouteLocalOnly, func(c *fiber.Ctx) error {
+		if err := ClusterState.RemoveMember(c.Params("nodeId")); err != nil {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error":   "Could not remove node",
+				"message": err.Error(),
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"node_id": c.Params("nodeId"),
+			"removed": true,
+		})
+	})
+
+	// Estado de las migraciones del esquema en este nodo
+	admin.Get("/migrations", cluster.RouteLocalOnly, func(c *fiber.Ctx) error {
+		statuses, err := ClusterState.Migrations()
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":   "Could not read migrations",
+				"message": err.Error(),
+			})
+		}
+
+		applied, known := ClusterState.SchemaVersions()
+		return c.JSON(fiber.Map{
+			"node_id":              ClusterState.GetCurrentNodeID(),
+			"schema_version":       applied,
+			"known_schema_version": known,
+			"migrations":           statuses,
+		})
+	})
+
+	// Revertir la última migración aplicada (la ejecuta el líder y se replica)
+	admin.Post("/migrations/rollback", cluster.RouteLocalOnly, func(c *fiber.Ctx) error {
+		change, err := ClusterState.RollbackMigration()
+		if errors.Is(err, cluster.ErrNotLeader) {
+			leaderAddress := ClusterState.GetLeaderAddress()
+			if leaderAddress == "" {
+				return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+					"error": "No leader available",
+				})
+			}
+			return cluster.ForwardAdminRequest(c, ClusterState, leaderAddress)
+		}
+		if err != nil {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error":   "Migration rollback failed",
+				"message": err.Error(),
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":  "reverted",
+			"version": change.Version,
+			"name":    change.Name,
+		})
+	})
+
+	// Ruta para recibir pings del gossip de membresía
+	clusterRoutes.Post("/gossip/ping", cluster.RouteLocalOnly, func(c *fiber.Ctx) error {
+		// Un nodo que ya anunció su salida no responde para no volver a parecer vivo
+		if ClusterState.HasLeftCluster() {
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+				"error": "Node is leaving the cluster",
+			})
+		}
+
+		var ping cluster.GossipPing
+		if err := c.BodyParser(&ping); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid gossip ping",
+			})
+		}
+
+		return c.JSON(ClusterState.HandleGossipPing(ping))
+	})
+
+	// Ruta para sondear un nodo en nombre de otro (sondeo indirecto)
+	clusterRoutes.Post("/gossip/ping-req", cluster.RouteLocalOnly, func(c *fiber.Ctx) error {
+		if ClusterState.HasLeftCluster() {
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+				"error": "Node is leaving the cluster",
+			})
+		}
+
+		var request cluster.GossipPingRequest
+		if err := c.BodyParser(&request); err != nil {
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error": "Leader node should not receive replication messages",
+				"error": "Invalid gossip ping request",
 			})
 		}
 
+		return c.JSON(ClusterState.HandleGossipPingRequest(request))
+	})
+
+	// Replicación, sincronización y verificación de los datos de cada nodo (no aplican
+	// si los nodos comparten la base de datos)
+	replicatedOnly := cluster.ReplicatedOnly(ClusterState)
+
+	// Ruta para recibir mensajes de replicación (solo seguidores)
+	clusterRoutes.Post("/replicate", cluster.RouteLocalOnly, replicatedOnly, middleware.DatabaseLease, func(c *fiber.Ctx) error {
 		var message cluster.ReplicationMessage
 		if err := c.BodyParser(&message); err != nil {
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -101,19 +393,80 @@ func main() {
 			})
 		}
 
-		if err := ClusterState.ApplyReplication(message, lib.DB); err != nil {
+		if err := ClusterState.ApplyReplication(message, lib.RequestDB(c)); err != nil {
+			// Mensaje de un líder de un término anterior: informar el término actual
+			if errors.Is(err, cluster.ErrStaleTerm) {
+				return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+					"error": err.Error(),
+					"term":  ClusterState.GetCurrentTerm(),
+				})
+			}
+			// Informar hasta dónde llega el log local para que el líder continúe desde ahí
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": err.Error(),
+				"error":      err.Error(),
+				"last_index": cluster.LastLogIndex(lib.RequestDB(c)),
 			})
 		}
 
 		return c.JSON(fiber.Map{
-			"status": "replicated",
+			"status":     "replicated",
+			"last_index": cluster.LastLogIndex(lib.RequestDB(c)),
+		})
+	})
+
+	// Ruta para recuperar entradas perdidas del log de replicación (solo líder)
+	clusterRoutes.Get("/replicate", cluster.RouteLocalOnly, replicatedOnly, func(c *fiber.Ctx) error {
+		if !ClusterState.IsLeader() {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Only leader can provide replication log entries",
+			})
+		}
+
+		from := c.QueryInt("from", 1)
+		if from < 1 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid log index",
+			})
+		}
+
+		// El envío continúa después de que el handler retorna: necesita su propio préstamo
+		// de la conexión para que no se cierre mientras lee el log
+		db, release, ok := lib.AcquireDB()
+		if !ok {
+			c.Set(fiber.HeaderRetryAfter, "1")
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+				"error": "Database unavailable",
+			})
+		}
+
+		// Un seguidor detrás del punto de compactación debe sincronizarse con un snapshot
+		if err := cluster.CheckLogFrom(db, uint64(from)); err != nil {
+			release()
+			if errors.Is(err, cluster.ErrLogCompacted) {
+				return c.Status(fiber.StatusGone).JSON(fiber.Map{
+					"error":   err.Error(),
+					"message": "Request a snapshot with /cluster/sync",
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		// Enviar las entradas en streaming (una por línea) sin cargar todo el log en memoria
+		c.Set(fiber.HeaderContentType, "application/x-ndjson")
+		return cluster.SendStreamWriter(c, func(w *bufio.Writer) error {
+			defer release()
+			if err := ClusterState.StreamLog(db, uint64(from), w); err != nil {
+				slog.Error("Error streaming replication log", "error", err)
+				return err
+			}
+			return nil
 		})
 	})
 
 	// Ruta para proporcionar sincronización completa (solo líder)
-	app.Post("/cluster/sync", func(c *fiber.Ctx) error {
+	clusterRoutes.Post("/sync", cluster.RouteLocalOnly, replicatedOnly, func(c *fiber.Ctx) error {
 		if !ClusterState.IsLeader() {
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 				"error": "Only leader can provide sync data",
@@ -127,9 +480,9 @@ func main() {
 			})
 		}
 
-		fmt.Printf("Received sync request from node %d\n", request.NodeID)
+		slog.Info("Received sync request", "node_id", request.NodeID, "last_index", request.LastIndex)
 
-		response, err := ClusterState.ProvideSyncData()
+		response, err := ClusterState.ProvideSyncData(request)
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"error": err.Error(),
@@ -139,6 +492,91 @@ func main() {
 		return c.JSON(response)
 	})
 
+	// Ruta para descargar una parte de un snapshot (solo líder)
+	clusterRoutes.Get("/sync/:snapshotId/chunks/:index", cluster.RouteLocalOnly, replicatedOnly, func(c *fiber.Ctx) error {
+		index, err := c.ParamsInt("index")
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid chunk index",
+			})
+		}
+
+		chunk, size, err := cluster.OpenSnapshotChunk(c.Params("snapshotId"), index)
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		// El archivo se cierra cuando termina el envío
+		c.Set(fiber.HeaderContentType, "application/octet-stream")
+		return cluster.SendStream(c, chunk, int(size))
+	})
+
+	// Ruta para consultar los hashes por rango de las tablas de este nodo
+	clusterRoutes.Get("/checksums", cluster.RouteLocalOnly, replicatedOnly, middleware.DatabaseLease, func(c *fiber.Ctx) error {
+		rangeSize := c.QueryInt("range", 1000)
+		if rangeSize < 1 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid range size",
+			})
+		}
+
+		checksums, err := ClusterState.ComputeChecksums(lib.RequestDB(c), uint64(rangeSize))
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		return c.JSON(checksums)
+	})
+
+	// Ruta para descargar las filas de un rango de claves (solo líder)
+	clusterRoutes.Get("/rows", cluster.RouteLocalOnly, replicatedOnly, middleware.DatabaseLease, func(c *fiber.Ctx) error {
+		if !ClusterState.IsLeader() {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Only leader can provide rows for repair",
+			})
+		}
+
+		start, end := c.QueryInt("start", -1), c.QueryInt("end", -1)
+		if start < 0 || end <= start {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid key range",
+			})
+		}
+
+		rows, err := ClusterState.ReadRowRange(lib.RequestDB(c), c.Query("table"), uint64(start), uint64(end))
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		return c.JSON(rows)
+	})
+
+	// Ruta para verificar (y reparar) las tablas de los seguidores contra el líder.
+	// En el líder se verifican todos los seguidores; en un seguidor, solo él mismo.
+	// Los operadores la usan con el token de administración; el líder la llama
+	// en cada seguidor con una petición firmada.
+	verify := func(c *fiber.Ctx) error {
+		repair := c.QueryBool("repair", true)
+
+		if ClusterState.IsLeader() {
+			return c.JSON(fiber.Map{
+				"reports": ClusterState.VerifyCluster(repair),
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"reports": []cluster.VerifyReport{ClusterState.VerifyWithLeader(repair)},
+		})
+	}
+	clusterRoutes.Post("/verify", cluster.RouteLocalOnly, replicatedOnly, verify)
+	admin.Post("/verify", cluster.RouteLocalOnly, replicatedOnly, verify)
+
 	// Get the server port from environment variable or use default
 	var port string = os.Getenv("PORT")
 	if port == "" {
@@ -148,8 +586,62 @@ func main() {
 	// Serve static files from the public directory
 	app.Static("/", "./public")
 
-	fmt.Printf("Server is running on port %s (Node ID: %d, Role: %s)\n",
-		port, ClusterState.GetCurrentNodeID(), ClusterState.GetCurrentRole())
+	// Activar las clases declaradas; no arrancar si alguna ruta se registró sin clase
+	if err := ClusterState.ClassifyRoutes(app); err != nil {
+		fatal("Invalid route declarations", "error", err)
+	}
+
+	slog.Info("Server is running", "port", port, "node_id", ClusterState.GetCurrentNodeID(),
+		"role", ClusterState.GetCurrentRole(), "term", ClusterState.GetCurrentTerm())
 	// Start the Fiber server on the specified port
-	app.Listen(":" + port)
+	serverErr := make(chan error, 1)
+
+	// Los mensajes entre nodos llegan por el listener TLS (si está configurado), que
+	// empieza a atender cuando la aplicación ya registró sus rutas
+	app.Hooks().OnListen(func(fiber.ListenData) error {
+		go func() {
+			if err := cluster.ServeTLS(app); err != nil {
+				serverErr <- err
+			}
+		}()
+		return nil
+	})
+
+	go func() {
+		serverErr <- app.Listen(":" + port)
+	}()
+
+	// Apagado ordenado (docker stop / Swarm envían SIGTERM): el líder cede el liderazgo
+	// antes de cerrar el servidor y se terminan de atender las peticiones en curso
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	select {
+	case err := <-serverErr:
+		fatal("Server stopped", "error", err)
+	case sig := <-signals:
+		slog.Info("Shutting down", "signal", sig.String())
+	}
+
+	ClusterState.Shutdown(cluster.ShutdownTimeout())
+
+	if err := app.ShutdownWithTimeout(cluster.DrainTimeout()); err != nil {
+		slog.Error("Error draining requests", "error", err)
+	}
+
+	if err := lib.CloseDB(); err != nil {
+		slog.Error("Error closing database", "error", err)
+	}
+
+	if err := shutdownTracing(context.Background()); err != nil {
+		slog.Error("Error flushing traces", "error", err)
+	}
+
+	slog.Info("Server stopped")
+}
+
+// fatal logs the error and stops the server
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
 }
@@ -0,0 +1,226 @@
+package cluster
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// adminForwardedHeader marca una petición de administración ya reenviada por otro nodo
+const adminForwardedHeader = "X-Cluster-Admin-Forwarded"
+
+// transferTimeout retorna cuánto puede tardar una cesión del liderazgo pedida por un operador
+func transferTimeout() time.Duration {
+	return envDuration("CLUSTER_TRANSFER_TIMEOUT", 5*time.Second)
+}
+
+// AdminAuth middleware exige el token de CLUSTER_ADMIN_TOKEN en el header Authorization
+// ("Bearer <token>"). Sin token configurado los endpoints de administración están desactivados.
+func AdminAuth() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		token := os.Getenv("CLUSTER_ADMIN_TOKEN")
+		if token == "" {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error":   "Admin endpoints disabled",
+				"message": "Set CLUSTER_ADMIN_TOKEN to enable cluster administration",
+			})
+		}
+
+		if !validAdminToken(c) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Invalid admin token",
+			})
+		}
+
+		return c.Next()
+	}
+}
+
+// validAdminToken indica si la petición trae el token de administración configurado
+func validAdminToken(c *fiber.Ctx) bool {
+	token := os.Getenv("CLUSTER_ADMIN_TOKEN")
+	authHeader := c.Get(fiber.HeaderAuthorization)
+	if token == "" || len(authHeader) <= 7 || authHeader[:7] != "Bearer " {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(authHeader[7:]), []byte(token)) == 1
+}
+
+// ForwardAdminRequest reenvía una petición de administración al nodo que debe atenderla.
+// Solo se reenvía una vez para no entrar en un ciclo entre nodos con vistas distintas del cluster.
+func ForwardAdminRequest(c *fiber.Ctx, clusterState *ClusterState, address string) error {
+	if c.Get(adminForwardedHeader) != "" {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":   "Request forwarded to the wrong node",
+			"message": "The cluster changed while forwarding the request, retry it",
+		})
+	}
+
+	c.Request().Header.Set(adminForwardedHeader, "1")
+	return proxyRequest(c, clusterState, address, "node")
+}
+
+// NodeAddress retorna la dirección de un nodo conocido
+func (cs *ClusterState) NodeAddress(nodeID string) (string, bool) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	node, exists := cs.Nodes[nodeID]
+	if !exists {
+		return "", false
+	}
+	return node.Address, true
+}
+
+// InMaintenance indica si el nodo está en modo mantenimiento
+func (cs *ClusterState) InMaintenance() bool {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	return cs.maintenance
+}
+
+// selfEligibilityUnsafe indica si este nodo puede ser líder y, si no, por qué (usar solo con lock)
+func (cs *ClusterState) selfEligibilityUnsafe() (bool, string) {
+	switch {
+	case cs.shuttingDown:
+		return false, "shutting down"
+	case cs.maintenance:
+		return false, "in maintenance mode"
+	case cs.schemaOutdatedUnsafe():
+		return false, fmt.Sprintf("schema version %d older than the database (%d)", cs.codeSchemaVersion, cs.appliedSchemaVersion)
+	case cs.CurrentRole != Leader && !cs.IsReady:
+		return false, "not synchronized with the leader"
+	}
+	return true, ""
+}
+
+// leadershipEligibilityUnsafe indica si un nodo puede recibir el liderazgo y, si no,
+// por qué (usar solo con lock)
+func (cs *ClusterState) leadershipEligibilityUnsafe(node *Node) (bool, string) {
+	if node.ID == cs.CurrentNodeID {
+		return cs.selfEligibilityUnsafe()
+	}
+
+	switch {
+	case node.Maintenance:
+		return false, "in maintenance mode"
+	case node.SchemaVersion < cs.minLeaderSchemaVersionUnsafe():
+		return false, fmt.Sprintf("schema version %d older than the cluster (%d)", node.SchemaVersion, cs.minLeaderSchemaVersionUnsafe())
+	case node.State != MemberAlive:
+		return false, fmt.Sprintf("unreachable (%s)", node.State)
+	}
+	return true, ""
+}
+
+// TransferLeadership cede el liderazgo al nodo indicado o, si targetID está vacío, al
+// seguidor elegible más actualizado. Mientras tanto el líder no acepta escrituras.
+// Retorna el ID del nuevo líder.
+func (cs *ClusterState) TransferLeadership(targetID string) (string, error) {
+	cs.mu.Lock()
+	if cs.CurrentRole != Leader {
+		cs.mu.Unlock()
+		return "", ErrNotLeader
+	}
+	if cs.transferring || cs.shuttingDown {
+		cs.mu.Unlock()
+		return "", fmt.Errorf("leadership transfer already in progress")
+	}
+	if targetID != "" {
+		node, exists := cs.Nodes[targetID]
+		if !exists {
+			cs.mu.Unlock()
+			return "", fmt.Errorf("unknown node %s", targetID)
+		}
+		if targetID == cs.CurrentNodeID {
+			cs.mu.Unlock()
+			return "", fmt.Errorf("node %s is already the leader", targetID)
+		}
+		if eligible, reason := cs.leadershipEligibilityUnsafe(node); !eligible {
+			cs.mu.Unlock()
+			return "", fmt.Errorf("node %s is not eligible for leadership: %s", targetID, reason)
+		}
+	}
+	cs.transferring = true
+	cs.mu.Unlock()
+
+	defer func() {
+		cs.mu.Lock()
+		cs.transferring = false
+		cs.mu.Unlock()
+	}()
+
+	candidates := cs.handOffCandidates()
+	if targetID != "" {
+		selected := candidates[:0]
+		for _, candidate := range candidates {
+			if candidate.ID == targetID {
+				selected = append(selected, candidate)
+			}
+		}
+		candidates = selected
+	}
+	if len(candidates) == 0 {
+		return "", fmt.Errorf("no eligible follower to take over leadership")
+	}
+
+	deadline := time.Now().Add(transferTimeout())
+	if !cs.waitForWrites(deadline) {
+		return "", fmt.Errorf("in-flight writes did not finish in time")
+	}
+
+	leaderID, ok := cs.handOffTo(candidates, deadline)
+	if !ok {
+		return "", fmt.Errorf("leadership transfer timed out after %v", transferTimeout())
+	}
+
+	slog.Info("Leadership transferred", "node_id", leaderID)
+	return leaderID, nil
+}
+
+// SetMaintenance activa o desactiva el modo mantenimiento del nodo. Un nodo en
+// mantenimiento no inicia elecciones ni recibe el liderazgo y rechaza las escrituras;
+// si es el líder, primero cede el liderazgo. El cambio se difunde por gossip.
+func (cs *ClusterState) SetMaintenance(enabled bool) error {
+	cs.mu.Lock()
+	if cs.maintenance == enabled {
+		cs.mu.Unlock()
+		return nil
+	}
+
+	cs.maintenance = enabled
+	if err := cs.persistStateUnsafe(); err != nil {
+		cs.maintenance = !enabled
+		cs.mu.Unlock()
+		return fmt.Errorf("error persisting maintenance mode: %v", err)
+	}
+
+	// Anunciar el cambio con una incarnation mayor para que prevalezca en el gossip
+	cs.incarnation++
+	if node, exists := cs.Nodes[cs.CurrentNodeID]; exists {
+		node.Maintenance = enabled
+	}
+	cs.enqueueUpdateUnsafe(cs.selfUpdateUnsafe())
+	isLeader := cs.CurrentRole == Leader
+	cs.mu.Unlock()
+
+	if !enabled {
+		slog.Info("Node left maintenance mode")
+		return nil
+	}
+	slog.Info("Node entered maintenance mode")
+
+	if isLeader {
+		if _, err := cs.TransferLeadership(""); err != nil {
+			// Un líder no puede quedar en mantenimiento
+			if revertErr := cs.SetMaintenance(false); revertErr != nil {
+				slog.Error("Error leaving maintenance mode", "error", revertErr)
+			}
+			return fmt.Errorf("could not hand off leadership: %v", err)
+		}
+	}
+	return nil
+}
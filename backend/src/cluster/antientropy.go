@@ -0,0 +1,527 @@
+package cluster
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// verifyAttempts es cuántas veces se reintenta la comparación si el log avanza mientras tanto
+const verifyAttempts = 3
+
+// verifyWaitTimeout es cuánto espera el seguidor a alcanzar la posición del líder
+const verifyWaitTimeout = 10 * time.Second
+
+// antiEntropyInterval retorna cada cuánto un seguidor se compara con el líder
+func antiEntropyInterval() time.Duration {
+	return envDuration("CLUSTER_ANTI_ENTROPY_INTERVAL", 10*time.Minute)
+}
+
+// checksumRangeSize retorna cuántas claves primarias cubre cada rango de hashes
+func checksumRangeSize() uint64 {
+	size := envInt("CLUSTER_CHECKSUM_RANGE", 1000)
+	if size < 1 {
+		size = 1000
+	}
+	return uint64(size)
+}
+
+// startAntiEntropy compara periódicamente las tablas del seguidor con las del líder y
+// repara los rangos que difieren
+func (cs *ClusterState) startAntiEntropy() {
+	ticker := time.NewTicker(antiEntropyInterval())
+	go func() {
+		for range ticker.C {
+			if cs.IsLeader() || !cs.IsNodeReady() {
+				continue
+			}
+			logVerifyReport(cs.VerifyWithLeader(true))
+		}
+	}()
+}
+
+// logVerifyReport muestra el resultado de una verificación
+func logVerifyReport(report VerifyReport) {
+	switch {
+	case report.Error != "":
+		slog.Error("Anti-entropy verification failed", "error", report.Error)
+	case report.Consistent:
+		slog.Debug("Anti-entropy: consistent with leader", "index", report.Index)
+	default:
+		slog.Warn("Anti-entropy: ranges diverged from leader",
+			"ranges", len(report.Diverged), "index", report.Index, "repaired_rows", report.RepairedRows)
+	}
+}
+
+// ComputeChecksums calcula los hashes por rango de todas las tablas replicadas. Cada
+// fila aporta su clave primaria, updated_at y deleted_at; se leen dentro de una
+// transacción para que los hashes correspondan a la última entrada del log.
+func (cs *ClusterState) ComputeChecksums(db *gorm.DB, rangeSize uint64) (ChecksumResponse, error) {
+	response := ChecksumResponse{
+		NodeID:    cs.GetCurrentNodeID(),
+		RangeSize: rangeSize,
+		Tables:    []TableChecksums{},
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		index, _, err := lastLogEntry(tx)
+		if err != nil {
+			return err
+		}
+		response.LastIndex = index
+
+		for _, sch := range cs.replicatedSchemas() {
+			checksums, err := tableChecksums(tx, sch, rangeSize)
+			if err != nil {
+				return err
+			}
+			response.Tables = append(response.Tables, checksums)
+		}
+		return nil
+	})
+	if err != nil {
+		return ChecksumResponse{}, err
+	}
+
+	return response, nil
+}
+
+// replicatedSchemas retorna los esquemas registrados ordenados por tabla
+func (cs *ClusterState) replicatedSchemas() []*schema.Schema {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	schemas := make([]*schema.Schema, 0, len(cs.schemas))
+	for _, sch := range cs.schemas {
+		if sch.PrioritizedPrimaryField != nil {
+			schemas = append(schemas, sch)
+		}
+	}
+	sort.Slice(schemas, func(i, j int) bool {
+		return schemas[i].Table < schemas[j].Table
+	})
+	return schemas
+}
+
+// tableChecksums agrupa las filas de una tabla en rangos de claves consecutivas
+func tableChecksums(tx *gorm.DB, sch *schema.Schema, rangeSize uint64) (TableChecksums, error) {
+	primaryKey := sch.PrioritizedPrimaryField.DBName
+	columns := []string{primaryKey}
+	for _, name := range []string{"updated_at", "deleted_at"} {
+		if field := sch.LookUpField(name); field != nil && field.DBName != "" {
+			columns = append(columns, field.DBName)
+		}
+	}
+
+	checksums := TableChecksums{Table: sch.Table, Ranges: []RangeChecksum{}}
+	var current *RangeChecksum
+	var rangeHash hash.Hash
+	closeRange := func() {
+		if current != nil {
+			current.Hash = hex.EncodeToString(rangeHash.Sum(nil))
+			checksums.Ranges = append(checksums.Ranges, *current)
+		}
+	}
+
+	query := tx.Session(&gorm.Session{NewDB: true}).
+		Table(sch.Table).
+		Select(columns).
+		Order(clause.OrderByColumn{Column: clause.Column{Name: primaryKey}})
+
+	err := scanRowImages(query, sch, func(key interface{}, row RowData) {
+		start := uint64(recordIDOf(key)) / rangeSize * rangeSize
+		if current == nil || current.Start != start {
+			closeRange()
+			current = &RangeChecksum{Start: start, End: start + rangeSize}
+			rangeHash = sha256.New()
+		}
+
+		for _, column := range columns {
+			rangeHash.Write(row[column])
+			rangeHash.Write([]byte{0})
+		}
+		current.Count++
+		checksums.Count++
+	})
+	if err != nil {
+		return TableChecksums{}, err
+	}
+	closeRange()
+
+	tableHash := sha256.New()
+	for _, r := range checksums.Ranges {
+		fmt.Fprintf(tableHash, "%d:%s\n", r.Start, r.Hash)
+	}
+	checksums.Hash = hex.EncodeToString(tableHash.Sum(nil))
+
+	return checksums, nil
+}
+
+// ReadRowRange retorna la imagen de las filas de una tabla con clave en [start, end),
+// junto con la última entrada del log en que se leyeron
+func (cs *ClusterState) ReadRowRange(db *gorm.DB, table string, start, end uint64) (RowRange, error) {
+	sch, err := cs.schemaForTable(table)
+	if err != nil {
+		return RowRange{}, err
+	}
+	if sch.PrioritizedPrimaryField == nil {
+		return RowRange{}, fmt.Errorf("table %s has no primary key", table)
+	}
+
+	result := RowRange{Table: table, Start: start, End: end, Rows: []RowData{}}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		index, _, err := lastLogEntry(tx)
+		if err != nil {
+			return err
+		}
+		result.LastIndex = index
+
+		return scanRowImages(rangeQuery(tx, sch, start, end), sch, func(key interface{}, row RowData) {
+			result.Rows = append(result.Rows, row)
+		})
+	})
+	if err != nil {
+		return RowRange{}, err
+	}
+
+	return result, nil
+}
+
+// rangeQuery selecciona las filas con clave primaria en [start, end), incluidas las
+// que tienen borrado lógico
+func rangeQuery(tx *gorm.DB, sch *schema.Schema, start, end uint64) *gorm.DB {
+	column := clause.Column{Name: sch.PrioritizedPrimaryField.DBName}
+	return tx.Session(&gorm.Session{NewDB: true}).
+		Table(sch.Table).
+		Clauses(clause.Where{Exprs: []clause.Expression{
+			clause.Gte{Column: column, Value: start},
+			clause.Lt{Column: column, Value: end},
+		}}).
+		Order(clause.OrderByColumn{Column: column})
+}
+
+// VerifyWithLeader compara las tablas de este seguidor con las del líder en la misma
+// posición del log y, si repair es true, copia del líder las filas de los rangos que
+// difieren
+func (cs *ClusterState) VerifyWithLeader(repair bool) VerifyReport {
+	cs.verifyMu.Lock()
+	defer cs.verifyMu.Unlock()
+
+	report := VerifyReport{NodeID: cs.GetCurrentNodeID(), CheckedAt: time.Now()}
+	if err := cs.verifyWithLeader(repair, &report); err != nil {
+		report.Error = err.Error()
+	}
+	return report
+}
+
+// verifyWithLeader reintenta la comparación hasta hacerla en una posición estable del log
+func (cs *ClusterState) verifyWithLeader(repair bool, report *VerifyReport) error {
+	if cs.IsLeader() {
+		return fmt.Errorf("the leader is the reference for verification")
+	}
+	if !cs.IsNodeReady() {
+		return fmt.Errorf("node is not ready")
+	}
+
+	cs.mu.RLock()
+	leaderID, leaderAddress := cs.LeaderID, cs.LeaderAddress
+	cs.mu.RUnlock()
+	if leaderAddress == "" {
+		return fmt.Errorf("no leader available")
+	}
+	report.LeaderID = leaderID
+
+	for attempt := 1; attempt <= verifyAttempts; attempt++ {
+		leader, err := fetchChecksums(leaderAddress)
+		if err != nil {
+			return err
+		}
+
+		if cs.WaitForApplied(leader.LastIndex, verifyWaitTimeout) {
+			compared, err := cs.compareAtIndex(leaderAddress, leader, repair, report)
+			if err != nil {
+				return err
+			}
+			if compared {
+				return nil
+			}
+		}
+
+		slog.Debug("Anti-entropy: replication log moved during verification", "attempt", attempt, "max_attempts", verifyAttempts)
+	}
+
+	return fmt.Errorf("could not reach a stable log position after %d attempts", verifyAttempts)
+}
+
+// compareAtIndex compara con los hashes del líder si el seguidor está exactamente en
+// la misma entrada del log. Mientras tanto no se aplican mensajes de replicación.
+func (cs *ClusterState) compareAtIndex(leaderAddress string, leader ChecksumResponse, repair bool, report *VerifyReport) (bool, error) {
+	cs.applyMu.Lock()
+	defer cs.applyMu.Unlock()
+
+	db := cs.getDB()
+	local, err := cs.ComputeChecksums(db, leader.RangeSize)
+	if err != nil {
+		return false, err
+	}
+	if local.LastIndex != leader.LastIndex {
+		return false, nil
+	}
+
+	diverged := diffChecksums(leader.Tables, local.Tables)
+	report.Index = local.LastIndex
+	report.Diverged = diverged
+	report.Consistent = len(diverged) == 0
+	if report.Consistent || !repair {
+		return true, nil
+	}
+
+	repaired, stable, err := cs.repairRanges(db, leaderAddress, local.LastIndex, diverged)
+	if err != nil || !stable {
+		return false, err
+	}
+	report.RepairedRows = repaired
+	return true, nil
+}
+
+// diffChecksums retorna los rangos cuyo hash difiere entre el líder y el seguidor,
+// incluidos los que solo existen en uno de los dos
+func diffChecksums(leader, local []TableChecksums) []DivergentRange {
+	localTables := make(map[string]TableChecksums, len(local))
+	for _, table := range local {
+		localTables[table.Table] = table
+	}
+
+	diverged := []DivergentRange{}
+	for _, leaderTable := range leader {
+		localTable := localTables[leaderTable.Table]
+		if localTable.Hash == leaderTable.Hash {
+			continue
+		}
+
+		ranges := make(map[uint64]*DivergentRange)
+		starts := []uint64{}
+		rangeAt := func(r RangeChecksum) *DivergentRange {
+			if _, exists := ranges[r.Start]; !exists {
+				ranges[r.Start] = &DivergentRange{Table: leaderTable.Table, Start: r.Start, End: r.End}
+				starts = append(starts, r.Start)
+			}
+			return ranges[r.Start]
+		}
+
+		leaderHashes := make(map[uint64]string, len(leaderTable.Ranges))
+		for _, r := range leaderTable.Ranges {
+			leaderHashes[r.Start] = r.Hash
+			rangeAt(r).LeaderCount = r.Count
+		}
+		localHashes := make(map[uint64]string, len(localTable.Ranges))
+		for _, r := range localTable.Ranges {
+			localHashes[r.Start] = r.Hash
+			rangeAt(r).LocalCount = r.Count
+		}
+
+		sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+		for _, start := range starts {
+			leaderHash, inLeader := leaderHashes[start]
+			localHash, inLocal := localHashes[start]
+			if !inLeader || !inLocal || leaderHash != localHash {
+				diverged = append(diverged, *ranges[start])
+			}
+		}
+	}
+	return diverged
+}
+
+// repairRanges descarga del líder las filas de los rangos que difieren y las escribe
+// en una sola transacción: solo se tocan las filas distintas o ausentes en alguno de
+// los dos nodos. Retorna false si el líder ya avanzó a otra posición del log.
+func (cs *ClusterState) repairRanges(db *gorm.DB, leaderAddress string, index uint64, diverged []DivergentRange) (int, bool, error) {
+	leaderRanges := make([]RowRange, 0, len(diverged))
+	for _, r := range diverged {
+		rows, err := fetchRowRange(leaderAddress, r)
+		if err != nil {
+			return 0, false, err
+		}
+		if rows.LastIndex != index {
+			return 0, false, nil
+		}
+		leaderRanges = append(leaderRanges, rows)
+	}
+
+	repaired := 0
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for _, leaderRange := range leaderRanges {
+			count, err := cs.repairRange(tx, leaderRange)
+			if err != nil {
+				return err
+			}
+			repaired += count
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, false, fmt.Errorf("error repairing rows: %v", err)
+	}
+
+	return repaired, true, nil
+}
+
+// repairRange iguala las filas locales de un rango a las del líder
+func (cs *ClusterState) repairRange(tx *gorm.DB, leaderRange RowRange) (int, error) {
+	sch, err := cs.schemaForTable(leaderRange.Table)
+	if err != nil {
+		return 0, err
+	}
+	primaryKey := sch.PrioritizedPrimaryField.DBName
+
+	local := make(map[string]RowData)
+	localKeys := make(map[string]interface{})
+	err = scanRowImages(rangeQuery(tx, sch, leaderRange.Start, leaderRange.End), sch, func(key interface{}, row RowData) {
+		local[fmt.Sprint(key)] = row
+		localKeys[fmt.Sprint(key)] = key
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	repaired := 0
+	for _, row := range leaderRange.Rows {
+		key := string(bytes.TrimSpace(row[primaryKey]))
+		localRow, exists := local[key]
+		delete(local, key)
+		if exists && sameRow(localRow, row) {
+			continue
+		}
+		if err := cs.applyRowChange(tx, Change{Operation: "INSERT", Table: leaderRange.Table, Data: row}); err != nil {
+			return 0, err
+		}
+		repaired++
+	}
+
+	// Las filas que quedan no existen en el líder
+	for key := range local {
+		change := Change{Operation: "DELETE", Table: leaderRange.Table, RecordID: recordIDOf(localKeys[key])}
+		if err := cs.applyRowChange(tx, change); err != nil {
+			return 0, err
+		}
+		repaired++
+	}
+
+	if repaired > 0 {
+		slog.Info("Anti-entropy: repaired rows", "rows", repaired, "table", leaderRange.Table,
+			"start", leaderRange.Start, "end", leaderRange.End)
+	}
+	return repaired, nil
+}
+
+// sameRow indica si dos imágenes de fila tienen los mismos valores
+func sameRow(a, b RowData) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for column, value := range a {
+		if !bytes.Equal(value, b[column]) {
+			return false
+		}
+	}
+	return true
+}
+
+// fetchChecksums pide al líder los hashes de sus tablas
+func fetchChecksums(leaderAddress string) (ChecksumResponse, error) {
+	var checksums ChecksumResponse
+	err := getClusterJSON(fmt.Sprintf("%s/cluster/checksums?range=%d", leaderAddress, checksumRangeSize()), &checksums)
+	if err != nil {
+		return ChecksumResponse{}, fmt.Errorf("error requesting leader checksums: %v", err)
+	}
+	if checksums.RangeSize == 0 {
+		return ChecksumResponse{}, fmt.Errorf("leader returned checksums without range size")
+	}
+	return checksums, nil
+}
+
+// fetchRowRange pide al líder las filas de un rango
+func fetchRowRange(leaderAddress string, r DivergentRange) (RowRange, error) {
+	query := url.Values{}
+	query.Set("table", r.Table)
+	query.Set("start", fmt.Sprint(r.Start))
+	query.Set("end", fmt.Sprint(r.End))
+
+	var rows RowRange
+	if err := getClusterJSON(leaderAddress+"/cluster/rows?"+query.Encode(), &rows); err != nil {
+		return RowRange{}, fmt.Errorf("error requesting rows of %s from leader: %v", r.Table, err)
+	}
+	return rows, nil
+}
+
+// getClusterJSON hace un GET a otro nodo y decodifica la respuesta JSON
+func getClusterJSON(url string, response interface{}) error {
+	resp, err := snapshotClient.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("request failed with status: %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(response)
+}
+
+// VerifyCluster pide a cada seguidor que se compare con el líder y retorna sus informes
+func (cs *ClusterState) VerifyCluster(repair bool) []VerifyReport {
+	cs.mu.RLock()
+	peers := cs.peersUnsafe()
+	cs.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	reports := make([]VerifyReport, len(peers))
+	for i, peer := range peers {
+		wg.Add(1)
+		go func(i int, peer Node) {
+			defer wg.Done()
+			report, err := requestVerify(peer.Address, repair)
+			if err != nil {
+				report = VerifyReport{NodeID: peer.ID, Error: err.Error(), CheckedAt: time.Now()}
+			}
+			reports[i] = report
+		}(i, *peer)
+	}
+	wg.Wait()
+
+	sort.Slice(reports, func(i, j int) bool { return reports[i].NodeID < reports[j].NodeID })
+	return reports
+}
+
+// requestVerify pide a un seguidor que se compare con el líder
+func requestVerify(address string, repair bool) (VerifyReport, error) {
+	resp, err := snapshotClient.Post(fmt.Sprintf("%s/cluster/verify?repair=%t", address, repair), "application/json", nil)
+	if err != nil {
+		return VerifyReport{}, fmt.Errorf("error requesting verification: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Reports []VerifyReport `json:"reports"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return VerifyReport{}, fmt.Errorf("error decoding verification report: %v", err)
+	}
+	if len(result.Reports) != 1 {
+		return VerifyReport{}, fmt.Errorf("unexpected verification response from %s", address)
+	}
+	return result.Reports[0], nil
+}
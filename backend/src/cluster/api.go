@@ -1,5 +1,11 @@
 package cluster
 
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
 // IsLeader verifica si el nodo actual es el líder
 func (cs *ClusterState) IsLeader() bool {
 	cs.mu.RLock()
@@ -15,12 +21,26 @@ func (cs *ClusterState) GetLeaderAddress() string {
 }
 
 // GetCurrentNodeID retorna el ID del nodo actual
-func (cs *ClusterState) GetCurrentNodeID() int {
+func (cs *ClusterState) GetCurrentNodeID() string {
 	cs.mu.RLock()
 	defer cs.mu.RUnlock()
 	return cs.CurrentNodeID
 }
 
+// getDB retorna la conexión actual a la base de datos local
+func (cs *ClusterState) getDB() *gorm.DB {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	return cs.db
+}
+
+// GetCurrentTerm retorna el término actual del nodo
+func (cs *ClusterState) GetCurrentTerm() uint64 {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	return cs.CurrentTerm
+}
+
 // GetCurrentRole retorna el rol del nodo actual
 func (cs *ClusterState) GetCurrentRole() NodeRole {
 	cs.mu.RLock()
@@ -30,26 +50,90 @@ func (cs *ClusterState) GetCurrentRole() NodeRole {
 
 // GetClusterInfo retorna información del cluster para API
 func (cs *ClusterState) GetClusterInfo() map[string]interface{} {
+	var firstIndex, lastIndex uint64
+	if db := cs.getDB(); db != nil {
+		firstIndex, _ = firstLogIndex(db)
+		lastIndex = LastLogIndex(db)
+	}
+	// Entradas que le faltan a cada seguidor (solo se conocen en el líder)
+	lags := cs.replicationLags(lastIndex)
+
 	cs.mu.RLock()
 	defer cs.mu.RUnlock()
 
+	selfLag := uint64(0)
+	if cs.CurrentRole != Leader {
+		selfLag = lagBehind(cs.leaderLastIndex, lastIndex)
+	}
+
+	// Nodos cuyo binario no conoce el esquema aplicado en el cluster: no pueden ser líder
+	outdated := make([]string, 0)
+
 	nodes := make([]map[string]interface{}, 0)
 	for _, node := range cs.Nodes {
-		nodes = append(nodes, map[string]interface{}{
-			"id":        node.ID,
-			"address":   node.Address,
-			"role":      node.Role,
-			"is_leader": node.ID == cs.LeaderID,
-			"healthy":   node.IsHealthy,
-		})
+		lastHeard := node.LastSeen
+		maintenance := node.Maintenance
+		schemaVersion := node.SchemaVersion
+		if node.ID == cs.CurrentNodeID {
+			lastHeard = time.Now()
+			maintenance = cs.maintenance
+			schemaVersion = cs.codeSchemaVersion
+		}
+		schemaOutdated := schemaVersion < cs.appliedSchemaVersion
+		if schemaOutdated {
+			outdated = append(outdated, node.ID)
+		}
+
+		// Quién puede recibir el liderazgo y, si no, por qué
+		eligible, reason := cs.leadershipEligibilityUnsafe(node)
+		info := map[string]interface{}{
+			"id":             node.ID,
+			"address":        node.Address,
+			"public_address": cs.publicAddressOfUnsafe(node.ID),
+			"role":           node.Role,
+			"is_leader":      node.ID == cs.LeaderID,
+			"healthy":        node.IsHealthy(),
+			"state":          node.State,
+			"incarnation":    node.Incarnation,
+			"last_heard":     lastHeard,
+			"maintenance":    maintenance,
+			"schema_version": schemaVersion,
+			"outdated":       schemaOutdated,
+			"eligible":       eligible,
+		}
+		if !eligible {
+			info["ineligible_reason"] = reason
+		}
+		if node.ID == cs.CurrentNodeID {
+			info["replication_lag"] = selfLag
+		} else if lag, known := lags[node.ID]; known && cs.CurrentRole == Leader {
+			info["replication_lag"] = lag
+		}
+		nodes = append(nodes, info)
 	}
 
 	return map[string]interface{}{
-		"current_node_id": cs.CurrentNodeID,
-		"current_role":    cs.CurrentRole,
-		"leader_id":       cs.LeaderID,
-		"leader_address":  cs.LeaderAddress,
-		"total_nodes":     len(cs.Nodes),
-		"nodes":           nodes,
+		"current_node_id":       cs.CurrentNodeID,
+		"current_role":          cs.CurrentRole,
+		"current_term":          cs.CurrentTerm,
+		"voted_for":             cs.VotedFor,
+		"cluster_size":          cs.clusterSize,
+		"quorum":                cs.quorumSizeUnsafe(),
+		"write_concern":         cs.WriteConcern,
+		"write_mode":            cs.WriteMode,
+		"shared_database":       cs.sharedDatabase,
+		"maintenance":           cs.maintenance,
+		"shutting_down":         cs.shuttingDown,
+		"leader_id":             cs.LeaderID,
+		"leader_address":        cs.LeaderAddress,
+		"first_index":           firstIndex,
+		"last_index":            lastIndex,
+		"replication_lag":       selfLag,
+		"schema_version":        cs.appliedSchemaVersion,
+		"known_schema_version":  cs.codeSchemaVersion,
+		"outdated_nodes":        outdated,
+		"leader_public_address": cs.publicAddressOfUnsafe(cs.LeaderID),
+		"total_nodes":           len(cs.Nodes),
+		"nodes":                 nodes,
 	}
 }
@@ -0,0 +1,496 @@
+package cluster
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/theleywin/Backend-Talent-Nest/src/tracing"
+)
+
+// Headers con los que se firman las peticiones y respuestas entre nodos
+const (
+	timestampHeader = "X-Cluster-Timestamp"
+	nonceHeader     = "X-Cluster-Nonce"
+	signatureHeader = "X-Cluster-Signature"
+)
+
+// streamBodyHash reemplaza al hash del cuerpo en la firma de las respuestas enviadas en
+// streaming, que se firman antes de generar el cuerpo: indica que el cuerpo viaja en
+// partes firmadas una por una (ver SendStream)
+const streamBodyHash = "stream"
+
+// streamFrameSize es el tamaño máximo de los datos de cada parte firmada de un streaming
+const streamFrameSize = 32 * 1024
+
+// clusterSecret retorna la clave compartida de CLUSTER_SECRET (nil si no está definida:
+// el nodo no arranca y los endpoints del cluster rechazan todas las peticiones)
+func clusterSecret() []byte {
+	secret := os.Getenv("CLUSTER_SECRET")
+	if secret == "" {
+		return nil
+	}
+	return []byte(secret)
+}
+
+// signatureMaxSkew retorna la diferencia máxima aceptada entre el reloj del emisor y el local
+func signatureMaxSkew() time.Duration {
+	return envDuration("CLUSTER_SIGNATURE_MAX_SKEW", 30*time.Second)
+}
+
+// checkAuthConfig valida al arrancar la clave de CLUSTER_SECRET: sin ella los
+// endpoints del cluster no se pueden autenticar, así que el nodo no debe arrancar
+func checkAuthConfig() error {
+	secret := clusterSecret()
+	switch {
+	case secret == nil:
+		return errors.New("CLUSTER_SECRET must be set to authenticate the cluster endpoints")
+	case len(secret) < 32:
+		slog.Warn("CLUSTER_SECRET is shorter than 32 bytes, use a longer random secret")
+	default:
+		slog.Info("Cluster messages are authenticated with HMAC-SHA256")
+	}
+	return nil
+}
+
+// sign calcula la firma HMAC-SHA256 de los campos dados
+func sign(secret []byte, fields ...string) string {
+	mac := hmac.New(sha256.New, secret)
+	for _, field := range fields {
+		mac.Write([]byte(field))
+		mac.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// bodyHash retorna el hash SHA-256 de un cuerpo
+func bodyHash(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// checkTimestamp valida que una marca de tiempo (nanosegundos Unix) esté dentro de la ventana aceptada
+func checkTimestamp(value string) error {
+	nanos, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp %q", value)
+	}
+
+	skew := time.Since(time.Unix(0, nanos))
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > signatureMaxSkew() {
+		return fmt.Errorf("timestamp outside the allowed window (%v)", skew.Round(time.Millisecond))
+	}
+	return nil
+}
+
+// nonceCache recuerda los nonces recibidos dentro de la ventana de tiempo para rechazar
+// mensajes repetidos
+type nonceCache struct {
+	mu        sync.Mutex
+	seen      map[string]time.Time
+	lastPrune time.Time
+}
+
+var seenNonces = &nonceCache{seen: make(map[string]time.Time)}
+
+// remember registra un nonce y retorna false si ya se había recibido
+func (n *nonceCache) remember(nonce string) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	now := time.Now()
+	window := 2 * signatureMaxSkew()
+	if now.Sub(n.lastPrune) > window {
+		for seen, at := range n.seen {
+			if now.Sub(at) > window {
+				delete(n.seen, seen)
+			}
+		}
+		n.lastPrune = now
+	}
+
+	if _, exists := n.seen[nonce]; exists {
+		return false
+	}
+	// Fiber reutiliza el buffer de la petición: el string del header no puede guardarse
+	n.seen[strings.Clone(nonce)] = now
+	return true
+}
+
+// isPublicClusterEndpoint indica si un endpoint del cluster se puede consultar sin
+// firma (el estado lo usan los operadores); su respuesta se firma igualmente
+func isPublicClusterEndpoint(path string) bool {
+	return strings.ToLower(path) == "/cluster/status"
+}
+
+// isAdminEndpoint indica si el path es un endpoint de administración (usa su propio token)
+func isAdminEndpoint(path string) bool {
+	return strings.HasPrefix(strings.ToLower(path), "/cluster/admin/")
+}
+
+// ClusterAuth middleware autentica los mensajes entre nodos con HMAC-SHA256 y la clave
+// compartida CLUSTER_SECRET. Cada petición firma el método, la URI, una marca de tiempo,
+// un nonce y el hash del cuerpo; se rechazan las firmas inválidas, fuera de la ventana
+// de tiempo o con un nonce repetido. La respuesta se firma junto al nonce de la petición
+// para que el emisor compruebe que habló con un nodo del cluster. Los endpoints de
+// administración usan su propio token (AdminAuth) y no aceptan firmas.
+func ClusterAuth() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		path := c.Path()
+		if !isClusterEndpoint(path) || isAdminEndpoint(path) {
+			return c.Next()
+		}
+
+		secret := clusterSecret()
+		if secret == nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Cluster authentication is not configured",
+			})
+		}
+
+		// Con TLS configurado los mensajes entre nodos solo se aceptan por el listener TLS
+		if !isPublicClusterEndpoint(path) && requiresTLS(c) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error":   "Cluster endpoints require TLS",
+				"message": fmt.Sprintf("Use port %d", tlsPort()),
+			})
+		}
+
+		nonce := c.Get(nonceHeader)
+
+		if !isPublicClusterEndpoint(path) {
+			if err := verifyRequest(c, secret); err != nil {
+				slog.Warn("Rejected cluster request", "method", c.Method(), "path", path, "remote", c.IP(), "error", err)
+				c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+					"error": "Unauthorized cluster request",
+				})
+				signResponse(c, secret, nonce)
+				return nil
+			}
+		}
+
+		if err := c.Next(); err != nil {
+			if handlerErr := c.App().Config().ErrorHandler(c, err); handlerErr != nil {
+				return handlerErr
+			}
+		}
+
+		signResponse(c, secret, nonce)
+		return nil
+	}
+}
+
+// verifyRequest valida la firma de una petición recibida de otro nodo
+func verifyRequest(c *fiber.Ctx, secret []byte) error {
+	timestamp, nonce, signature := c.Get(timestampHeader), c.Get(nonceHeader), c.Get(signatureHeader)
+	if timestamp == "" || nonce == "" || signature == "" {
+		return errors.New("missing signature")
+	}
+	if err := checkTimestamp(timestamp); err != nil {
+		return err
+	}
+
+	expected := sign(secret, "request", c.Method(), c.OriginalURL(), timestamp, nonce, bodyHash(c.Body()))
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return errors.New("invalid signature")
+	}
+
+	// El nonce se registra solo con una firma válida: nadie más puede llenar la caché
+	if !seenNonces.remember(nonce) {
+		return errors.New("replayed request")
+	}
+	return nil
+}
+
+// signResponse firma el estado y el cuerpo de la respuesta junto al nonce de la petición
+func signResponse(c *fiber.Ctx, secret []byte, nonce string) {
+	if nonce == "" {
+		return
+	}
+
+	// Un streaming se envía en partes firmadas (SendStream); la firma de los headers
+	// indica que el cuerpo debe leerse así
+	hash := streamBodyHash
+	if !c.Response().IsBodyStream() {
+		hash = bodyHash(c.Response().Body())
+	}
+
+	timestamp := strconv.FormatInt(time.Now().UnixNano(), 10)
+	c.Set(timestampHeader, timestamp)
+	c.Set(signatureHeader, sign(secret, "response", strconv.Itoa(c.Response().StatusCode()), nonce, timestamp, hash))
+}
+
+// signingTransport firma las peticiones a los endpoints del cluster y rechaza las
+// respuestas que no estén firmadas por un nodo con la misma clave
+type signingTransport struct {
+	base http.RoundTripper
+}
+
+// newClusterClient crea un cliente HTTP para los mensajes entre nodos (timeout 0 = sin límite)
+func newClusterClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: signingTransport{base: tracing.Transport(clusterTransport)},
+	}
+}
+
+// RoundTrip firma la petición, la envía y verifica la firma de la respuesta
+func (t signingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !isClusterEndpoint(req.URL.Path) || isAdminEndpoint(req.URL.Path) {
+		return t.base.RoundTrip(req)
+	}
+	secret := clusterSecret()
+	if secret == nil {
+		return nil, errors.New("CLUSTER_SECRET is not set")
+	}
+
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error reading request body: %v", err)
+		}
+	}
+
+	nonceBytes := make([]byte, 16)
+	if _, err := rand.Read(nonceBytes); err != nil {
+		return nil, fmt.Errorf("error generating nonce: %v", err)
+	}
+	nonce := hex.EncodeToString(nonceBytes)
+	timestamp := strconv.FormatInt(time.Now().UnixNano(), 10)
+
+	// RoundTrip no debe modificar la petición original
+	signed := req.Clone(req.Context())
+	signed.Body = io.NopCloser(bytes.NewReader(body))
+	signed.ContentLength = int64(len(body))
+	signed.Header.Set(timestampHeader, timestamp)
+	signed.Header.Set(nonceHeader, nonce)
+	signed.Header.Set(signatureHeader, sign(secret, "request", req.Method, req.URL.RequestURI(), timestamp, nonce, bodyHash(body)))
+
+	resp, err := t.base.RoundTrip(signed)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := verifyResponse(resp, secret, nonce); err != nil {
+		resp.Body.Close()
+		return nil, fmt.Errorf("response from %s rejected: %v", req.URL.Host, err)
+	}
+	return resp, nil
+}
+
+// verifyResponse valida la firma de la respuesta de otro nodo a la petición con el nonce dado
+func verifyResponse(resp *http.Response, secret []byte, nonce string) error {
+	timestamp, signature := resp.Header.Get(timestampHeader), resp.Header.Get(signatureHeader)
+	if timestamp == "" || signature == "" {
+		return errors.New("unsigned response")
+	}
+	if err := checkTimestamp(timestamp); err != nil {
+		return err
+	}
+
+	status := strconv.Itoa(resp.StatusCode)
+	if hmac.Equal([]byte(sign(secret, "response", status, nonce, timestamp, streamBodyHash)), []byte(signature)) {
+		// Cada parte del cuerpo se verifica antes de entregarla al que lee la respuesta
+		resp.Body = &verifiedStream{body: resp.Body, secret: secret, nonce: nonce}
+		resp.ContentLength = -1
+		return nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("error reading response body: %v", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	if !hmac.Equal([]byte(sign(secret, "response", status, nonce, timestamp, bodyHash(body))), []byte(signature)) {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+// SendStream envía en streaming el cuerpo de la respuesta de un endpoint del cluster.
+// Si la petición viene firmada, el cuerpo se envía en partes firmadas con el nonce de
+// la petición y un número de secuencia, terminadas por una parte vacía: el nodo que lo
+// recibe verifica cada parte antes de usarla y detecta un cuerpo alterado o cortado.
+func SendStream(c *fiber.Ctx, body io.Reader, size int) error {
+	secret, nonce := clusterSecret(), c.Get(nonceHeader)
+	if secret == nil || nonce == "" {
+		return c.SendStream(body, size)
+	}
+
+	// El nonce se usa después de que el handler retorna: copiarlo del buffer de Fiber
+	c.Context().SetBodyStream(&signedStream{source: body, secret: secret, nonce: strings.Clone(nonce)}, -1)
+	return nil
+}
+
+// SendStreamWriter es SendStream para las respuestas que se generan con un bufio.Writer.
+// Si write retorna un error el cuerpo se corta sin la parte final, así el nodo que lo
+// recibe no confunde una respuesta incompleta con una completa.
+func SendStreamWriter(c *fiber.Ctx, write func(w *bufio.Writer) error) error {
+	reader, writer := io.Pipe()
+	go func() {
+		w := bufio.NewWriter(writer)
+		err := write(w)
+		if err == nil {
+			err = w.Flush()
+		}
+		// Con err nil el que lee recibe io.EOF; con un error, ese error
+		writer.CloseWithError(err)
+	}()
+	return SendStream(c, reader, -1)
+}
+
+// streamFrameMAC firma una parte de un streaming: el nonce la ata a la respuesta de una
+// petición y el número de secuencia impide quitar o reordenar partes
+func streamFrameMAC(secret []byte, nonce string, seq uint64, data []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("stream\n" + nonce + "\n" + strconv.FormatUint(seq, 10) + "\n"))
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// signedStream divide el cuerpo en partes con el formato
+// [largo de 4 bytes][datos][HMAC-SHA256]; una parte vacía marca el final
+type signedStream struct {
+	source io.Reader
+	secret []byte
+	nonce  string
+	seq    uint64
+	data   []byte
+	frame  []byte
+	buf    []byte // Resto de la parte actual pendiente de enviar
+	eof    bool   // La fuente terminó: falta enviar la parte final
+	done   bool
+}
+
+func (s *signedStream) Read(p []byte) (int, error) {
+	for len(s.buf) == 0 {
+		if s.done {
+			return 0, io.EOF
+		}
+		if err := s.nextFrame(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, s.buf)
+	s.buf = s.buf[n:]
+	return n, nil
+}
+
+// nextFrame lee de la fuente los datos de la siguiente parte y la firma
+func (s *signedStream) nextFrame() error {
+	if s.data == nil {
+		s.data = make([]byte, streamFrameSize)
+	}
+
+	n := 0
+	if !s.eof {
+		var err error
+		n, err = s.source.Read(s.data)
+		if err == io.EOF {
+			s.eof = true
+		} else if err != nil {
+			return err
+		}
+		if n == 0 && !s.eof {
+			return nil
+		}
+	}
+
+	data := s.data[:n]
+	s.frame = binary.BigEndian.AppendUint32(s.frame[:0], uint32(n))
+	s.frame = append(s.frame, data...)
+	s.frame = append(s.frame, streamFrameMAC(s.secret, s.nonce, s.seq, data)...)
+	s.buf = s.frame
+	s.seq++
+	s.done = n == 0
+	return nil
+}
+
+// Close cierra la fuente (el archivo del snapshot o el generador del streaming)
+func (s *signedStream) Close() error {
+	if closer, ok := s.source.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// verifiedStream lee un cuerpo enviado con SendStream y solo entrega los datos de las
+// partes con una firma válida, en orden; un cuerpo cortado antes de la parte final es
+// un error
+type verifiedStream struct {
+	body   io.ReadCloser
+	secret []byte
+	nonce  string
+	seq    uint64
+	buf    []byte
+	done   bool
+}
+
+func (s *verifiedStream) Read(p []byte) (int, error) {
+	for len(s.buf) == 0 {
+		if s.done {
+			return 0, io.EOF
+		}
+		if err := s.nextFrame(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, s.buf)
+	s.buf = s.buf[n:]
+	return n, nil
+}
+
+// nextFrame lee la siguiente parte y verifica su firma
+func (s *verifiedStream) nextFrame() error {
+	var header [4]byte
+	if _, err := io.ReadFull(s.body, header[:]); err != nil {
+		return fmt.Errorf("streamed response truncated: %v", err)
+	}
+	size := binary.BigEndian.Uint32(header[:])
+	if size > streamFrameSize {
+		return fmt.Errorf("invalid frame size %d in streamed response", size)
+	}
+
+	frame := make([]byte, int(size)+sha256.Size)
+	if _, err := io.ReadFull(s.body, frame); err != nil {
+		return fmt.Errorf("streamed response truncated: %v", err)
+	}
+	data, mac := frame[:size], frame[size:]
+	if !hmac.Equal(mac, streamFrameMAC(s.secret, s.nonce, s.seq, data)) {
+		return errors.New("invalid signature in streamed response")
+	}
+
+	s.seq++
+	s.done = size == 0
+	s.buf = data
+	return nil
+}
+
+func (s *verifiedStream) Close() error {
+	return s.body.Close()
+}
@@ -0,0 +1,206 @@
+package cluster
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+// roundTripperFunc permite usar una función como transporte HTTP
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// newAuthTestApp crea una aplicación con ClusterAuth que responde con el cuerpo recibido
+func newAuthTestApp(t *testing.T) *fiber.App {
+	t.Helper()
+	t.Setenv("CLUSTER_SECRET", testSecret)
+
+	app := fiber.New()
+	app.Use(ClusterAuth())
+	app.Post("/cluster/heartbeat", func(c *fiber.Ctx) error {
+		return c.Send(c.Body())
+	})
+	return app
+}
+
+// outgoingRequest crea una petición de un nodo a otro, como las del cliente del cluster
+func outgoingRequest(t *testing.T, body string) *http.Request {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodPost, "http://node-b/cluster/heartbeat", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("creating request: %v", err)
+	}
+	return req
+}
+
+// signedRequest firma una petición con signingTransport y la envía a la aplicación;
+// retorna la respuesta verificada y la petición tal como salió firmada
+func signedRequest(t *testing.T, app *fiber.App, body string) (*http.Response, *http.Request) {
+	t.Helper()
+
+	var sent *http.Request
+	transport := signingTransport{base: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		sent = req
+		return app.Test(req, -1)
+	})}
+
+	req := outgoingRequest(t, body)
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("signed request: %v", err)
+	}
+	return resp, sent
+}
+
+// resend envía a la aplicación una copia de la petición firmada con otro cuerpo
+func resend(t *testing.T, app *fiber.App, signed *http.Request, body string) int {
+	t.Helper()
+
+	req := httptest.NewRequest(signed.Method, signed.URL.RequestURI(), strings.NewReader(body))
+	for _, header := range []string{timestampHeader, nonceHeader, signatureHeader} {
+		req.Header.Set(header, signed.Header.Get(header))
+	}
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("sending request: %v", err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestClusterAuthAcceptsSignedRequest(t *testing.T) {
+	app := newAuthTestApp(t)
+
+	resp, _ := signedRequest(t, app, `{"term":1}`)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("reading response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || string(body) != `{"term":1}` {
+		t.Errorf("response = %d %q, want 200 with the request body", resp.StatusCode, body)
+	}
+}
+
+func TestClusterAuthRejectsReplayedRequest(t *testing.T) {
+	app := newAuthTestApp(t)
+
+	resp, signed := signedRequest(t, app, `{"term":1}`)
+	resp.Body.Close()
+
+	if status := resend(t, app, signed, `{"term":1}`); status != http.StatusUnauthorized {
+		t.Errorf("replayed request status = %d, want 401", status)
+	}
+}
+
+func TestClusterAuthRejectsTamperedBody(t *testing.T) {
+	app := newAuthTestApp(t)
+
+	var signed *http.Request
+	transport := signingTransport{base: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		signed = req
+		return nil, io.EOF
+	})}
+	transport.RoundTrip(outgoingRequest(t, `{"term":1}`))
+
+	// La firma es válida para otro cuerpo: el nonce no llega a registrarse
+	if status := resend(t, app, signed, `{"term":99}`); status != http.StatusUnauthorized {
+		t.Errorf("tampered request status = %d, want 401", status)
+	}
+	if status := resend(t, app, signed, `{"term":1}`); status != http.StatusOK {
+		t.Errorf("original request status = %d, want 200", status)
+	}
+}
+
+func TestClusterAuthRejectsUnsignedRequests(t *testing.T) {
+	app := newAuthTestApp(t)
+	stale := strconv.FormatInt(time.Now().Add(-time.Hour).UnixNano(), 10)
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+	}{
+		{name: "no signature"},
+		{name: "wrong signature", headers: map[string]string{
+			timestampHeader: strconv.FormatInt(time.Now().UnixNano(), 10),
+			nonceHeader:     "nonce-1",
+			signatureHeader: "00",
+		}},
+		{name: "stale timestamp", headers: map[string]string{
+			timestampHeader: stale,
+			nonceHeader:     "nonce-2",
+			signatureHeader: sign([]byte(testSecret), "request", http.MethodPost, "/cluster/heartbeat", stale, "nonce-2", bodyHash(nil)),
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/cluster/heartbeat", nil)
+			for header, value := range tt.headers {
+				req.Header.Set(header, value)
+			}
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatalf("sending request: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusUnauthorized {
+				t.Errorf("status = %d, want 401", resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestClusterAuthFailsClosedWithoutSecret(t *testing.T) {
+	app := newAuthTestApp(t)
+	t.Setenv("CLUSTER_SECRET", "")
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodPost, "/cluster/heartbeat", nil), -1)
+	if err != nil {
+		t.Fatalf("sending request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("status = %d, want 401", resp.StatusCode)
+	}
+
+	transport := signingTransport{base: roundTripperFunc(func(*http.Request) (*http.Response, error) {
+		t.Fatal("request sent without a secret")
+		return nil, nil
+	})}
+	if _, err := transport.RoundTrip(outgoingRequest(t, "")); err == nil {
+		t.Error("signing without a secret succeeded")
+	}
+}
+
+func TestVerifyResponseRejectsTamperedResponse(t *testing.T) {
+	app := newAuthTestApp(t)
+
+	transport := signingTransport{base: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			return nil, err
+		}
+		resp.Body.Close()
+		resp.Body = io.NopCloser(strings.NewReader(`{"term":99}`))
+		return resp, nil
+	})}
+
+	if resp, err := transport.RoundTrip(outgoingRequest(t, `{"term":1}`)); err == nil {
+		resp.Body.Close()
+		t.Error("tampered response was accepted")
+	}
+}
@@ -0,0 +1,138 @@
+package cluster
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// compactionBatchSize es cuántas entradas se borran por sentencia, para no retener el
+// lock de escritura de SQLite mientras se compacta un log grande
+const compactionBatchSize = 1000
+
+// logCompactionInterval retorna cada cuánto se compacta el log de replicación
+func logCompactionInterval() time.Duration {
+	return envDuration("CLUSTER_LOG_COMPACT_INTERVAL", time.Minute)
+}
+
+// logRetention retorna cuántas entradas recientes conserva siempre el log, para que un
+// seguidor que se atrasa un poco se ponga al día sin descargar un snapshot
+func logRetention() uint64 {
+	retain := envInt("CLUSTER_LOG_RETAIN", 10000)
+	if retain < 1 {
+		retain = 10000
+	}
+	return uint64(retain)
+}
+
+// startLogCompaction borra periódicamente las entradas antiguas del log de replicación
+func (cs *ClusterState) startLogCompaction() {
+	ticker := time.NewTicker(logCompactionInterval())
+	go func() {
+		for range ticker.C {
+			if err := cs.compactLog(); err != nil {
+				slog.Warn("Error compacting replication log", "error", err)
+			}
+		}
+	}()
+}
+
+// compactLog borra las entradas anteriores al punto de compactación. Cualquier snapshot
+// creado desde entonces las incluye: se crea a partir de la base de datos actual, que
+// ya tiene aplicados sus cambios, así que un seguidor que las necesite se sincroniza
+// con un snapshot.
+func (cs *ClusterState) compactLog() error {
+	cs.mu.RLock()
+	db := cs.db
+	isLeader := cs.CurrentRole == Leader
+	shared := cs.sharedDatabase
+	cs.mu.RUnlock()
+
+	// Con una base de datos compartida el log es uno solo: lo compacta el líder
+	if db == nil || (shared && !isLeader) {
+		return nil
+	}
+
+	lastIndex, _, err := lastLogEntry(db)
+	if err != nil {
+		return err
+	}
+	cutoff := cs.compactionPoint(lastIndex)
+
+	first, err := firstLogIndex(db)
+	if err != nil || first == 0 || first >= cutoff {
+		return err
+	}
+
+	removed := int64(0)
+	for first < cutoff {
+		upTo := min(first+compactionBatchSize, cutoff)
+
+		// No compactar mientras se reemplaza la base de datos con un snapshot
+		cs.applyMu.Lock()
+		result := db.Where("log_index < ?", upTo).Delete(&ReplicationLogEntry{})
+		cs.applyMu.Unlock()
+		if result.Error != nil {
+			return fmt.Errorf("error compacting replication log: %v", result.Error)
+		}
+
+		removed += result.RowsAffected
+		first = upTo
+	}
+
+	slog.Info("Compacted replication log", "removed", removed, "first_index", cutoff, "last_index", lastIndex)
+	return nil
+}
+
+// compactionPoint retorna la primera entrada que debe conservar el log: se conservan
+// las últimas logRetention entradas y, en el líder, todas las que algún seguidor
+// disponible todavía no confirmó. La entrada en el punto de compactación se conserva:
+// su término permite continuar al seguidor que la tiene aplicada. Un seguidor caído no
+// retiene el log; si vuelve detrás de este punto se sincroniza con un snapshot.
+func (cs *ClusterState) compactionPoint(lastIndex uint64) uint64 {
+	retain := logRetention()
+	if lastIndex <= retain {
+		return 0
+	}
+	cutoff := lastIndex - retain
+
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	if cs.CurrentRole != Leader || cs.sharedDatabase {
+		return cutoff
+	}
+
+	cs.ackMu.Lock()
+	defer cs.ackMu.Unlock()
+
+	for _, node := range cs.peersUnsafe() {
+		// Sin confirmación no se sabe por dónde va el seguidor
+		cutoff = min(cutoff, cs.matchIndex[node.ID])
+	}
+	return cutoff
+}
+
+// firstLogIndex retorna el índice de la primera entrada que conserva el log (0 si está vacío)
+func firstLogIndex(db *gorm.DB) (uint64, error) {
+	var entry ReplicationLogEntry
+	if err := db.Order("log_index ASC").Limit(1).Find(&entry).Error; err != nil {
+		return 0, fmt.Errorf("error reading replication log: %v", err)
+	}
+	return entry.Index, nil
+}
+
+// logCompacted indica si la compactación ya borró la entrada index del log, de modo
+// que un nodo con las entradas aplicadas hasta index no puede continuar desde el log
+func logCompacted(db *gorm.DB, index uint64) (bool, error) {
+	first, err := firstLogIndex(db)
+	if err != nil {
+		return false, err
+	}
+	if index == 0 {
+		return first > 1, nil
+	}
+	return index < first, nil
+}
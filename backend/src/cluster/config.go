@@ -0,0 +1,38 @@
+package cluster
+
+import (
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+)
+
+// envDuration lee una duración (ej. "5s", "500ms") de una variable de entorno
+func envDuration(name string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		slog.Warn("Invalid configuration value, using default", "name", name, "value", value, "default", defaultValue.String())
+		return defaultValue
+	}
+	return duration
+}
+
+// envInt lee un entero de una variable de entorno
+func envInt(name string, defaultValue int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		slog.Warn("Invalid configuration value, using default", "name", name, "value", value, "default", defaultValue)
+		return defaultValue
+	}
+	return number
+}
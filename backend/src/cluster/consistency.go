@@ -0,0 +1,66 @@
+package cluster
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ReplicationPositionHeader es el header con la posición del log tras una escritura.
+// El líder lo incluye en cada respuesta exitosa de una petición que escribió en el log
+// (con la última entrada que escribió esa petición) y el cliente lo reenvía en sus
+// lecturas para no leer de un seguidor que todavía no aplicó su propia escritura.
+const ReplicationPositionHeader = "X-Replication-Position"
+
+// readWaitTimeout retorna cuánto espera un seguidor a alcanzar la posición pedida
+// antes de reenviar la lectura al líder
+func readWaitTimeout() time.Duration {
+	return envDuration("CLUSTER_READ_WAIT_TIMEOUT", 500*time.Millisecond)
+}
+
+// FormatReplicationPosition convierte un índice del log en el valor del header
+func FormatReplicationPosition(index uint64) string {
+	return strconv.FormatUint(index, 10)
+}
+
+// ParseReplicationPosition lee el índice del log de un header (false si es inválido)
+func ParseReplicationPosition(value string) (uint64, bool) {
+	index, err := strconv.ParseUint(strings.TrimSpace(value), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return index, true
+}
+
+// notifyApplied despierta a las lecturas que esperan nuevas entradas aplicadas
+func (cs *ClusterState) notifyApplied() {
+	cs.appliedMu.Lock()
+	defer cs.appliedMu.Unlock()
+
+	close(cs.appliedCh)
+	cs.appliedCh = make(chan struct{})
+}
+
+// WaitForApplied bloquea hasta que el nodo haya aplicado la entrada index o hasta que
+// se agote el timeout, y retorna si la alcanzó
+func (cs *ClusterState) WaitForApplied(index uint64, timeout time.Duration) bool {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	for {
+		// Tomar el canal antes de leer el log para no perder una notificación
+		cs.appliedMu.Lock()
+		changed := cs.appliedCh
+		cs.appliedMu.Unlock()
+
+		if db := cs.getDB(); db != nil && LastLogIndex(db) >= index {
+			return true
+		}
+
+		select {
+		case <-changed:
+		case <-deadline.C:
+			return false
+		}
+	}
+}
@@ -0,0 +1,287 @@
+package cluster
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PeerAddress es la dirección de un nodo encontrado por un Discoverer
+type PeerAddress struct {
+	Host string
+	Port int
+}
+
+// String retorna la dirección en formato host:puerto
+func (p PeerAddress) String() string {
+	return net.JoinHostPort(p.Host, strconv.Itoa(p.Port))
+}
+
+// Discoverer encuentra las direcciones de los nodos del cluster (incluido el actual)
+type Discoverer interface {
+	Name() string
+	Discover() ([]PeerAddress, error)
+}
+
+// WatchingDiscoverer es un Discoverer que puede avisar cuando cambia la lista de nodos
+// sin esperar al siguiente ciclo de descubrimiento
+type WatchingDiscoverer interface {
+	Discoverer
+	Watch(onChange func())
+}
+
+// listenPort retorna el puerto en el que escucha este nodo (PORT, 3000 por defecto)
+func listenPort() int {
+	return envInt("PORT", 3000)
+}
+
+// clusterPort retorna el puerto de los nodos encontrados por DNS o escaneo, que no
+// incluyen puerto (CLUSTER_PORT, por defecto el mismo puerto que este nodo: el de TLS
+// si está configurado)
+func clusterPort() int {
+	return envInt("CLUSTER_PORT", nodePort())
+}
+
+// discoveryInterval retorna cada cuánto se vuelve a descubrir el cluster
+func discoveryInterval() time.Duration {
+	return envDuration("CLUSTER_DISCOVERY_INTERVAL", 30*time.Second)
+}
+
+// discovererFromEnv elige el método de descubrimiento según CLUSTER_DISCOVERY
+// (static, file, dns o scan). Sin valor se usa CLUSTER_PEERS o CLUSTER_PEERS_FILE si
+// están definidos y, si no, DNS del servicio con escaneo de red como alternativa.
+func discovererFromEnv(serviceName string) Discoverer {
+	peers := os.Getenv("CLUSTER_PEERS")
+	peersFile := os.Getenv("CLUSTER_PEERS_FILE")
+	port := clusterPort()
+
+	switch method := strings.ToLower(os.Getenv("CLUSTER_DISCOVERY")); method {
+	case "static":
+		return &staticDiscoverer{peers: peers, port: port}
+	case "file":
+		return &fileDiscoverer{path: peersFile, port: port}
+	case "dns":
+		return &dnsDiscoverer{serviceName: serviceName, port: port}
+	case "scan":
+		return &scanDiscoverer{port: port}
+	case "":
+	default:
+		slog.Warn("Invalid CLUSTER_DISCOVERY, choosing discovery method automatically", "value", method)
+	}
+
+	if peers != "" {
+		return &staticDiscoverer{peers: peers, port: port}
+	}
+	if peersFile != "" {
+		return &fileDiscoverer{path: peersFile, port: port}
+	}
+	return &fallbackDiscoverer{
+		primary:  &dnsDiscoverer{serviceName: serviceName, port: port},
+		fallback: &scanDiscoverer{port: port},
+	}
+}
+
+// parsePeerList lee una lista de nodos separados por comas, espacios o saltos de línea.
+// Cada nodo es host o host:puerto (con http:// o https:// opcional); lo que sigue a # es un comentario.
+func parsePeerList(list string, defaultPort int) ([]PeerAddress, error) {
+	var peers []PeerAddress
+
+	for _, line := range strings.Split(list, "\n") {
+		if comment := strings.Index(line, "#"); comment >= 0 {
+			line = line[:comment]
+		}
+
+		fields := strings.FieldsFunc(line, func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t' || r == '\r'
+		})
+		for _, field := range fields {
+			peer, err := parsePeer(field, defaultPort)
+			if err != nil {
+				return nil, err
+			}
+			peers = append(peers, peer)
+		}
+	}
+
+	return peers, nil
+}
+
+// parsePeer convierte host o host:puerto en una PeerAddress
+func parsePeer(value string, defaultPort int) (PeerAddress, error) {
+	value = strings.TrimPrefix(value, "http://")
+	value = strings.TrimPrefix(value, "https://")
+	value = strings.TrimSuffix(value, "/")
+
+	host, portStr, err := net.SplitHostPort(value)
+	if err != nil {
+		// Sin puerto
+		return PeerAddress{Host: strings.Trim(value, "[]"), Port: defaultPort}, nil
+	}
+
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port <= 0 || port > 65535 {
+		return PeerAddress{}, fmt.Errorf("invalid port in peer %q", value)
+	}
+	return PeerAddress{Host: host, Port: port}, nil
+}
+
+// staticDiscoverer usa la lista fija de nodos de CLUSTER_PEERS
+type staticDiscoverer struct {
+	peers string
+	port  int
+}
+
+func (d *staticDiscoverer) Name() string {
+	return "static"
+}
+
+func (d *staticDiscoverer) Discover() ([]PeerAddress, error) {
+	peers, err := parsePeerList(d.peers, d.port)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CLUSTER_PEERS: %v", err)
+	}
+	if len(peers) == 0 {
+		return nil, fmt.Errorf("CLUSTER_PEERS is empty")
+	}
+	return peers, nil
+}
+
+// fileDiscoverer lee los nodos de un archivo (un nodo por línea) y lo vigila
+// para aplicar los cambios sin reiniciar
+type fileDiscoverer struct {
+	path string
+	port int
+}
+
+func (d *fileDiscoverer) Name() string {
+	return "file"
+}
+
+func (d *fileDiscoverer) Discover() ([]PeerAddress, error) {
+	if d.path == "" {
+		return nil, fmt.Errorf("CLUSTER_PEERS_FILE is not set")
+	}
+
+	data, err := os.ReadFile(d.path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading peers file: %v", err)
+	}
+
+	peers, err := parsePeerList(string(data), d.port)
+	if err != nil {
+		return nil, fmt.Errorf("invalid peers file %s: %v", d.path, err)
+	}
+	if len(peers) == 0 {
+		return nil, fmt.Errorf("peers file %s is empty", d.path)
+	}
+	return peers, nil
+}
+
+// Watch revisa periódicamente la fecha y el tamaño del archivo y llama a onChange
+// cuando cambian (se consulta en lugar de usar notificaciones del sistema de archivos
+// para que funcione también con volúmenes montados y ConfigMaps)
+func (d *fileDiscoverer) Watch(onChange func()) {
+	var lastModTime time.Time
+	var lastSize int64
+	if info, err := os.Stat(d.path); err == nil {
+		lastModTime, lastSize = info.ModTime(), info.Size()
+	}
+
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		info, err := os.Stat(d.path)
+		if err != nil {
+			continue
+		}
+		if info.ModTime().Equal(lastModTime) && info.Size() == lastSize {
+			continue
+		}
+
+		lastModTime, lastSize = info.ModTime(), info.Size()
+		slog.Info("Peers file changed, rediscovering nodes", "path", d.path)
+		onChange()
+	}
+}
+
+// dnsDiscoverer resuelve el nombre del servicio (Docker Swarm crea un registro DNS
+// con la IP de cada réplica para el alias de red)
+type dnsDiscoverer struct {
+	serviceName string
+	port        int
+}
+
+func (d *dnsDiscoverer) Name() string {
+	return "dns"
+}
+
+func (d *dnsDiscoverer) Discover() ([]PeerAddress, error) {
+	ips, err := net.LookupIP(d.serviceName)
+	if err != nil {
+		return nil, fmt.Errorf("DNS lookup failed for service %s: %v", d.serviceName, err)
+	}
+
+	peers := make([]PeerAddress, 0, len(ips))
+	for _, ip := range ips {
+		peers = append(peers, PeerAddress{Host: ip.String(), Port: d.port})
+	}
+	return peers, nil
+}
+
+// scanDiscoverer escanea la red del nodo (SWARM_NETWORK_SUBNET o la /24 de la IP
+// actual) buscando nodos que respondan en /cluster/status
+type scanDiscoverer struct {
+	port int
+}
+
+func (d *scanDiscoverer) Name() string {
+	return "scan"
+}
+
+func (d *scanDiscoverer) Discover() ([]PeerAddress, error) {
+	currentIP, err := getCurrentIP()
+	if err != nil {
+		return nil, fmt.Errorf("error getting current IP: %v", err)
+	}
+
+	ips, err := scanNetworkRange(currentIP, d.port)
+	if err != nil {
+		return nil, err
+	}
+
+	peers := make([]PeerAddress, 0, len(ips))
+	for _, ip := range ips {
+		peers = append(peers, PeerAddress{Host: ip, Port: d.port})
+	}
+	return peers, nil
+}
+
+// fallbackDiscoverer usa un método alternativo cuando falla el principal
+type fallbackDiscoverer struct {
+	primary  Discoverer
+	fallback Discoverer
+}
+
+func (d *fallbackDiscoverer) Name() string {
+	return d.primary.Name() + "+" + d.fallback.Name()
+}
+
+func (d *fallbackDiscoverer) Discover() ([]PeerAddress, error) {
+	peers, err := d.primary.Discover()
+	if err == nil {
+		return peers, nil
+	}
+
+	slog.Warn("Discovery failed, falling back", "discovery", d.primary.Name(), "fallback", d.fallback.Name(), "error", err)
+
+	peers, fallbackErr := d.fallback.Discover()
+	if fallbackErr != nil {
+		return nil, fmt.Errorf("both %s and %s discovery failed: %v; %v", d.primary.Name(), d.fallback.Name(), err, fallbackErr)
+	}
+	return peers, nil
+}
@@ -3,21 +3,19 @@ package cluster
 import (
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net"
 	"net/http"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
-// DiscoverNodes usa DNS lookup para descubrir todos los nodos del servicio backend
-// Si el DNS falla, escanea el rango de IPs del Swarm network
+// DiscoverNodes obtiene las direcciones de los nodos con el Discoverer configurado
+// (lista estática, archivo, DNS del servicio o escaneo de red) y actualiza el mapa de nodos
 func (cs *ClusterState) DiscoverNodes() error {
-	cs.mu.Lock()
-	defer cs.mu.Unlock()
-
 	// Obtener el hostname actual del contenedor
 	hostname, err := os.Hostname()
 	if err != nil {
@@ -30,89 +28,211 @@ func (cs *ClusterState) DiscoverNodes() error {
 		return fmt.Errorf("error getting current IP: %v", err)
 	}
 
-	log.Printf("Current node hostname: %s, IP: %s", hostname, currentIP)
+	slog.Debug("Current node", "hostname", hostname, "ip", currentIP, "port", nodePort())
 
-	// Realizar DNS lookup del servicio backend
-	// Docker Swarm crea un registro DNS para el alias de red
-	ips, err := net.LookupIP(cs.ServiceName)
+	// Descubrir sin el lock: el escaneo de red puede tardar varios segundos
+	peers, err := cs.Discoverer.Discover()
+	if err != nil {
+		return fmt.Errorf("%s discovery failed: %v", cs.Discoverer.Name(), err)
+	}
+	slog.Debug("Discovered nodes", "count", len(peers), "discovery", cs.Discoverer.Name())
 
-	var discoveredIPs []string
+	// Consultar el ID de cada nodo (también sin el lock)
+	discovered := identifyPeers(peers, cs.GetCurrentNodeID())
 
-	if err != nil {
-		log.Printf("DNS lookup failed for service %s: %v", cs.ServiceName, err)
-		log.Println("Falling back to IP range scanning...")
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
 
-		// Fallback: escanear el rango de IPs del Swarm network
-		discoveredIPs, err = cs.scanNetworkRange(currentIP)
-		if err != nil {
-			return fmt.Errorf("both DNS lookup and IP scanning failed: %v", err)
-		}
-		log.Printf("Discovered %d nodes via IP scanning", len(discoveredIPs))
-	} else {
-		// Convertir net.IP a strings
-		for _, ip := range ips {
-			discoveredIPs = append(discoveredIPs, ip.String())
+	// Actualizar o crear nodos descubiertos. El estado de los nodos ya conocidos lo
+	// decide el gossip: un nodo que no respondió aquí se mantiene como esté.
+	cs.unidentifiedPeers = nil
+	for _, peer := range discovered {
+		if peer.id == "" {
+			if cs.nodeByAddressUnsafe(peer.address) == nil {
+				cs.unidentifiedPeers = append(cs.unidentifiedPeers, peer.address)
+			}
+			continue
 		}
-		log.Printf("Discovered %d nodes via DNS", len(discoveredIPs))
+		cs.upsertNodeUnsafe(peer.id, peer.address)
 	}
 
-	// Marcar todos los nodos existentes como no vistos
-	for _, node := range cs.Nodes {
-		node.IsHealthy = false
-	}
-
-	// Actualizar o crear nodos descubiertos
-	for _, ipStr := range discoveredIPs {
-		// Generar ID basado en la IP (último octeto como base)
-		nodeID := generateNodeIDFromIP(ipStr)
-
-		if existingNode, exists := cs.Nodes[nodeID]; exists {
-			// Actualizar nodo existente
-			existingNode.LastSeen = time.Now()
-			existingNode.IsHealthy = true
-			log.Printf("Updated existing node: ID=%d, IP=%s", nodeID, ipStr)
-		} else {
-			// Crear nuevo nodo
-			newNode := &Node{
-				ID:        nodeID,
-				Address:   fmt.Sprintf("http://%s:3000", ipStr),
-				Role:      Follower,
-				LastSeen:  time.Now(),
-				IsHealthy: true,
+	// El nodo actual siempre forma parte del cluster aunque el Discoverer no lo
+	// encuentre (por ejemplo, al escanear la red antes de empezar a escuchar)
+	if _, exists := cs.Nodes[cs.CurrentNodeID]; !exists {
+		cs.upsertNodeUnsafe(cs.CurrentNodeID, fmt.Sprintf("%s://%s", nodeScheme(), PeerAddress{Host: currentIP, Port: nodePort()}))
+	}
+
+	// Con más nodos que votos en CLUSTER_SIZE dos grupos podrían formar mayoría a la vez
+	if len(cs.Nodes) > cs.clusterSize {
+		slog.Warn("More nodes than CLUSTER_SIZE, update it on every node", "nodes", len(cs.Nodes), "cluster_size", cs.clusterSize)
+	}
+
+	return nil
+}
+
+// discoveredNode es una dirección encontrada por el Discoverer y el ID del nodo que
+// responde en ella ("" si no respondió)
+type discoveredNode struct {
+	id      string
+	address string
+}
+
+// identifyPeers consulta en paralelo /cluster/status de cada dirección para conocer
+// el ID persistente del nodo. Las direcciones locales con el puerto propio son este nodo.
+func identifyPeers(peers []PeerAddress, currentNodeID string) []discoveredNode {
+	discovered := make([]discoveredNode, len(peers))
+
+	var wg sync.WaitGroup
+	for i, peer := range peers {
+		discovered[i].address = fmt.Sprintf("%s://%s", nodeScheme(), peer)
+
+		wg.Add(1)
+		go func(i int, peer PeerAddress) {
+			defer wg.Done()
+
+			if ip, err := resolvePeerIP(peer.Host); err == nil && peer.Port == nodePort() && isLocalIP(ip) {
+				discovered[i].id = currentNodeID
+				return
+			}
+
+			nodeID, err := fetchNodeID(discovered[i].address)
+			if err != nil {
+				slog.Warn("Could not identify node", "address", discovered[i].address, "error", err)
+				return
 			}
-			cs.Nodes[nodeID] = newNode
-			log.Printf("Discovered new node: ID=%d, IP=%s", nodeID, ipStr)
+			discovered[i].id = nodeID
+		}(i, peer)
+	}
+	wg.Wait()
+
+	return discovered
+}
+
+// fetchNodeID obtiene el ID de un nodo a partir de su endpoint /cluster/status
+func fetchNodeID(address string) (string, error) {
+	resp, err := clusterClient.Get(address + "/cluster/status")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("status request failed with status: %d", resp.StatusCode)
+	}
+
+	var status struct {
+		CurrentNodeID string `json:"current_node_id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return "", fmt.Errorf("error decoding status: %v", err)
+	}
+	if status.CurrentNodeID == "" {
+		return "", fmt.Errorf("node did not report its id")
+	}
+
+	return status.CurrentNodeID, nil
+}
+
+// upsertNodeUnsafe registra o refresca un nodo que respondió directamente, así que
+// vuelve a estar vivo. Si otro ID ocupaba la misma dirección (el nodo se recreó con
+// otro directorio de datos), se descarta el anterior.
+func (cs *ClusterState) upsertNodeUnsafe(nodeID, address string) {
+	for id, node := range cs.Nodes {
+		if id != nodeID && node.Address == address {
+			slog.Info("Node changed ID", "address", address, "old_id", id, "node_id", nodeID)
+			delete(cs.Nodes, id)
 		}
+	}
 
-		// Si esta IP es la del nodo actual, establecer el ID actual
-		if ipStr == currentIP {
-			cs.CurrentNodeID = nodeID
-			log.Printf("Current node ID set to: %d", nodeID)
+	if existingNode, exists := cs.Nodes[nodeID]; exists {
+		// Actualizar nodo existente
+		if existingNode.Address != address {
+			slog.Info("Node changed address", "node_id", nodeID, "old_address", existingNode.Address, "address", address)
 		}
+		existingNode.Address = address
+		existingNode.LastSeen = time.Now()
+		if existingNode.State != MemberAlive {
+			cs.setStateUnsafe(existingNode, MemberAlive)
+		}
+		return
 	}
 
-	// Eliminar nodos que no se han visto recientemente (más de 30 segundos)
-	cs.cleanupStaleNodes()
+	// Crear nuevo nodo
+	newNode := &Node{
+		ID:           nodeID,
+		Address:      address,
+		Role:         Follower,
+		LastSeen:     time.Now(),
+		State:        MemberAlive,
+		StateChanged: time.Now(),
+	}
+	cs.Nodes[nodeID] = newNode
+	slog.Info("Discovered new node", "node_id", nodeID, "address", address)
 
+	// Anunciar el nodo nuevo al resto del cluster
+	if nodeID != cs.CurrentNodeID {
+		cs.enqueueUpdateUnsafe(cs.memberUpdateUnsafe(newNode))
+	}
+}
+
+// hasUnidentifiedPeers indica si quedan direcciones descubiertas sin ID conocido
+func (cs *ClusterState) hasUnidentifiedPeers() bool {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	return len(cs.unidentifiedPeers) > 0
+}
+
+// nodeByAddressUnsafe busca un nodo conocido por su dirección (usar solo con lock)
+func (cs *ClusterState) nodeByAddressUnsafe(address string) *Node {
+	for _, node := range cs.Nodes {
+		if node.Address == address {
+			return node
+		}
+	}
 	return nil
 }
 
-// generateNodeIDFromIP genera un ID único basado en la dirección IP
-func generateNodeIDFromIP(ip string) int {
-	parts := strings.Split(ip, ".")
-	if len(parts) != 4 {
-		// Si no es IPv4, usar hash del string
-		hash := 0
-		for _, ch := range ip {
-			hash = hash*31 + int(ch)
+// resolvePeerIP retorna la IP de un host (los nombres se resuelven por DNS)
+func resolvePeerIP(host string) (string, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String(), nil
+	}
+
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return "", fmt.Errorf("error resolving %s: %v", host, err)
+	}
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			return ip.String(), nil
 		}
-		return hash % 10000
 	}
+	if len(ips) == 0 {
+		return "", fmt.Errorf("no addresses found for %s", host)
+	}
+	return ips[0].String(), nil
+}
 
-	// Usar los últimos dos octetos para crear un ID único
-	thirdOctet, _ := strconv.Atoi(parts[2])
-	fourthOctet, _ := strconv.Atoi(parts[3])
-	return thirdOctet*256 + fourthOctet
+// isLocalIP verifica si la IP pertenece a una interfaz de este host
+func isLocalIP(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	if parsed.IsLoopback() {
+		return true
+	}
+
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+	for _, addr := range addrs {
+		if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.Equal(parsed) {
+			return true
+		}
+	}
+	return false
 }
 
 // getCurrentIP obtiene la IP del contenedor actual
@@ -133,17 +253,6 @@ func getCurrentIP() (string, error) {
 	return "", fmt.Errorf("no valid IP address found")
 }
 
-// cleanupStaleNodes elimina nodos que no han sido vistos recientemente
-func (cs *ClusterState) cleanupStaleNodes() {
-	cutoff := time.Now().Add(-30 * time.Second)
-	for id, node := range cs.Nodes {
-		if node.LastSeen.Before(cutoff) {
-			log.Printf("Removing stale node: ID=%d", id)
-			delete(cs.Nodes, id)
-		}
-	}
-}
-
 // GetAllNodes retorna una lista ordenada de todos los nodos por ID
 func (cs *ClusterState) GetAllNodes() []*Node {
 	cs.mu.RLock()
@@ -151,7 +260,7 @@ func (cs *ClusterState) GetAllNodes() []*Node {
 
 	nodes := make([]*Node, 0, len(cs.Nodes))
 	for _, node := range cs.Nodes {
-		if node.IsHealthy {
+		if node.IsHealthy() {
 			nodes = append(nodes, node)
 		}
 	}
@@ -170,13 +279,13 @@ func (cs *ClusterState) GetAllNodes() []*Node {
 
 // scanNetworkRange escanea el rango de IPs especificado en las variables de entorno
 // para encontrar nodos healthy del cluster
-func (cs *ClusterState) scanNetworkRange(currentIP string) ([]string, error) {
+func scanNetworkRange(currentIP string, port int) ([]string, error) {
 	// Obtener el rango de red de las variables de entorno
 	networkSubnet := os.Getenv("SWARM_NETWORK_SUBNET")
 	if networkSubnet == "" {
 		// Si no está definido, intentar inferir del IP actual
 		networkSubnet = inferSubnetFromIP(currentIP)
-		log.Printf("SWARM_NETWORK_SUBNET not set, inferred: %s", networkSubnet)
+		slog.Info("SWARM_NETWORK_SUBNET not set, inferred subnet", "subnet", networkSubnet)
 	}
 
 	// Parsear CIDR
@@ -185,7 +294,7 @@ func (cs *ClusterState) scanNetworkRange(currentIP string) ([]string, error) {
 		return nil, fmt.Errorf("invalid network subnet %s: %v", networkSubnet, err)
 	}
 
-	log.Printf("Scanning network range: %s", networkSubnet)
+	slog.Debug("Scanning network range", "subnet", networkSubnet)
 
 	// Generar lista de IPs a escanear
 	ipsToScan := generateIPsFromCIDR(ipNet)
@@ -193,11 +302,11 @@ func (cs *ClusterState) scanNetworkRange(currentIP string) ([]string, error) {
 	// Limitar el número de IPs a escanear (evitar escaneos masivos)
 	maxIPs := 254
 	if len(ipsToScan) > maxIPs {
-		log.Printf("Network range too large (%d IPs), limiting to %d", len(ipsToScan), maxIPs)
+		slog.Warn("Network range too large, limiting scan", "ips", len(ipsToScan), "limit", maxIPs)
 		ipsToScan = ipsToScan[:maxIPs]
 	}
 
-	log.Printf("Scanning %d IP addresses for healthy nodes...", len(ipsToScan))
+	slog.Debug("Scanning IP addresses for healthy nodes", "ips", len(ipsToScan))
 
 	// Canal para resultados de escaneo
 	results := make(chan string, len(ipsToScan))
@@ -211,7 +320,7 @@ func (cs *ClusterState) scanNetworkRange(currentIP string) ([]string, error) {
 			semaphore <- struct{}{}        // Adquirir semáforo
 			defer func() { <-semaphore }() // Liberar semáforo
 
-			if isNodeHealthy(ipAddr) {
+			if isNodeHealthy(ipAddr, port) {
 				results <- ipAddr
 			}
 		}(ip)
@@ -226,10 +335,10 @@ func (cs *ClusterState) scanNetworkRange(currentIP string) ([]string, error) {
 		case ip := <-results:
 			if ip != "" {
 				healthyIPs = append(healthyIPs, ip)
-				log.Printf("Found healthy node at: %s", ip)
+				slog.Debug("Found healthy node", "ip", ip)
 			}
 		case <-timeout:
-			log.Printf("Scan timeout reached, found %d healthy nodes", len(healthyIPs))
+			slog.Warn("Scan timeout reached", "healthy_nodes", len(healthyIPs))
 			return healthyIPs, nil
 		}
 	}
@@ -296,14 +405,13 @@ func isNetworkOrBroadcast(ip net.IP, ipNet *net.IPNet) bool {
 	return ip.Equal(broadcast)
 }
 
-// isNodeHealthy verifica si un nodo en la IP dada está healthy
-// intentando conectarse al endpoint /cluster/status
-func isNodeHealthy(ip string) bool {
-	url := fmt.Sprintf("http://%s:3000/cluster/status", ip)
+// isNodeHealthy verifica si un nodo en la IP y puerto dados está healthy
+// intentando conectarse al endpoint /cluster/status. Solo se aceptan respuestas
+// firmadas con CLUSTER_SECRET, así otro servicio de la red no puede hacerse pasar por un nodo.
+func isNodeHealthy(ip string, port int) bool {
+	url := fmt.Sprintf("%s://%s/cluster/status", nodeScheme(), net.JoinHostPort(ip, strconv.Itoa(port)))
 
-	client := &http.Client{
-		Timeout: 2 * time.Second, // Timeout corto para escaneo rápido
-	}
+	client := newClusterClient(2 * time.Second) // Timeout corto para escaneo rápido
 
 	resp, err := client.Get(url)
 	if err != nil {
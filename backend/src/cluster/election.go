@@ -1,121 +1,602 @@
 package cluster
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
-	"strings"
+	"log/slog"
+	"math/rand"
+	"os"
+	"strconv"
 	"time"
 
 	"gorm.io/gorm"
 )
 
-// ElectLeader selecciona el líder basándose en el ID más bajo
-func (cs *ClusterState) ElectLeader(db *gorm.DB) {
-	cs.mu.Lock()
-	defer cs.mu.Unlock()
+// clusterClient es el cliente HTTP usado para los mensajes de elección
+var clusterClient = newClusterClient(2 * time.Second)
+
+// heartbeatInterval retorna cada cuánto el líder envía heartbeats
+func heartbeatInterval() time.Duration {
+	return envDuration("CLUSTER_HEARTBEAT_INTERVAL", 1*time.Second)
+}
 
-	// Obtener todos los nodos saludables ordenados por ID (aescendente)
-	nodes := cs.getAllNodesUnsafe()
+// baseElectionTimeout retorna el timeout mínimo sin heartbeats antes de iniciar una elección
+func baseElectionTimeout() time.Duration {
+	return envDuration("CLUSTER_ELECTION_TIMEOUT", 5*time.Second)
+}
+
+// randomElectionTimeout retorna un timeout aleatorio entre [base, 2*base) para evitar
+// que varios nodos inicien elecciones a la vez
+func randomElectionTimeout() time.Duration {
+	base := baseElectionTimeout()
+	return base + time.Duration(rand.Int63n(int64(base)))
+}
 
-	if len(nodes) == 0 {
-		log.Println("No healthy nodes found for leader election")
+// ElectLeader inicia una elección si el nodo no ha recibido heartbeats del líder
+// dentro de su timeout de elección
+func (cs *ClusterState) ElectLeader() {
+	cs.mu.RLock()
+	role := cs.CurrentRole
+	elapsed := time.Since(cs.timerReset)
+	timeout := cs.electionTimeout
+	ineligible := cs.shuttingDown || cs.maintenance || cs.schemaOutdatedUnsafe()
+	cs.mu.RUnlock()
+
+	// Un nodo que se está apagando, en mantenimiento o con un binario anterior al
+	// esquema de la base de datos no debe ser líder
+	if role == Leader || elapsed < timeout || ineligible {
+		return
+	}
+
+	// Los votantes solo aceptan candidatos con un log al menos tan actualizado
+	// como el suyo, así un nodo con la DB vacía no puede ganar frente a uno con datos
+	lastLogIndex, lastLogTerm, err := lastLogEntry(cs.getDB())
+	if err != nil {
+		slog.Warn("Cannot start election", "error", err)
 		return
 	}
 
-	// El nodo con el ID más bajo es el líder
-	newLeaderID := nodes[0].ID
-	newLeaderAddress := nodes[0].Address
+	cs.runElection(lastLogIndex, lastLogTerm, false)
+}
 
-	// CASO ESPECIAL: Si este nodo sería el nuevo líder, verificar si es nuevo (DB vacía)
-	if cs.CurrentNodeID == newLeaderID && len(nodes) > 1 {
-		// Verificar si la base de datos está vacía
-		var userCount int64
-		if db != nil {
-			db.Table("users").Count(&userCount)
-		}
+// runElection incrementa el término, vota por sí mismo y solicita votos al resto de nodos.
+// transfer indica que el líder cedió el liderazgo a este nodo.
+func (cs *ClusterState) runElection(lastLogIndex, lastLogTerm uint64, transfer bool) {
+	cs.mu.Lock()
+	cs.CurrentTerm++
+	cs.VotedFor = cs.CurrentNodeID
+	cs.CurrentRole = Candidate
+	cs.timerReset = time.Now()
+	cs.electionTimeout = randomElectionTimeout()
+
+	// Un voto que no se puede persistir no cuenta: se podría votar dos veces tras un reinicio
+	if err := cs.persistStateUnsafe(); err != nil {
+		slog.Error("Error persisting term, aborting election", "term", cs.CurrentTerm, "error", err)
+		cs.CurrentRole = Follower
+		cs.mu.Unlock()
+		return
+	}
 
-		// Si este nodo tiene DB vacía y hay otros nodos, necesita sincronizar primero
-		if userCount == 0 {
-			log.Println("⚠️  WARNING: This node would become leader but has empty database")
-			log.Printf("   Found %d other nodes in the network", len(nodes)-1)
+	term := cs.CurrentTerm
+	quorum := cs.quorumSizeUnsafe()
+	peers := cs.membersUnsafe()
+	request := VoteRequest{
+		Term:               term,
+		CandidateID:        cs.CurrentNodeID,
+		CandidateAddress:   cs.selfAddressUnsafe(),
+		LastLogIndex:       lastLogIndex,
+		LastLogTerm:        lastLogTerm,
+		SchemaVersion:      cs.codeSchemaVersion,
+		LeadershipTransfer: transfer,
+	}
+	cs.mu.Unlock()
 
-			// Identificar al segundo nodo (el que sería líder si este no existiera)
-			var previousLeaderNode *Node
-			if len(nodes) > 1 {
-				previousLeaderNode = nodes[1]
+	slog.Info("Starting election", "term", term, "peers", len(peers), "quorum", quorum)
+
+	votes := 1 // Voto propio
+	if votes >= quorum {
+		cs.becomeLeader(term)
+		return
+	}
+
+	// Solicitar votos en paralelo
+	responses := make(chan VoteResponse, len(peers))
+	for _, peer := range peers {
+		go func(node *Node) {
+			var response VoteResponse
+			if _, err := postJSON(node.Address+"/cluster/vote", request, &response); err != nil {
+				slog.Warn("Failed to request vote", "node_id", node.ID, "error", err)
 			}
+			responses <- response
+		}(peer)
+	}
 
-			if previousLeaderNode != nil {
-				log.Printf("   Previous/Alternative leader: ID=%d, Address=%s", previousLeaderNode.ID, previousLeaderNode.Address)
-				log.Println("   🔄 Syncing with previous leader before taking leadership...")
-
-				// Liberar el lock temporalmente para hacer la sincronización
-				cs.mu.Unlock()
-
-				// Sincronizar con el nodo anterior
-				if err := cs.RequestFullSync(previousLeaderNode.Address); err != nil {
-					log.Printf("   ❌ Failed to sync from previous leader: %v", err)
-					log.Println("   Node will become leader with empty database (this may cause data loss!)")
-				} else {
-					log.Println("   ✅ Successfully synced database from previous leader")
-					// Verificar cuántos usuarios tenemos ahora
-					if db != nil {
-						db.Table("users").Count(&userCount)
-						log.Printf("   Database now has %d users", userCount)
-					}
-				}
-
-				// Re-adquirir el lock
-				cs.mu.Lock()
+	for i := 0; i < len(peers); i++ {
+		response := <-responses
+		if response.Term > term {
+			slog.Info("Found higher term during election, stepping down", "higher_term", response.Term, "term", term)
+			cs.stepDown(response.Term)
+			return
+		}
+		if response.VoteGranted {
+			votes++
+			if votes >= quorum {
+				cs.becomeLeader(term)
+				return
 			}
 		}
 	}
 
+	slog.Info("Election did not reach quorum", "term", term, "votes", votes, "quorum", quorum)
+}
+
+// becomeLeader convierte al candidato en líder si sigue en el mismo término
+func (cs *ClusterState) becomeLeader(term uint64) {
+	cs.mu.Lock()
+	if cs.CurrentTerm != term || cs.CurrentRole != Candidate {
+		cs.mu.Unlock()
+		return
+	}
+
+	oldLeaderID := cs.LeaderID
+	cs.CurrentRole = Leader
+	cs.LeaderID = cs.CurrentNodeID
+	cs.LeaderAddress = cs.selfAddressUnsafe()
+	// El líder está listo salvo que deba aplicar migraciones del esquema antes
+	migrate := cs.codeSchemaVersion > cs.appliedSchemaVersion
+	cs.IsReady = !migrate
+	cs.lastQuorumAck = time.Now()
+	cs.updateNodeRolesUnsafe()
+	cs.syncReplicatorsUnsafe()
+	cs.mu.Unlock()
+
+	leaderChanges.Inc()
+	slog.Info("This node is now the leader", "old_leader_id", oldLeaderID, "node_id", cs.CurrentNodeID, "term", term)
+
+	// Anunciar el liderazgo inmediatamente
+	go cs.sendHeartbeats()
+
+	if migrate {
+		go cs.migrateAsLeader(term)
+	}
+}
 
-	// Verificar si hay cambio de líder
-	if cs.LeaderID != newLeaderID {
-		oldLeaderID := cs.LeaderID
-		cs.LeaderID = newLeaderID
-		cs.LeaderAddress = newLeaderAddress
+// stepDown vuelve a seguidor adoptando el término indicado
+func (cs *ClusterState) stepDown(term uint64) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.stepDownUnsafe(term)
+}
+
+// stepDownUnsafe vuelve a seguidor (usar solo con lock)
+func (cs *ClusterState) stepDownUnsafe(term uint64) {
+	wasLeader := cs.CurrentRole == Leader
+
+	if term > cs.CurrentTerm {
+		cs.CurrentTerm = term
+		cs.VotedFor = ""
+		// En un término nuevo todavía no se conoce al líder
+		cs.LeaderID = ""
+		cs.LeaderAddress = ""
+		if err := cs.persistStateUnsafe(); err != nil {
+			slog.Error("Error persisting term", "term", term, "error", err)
+		}
+	}
 
-		log.Printf("Leader changed: Old=%d, New=%d", oldLeaderID, newLeaderID)
+	cs.CurrentRole = Follower
+	cs.timerReset = time.Now()
 
-		// Actualizar el rol del nodo actual
-		if cs.CurrentNodeID == newLeaderID {
-			cs.CurrentRole = Leader
-			cs.IsReady = true // El líder siempre está listo
-			log.Printf("This node (ID=%d) is now the LEADER", cs.CurrentNodeID)
-		} else {
-			cs.CurrentRole = Follower
-			log.Printf("This node (ID=%d) is now a FOLLOWER. Leader is ID=%d", cs.CurrentNodeID, newLeaderID)
-			// necesita resincronizarse
+	if wasLeader {
+		// Las escrituras no replicadas del antiguo líder se descartan con una resincronización
+		cs.stopReplicatorsUnsafe()
+		cs.LeaderID = ""
+		cs.LeaderAddress = ""
+		// Con una base de datos compartida no hay escrituras propias que descartar
+		if !cs.sharedDatabase {
 			cs.IsReady = false
-			log.Println("Former leader demoted to follower, will request sync")
-			go func() {
-				time.Sleep(5 * time.Second) // Esperar un poco para que el nuevo líder se estabilice
-				if err := cs.RequestFullSync(newLeaderAddress); err != nil {
-					log.Printf("Error syncing after demotion: %v", err)
-				}
-			}()
+			slog.Info("Former leader demoted to follower, will request sync", "term", cs.CurrentTerm)
+		}
+	}
+
+	cs.updateNodeRolesUnsafe()
+}
+
+// HandleVoteRequest procesa una solicitud de voto de un candidato
+func (cs *ClusterState) HandleVoteRequest(request VoteRequest) VoteResponse {
+	lastLogIndex, lastLogTerm, err := lastLogEntry(cs.getDB())
+	if err != nil {
+		slog.Error("Cannot evaluate vote request", "error", err)
+		return VoteResponse{Term: cs.GetCurrentTerm(), VoteGranted: false}
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	// Un nodo que escucha a un líder activo ignora a los candidatos, así un nodo
+	// recién llegado o aislado no puede interrumpir a un líder sano. La excepción es
+	// el candidato al que el propio líder cedió el liderazgo.
+	leaderActive := cs.CurrentRole == Leader || (cs.LeaderID != "" && !cs.leaderDeadUnsafe() && time.Since(cs.lastHeartbeat) < baseElectionTimeout())
+	if leaderActive && !request.LeadershipTransfer {
+		return VoteResponse{Term: cs.CurrentTerm, VoteGranted: false}
+	}
+
+	if request.Term < cs.CurrentTerm {
+		return VoteResponse{Term: cs.CurrentTerm, VoteGranted: false}
+	}
+
+	if request.Term > cs.CurrentTerm {
+		cs.stepDownUnsafe(request.Term)
+	}
+
+	if cs.VotedFor != "" && cs.VotedFor != request.CandidateID {
+		return VoteResponse{Term: cs.CurrentTerm, VoteGranted: false}
+	}
+
+	if node, exists := cs.Nodes[request.CandidateID]; exists {
+		node.SchemaVersion = request.SchemaVersion
+	}
+
+	// El binario del candidato debe conocer el esquema del cluster y las migraciones
+	// que conoce este nodo: un nodo sin actualizar no puede ser líder
+	if minimum := cs.minLeaderSchemaVersionUnsafe(); request.SchemaVersion < minimum {
+		slog.Info("Rejected vote: candidate schema version is older", "candidate_id", request.CandidateID,
+			"candidate_schema_version", request.SchemaVersion, "schema_version", minimum)
+		return VoteResponse{Term: cs.CurrentTerm, VoteGranted: false}
+	}
+
+	// El log del candidato debe estar al menos tan actualizado como el local
+	upToDate := request.LastLogTerm > lastLogTerm ||
+		(request.LastLogTerm == lastLogTerm && request.LastLogIndex >= lastLogIndex)
+	if !upToDate {
+		slog.Info("Rejected vote: candidate log behind local log", "candidate_id", request.CandidateID,
+			"candidate_index", request.LastLogIndex, "candidate_term", request.LastLogTerm,
+			"last_index", lastLogIndex, "last_term", lastLogTerm)
+		return VoteResponse{Term: cs.CurrentTerm, VoteGranted: false}
+	}
+
+	cs.VotedFor = request.CandidateID
+	if err := cs.persistStateUnsafe(); err != nil {
+		slog.Error("Error persisting vote", "candidate_id", request.CandidateID, "error", err)
+		cs.VotedFor = ""
+		return VoteResponse{Term: cs.CurrentTerm, VoteGranted: false}
+	}
+
+	cs.timerReset = time.Now()
+	cs.ensureNodeUnsafe(request.CandidateID, request.CandidateAddress)
+	slog.Info("Voted for candidate", "candidate_id", request.CandidateID, "term", cs.CurrentTerm)
+
+	return VoteResponse{Term: cs.CurrentTerm, VoteGranted: true}
+}
+
+// HandleHeartbeat procesa un heartbeat del líder
+func (cs *ClusterState) HandleHeartbeat(message HeartbeatMessage) HeartbeatResponse {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if message.Term < cs.CurrentTerm {
+		return HeartbeatResponse{Term: cs.CurrentTerm, Success: false}
+	}
+
+	if message.Term > cs.CurrentTerm || cs.CurrentRole != Follower {
+		cs.stepDownUnsafe(message.Term)
+	}
+
+	cs.lastHeartbeat = time.Now()
+	cs.timerReset = cs.lastHeartbeat
+	previousLeaderIndex := cs.leaderLastIndex
+	cs.leaderLastIndex = message.LastIndex
+	cs.ensureNodeUnsafe(message.LeaderID, message.LeaderAddress)
+	if node, exists := cs.Nodes[message.LeaderID]; exists && message.LeaderPublicAddress != "" {
+		node.PublicAddress = message.LeaderPublicAddress
+	}
+
+	if cs.LeaderID != message.LeaderID {
+		slog.Info("Leader changed", "old_leader_id", cs.LeaderID, "leader_id", message.LeaderID, "term", message.Term)
+		leaderChanges.Inc()
+		cs.LeaderID = message.LeaderID
+		cs.LeaderAddress = message.LeaderAddress
+		cs.updateNodeRolesUnsafe()
+	}
+
+	if cs.sharedDatabase {
+		cs.followSharedSchemaUnsafe(message.SchemaVersion)
+	}
+	cs.maybeStartSyncUnsafe()
+	cs.maybeCatchUpUnsafe(previousLeaderIndex)
+
+	return HeartbeatResponse{Term: cs.CurrentTerm, Success: true}
+}
 
+// checkLeaderTerm valida que un mensaje del líder pertenezca al término actual
+// y actualiza el líder conocido si el mensaje trae un término más reciente
+func (cs *ClusterState) checkLeaderTerm(term uint64, leaderID string) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if term < cs.CurrentTerm {
+		return fmt.Errorf("%w: message term %d, current term %d", ErrStaleTerm, term, cs.CurrentTerm)
+	}
+
+	if term == cs.CurrentTerm && cs.CurrentRole == Leader {
+		return fmt.Errorf("leader node should not receive replication messages")
+	}
+
+	if term > cs.CurrentTerm || cs.CurrentRole != Follower {
+		cs.stepDownUnsafe(term)
+	}
+
+	if cs.LeaderID != leaderID {
+		if cs.LeaderID != "" {
+			return fmt.Errorf("replication message from non-leader node: %s (expected: %s)", leaderID, cs.LeaderID)
+		}
+		cs.LeaderID = leaderID
+		leaderChanges.Inc()
+		if node, exists := cs.Nodes[leaderID]; exists {
+			cs.LeaderAddress = node.Address
 		}
+		cs.updateNodeRolesUnsafe()
+	}
 
-		// Actualizar roles en el mapa de nodos
-		for _, node := range cs.Nodes {
-			if node.ID == newLeaderID {
-				node.Role = Leader
-			} else {
-				node.Role = Follower
+	cs.lastHeartbeat = time.Now()
+	cs.timerReset = cs.lastHeartbeat
+	return nil
+}
+
+// sendHeartbeats envía un heartbeat a todos los seguidores y verifica que el líder
+// siga en contacto con la mayoría del cluster
+func (cs *ClusterState) sendHeartbeats() {
+	var lastIndex uint64
+	if db := cs.getDB(); db != nil {
+		lastIndex = LastLogIndex(db)
+	}
+
+	cs.mu.RLock()
+	if cs.CurrentRole != Leader {
+		cs.mu.RUnlock()
+		return
+	}
+	message := HeartbeatMessage{
+		Term:                cs.CurrentTerm,
+		LeaderID:            cs.CurrentNodeID,
+		LeaderAddress:       cs.LeaderAddress,
+		LeaderPublicAddress: cs.PublicAddress,
+		LastIndex:           lastIndex,
+		SchemaVersion:       cs.appliedSchemaVersion,
+	}
+	peers := cs.peersUnsafe()
+	quorum := cs.quorumSizeUnsafe()
+	cs.mu.RUnlock()
+
+	responses := make(chan HeartbeatResponse, len(peers))
+	for _, peer := range peers {
+		go func(node *Node) {
+			var response HeartbeatResponse
+			if _, err := postJSON(node.Address+"/cluster/heartbeat", message, &response); err != nil {
+				slog.Debug("Failed to send heartbeat", "node_id", node.ID, "error", err)
 			}
+			responses <- response
+		}(peer)
+	}
+
+	acks := 1 // El propio líder
+	for i := 0; i < len(peers); i++ {
+		response := <-responses
+		if response.Term > message.Term {
+			slog.Info("Follower reported higher term, stepping down", "higher_term", response.Term, "term", message.Term)
+			cs.stepDown(response.Term)
+			return
+		}
+		if response.Success {
+			acks++
 		}
 	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if cs.CurrentRole != Leader || cs.CurrentTerm != message.Term {
+		return
+	}
+
+	// Iniciar replicadores para los seguidores que se hayan unido
+	cs.syncReplicatorsUnsafe()
+
+	if acks >= quorum {
+		cs.lastQuorumAck = time.Now()
+		return
+	}
+
+	// Un líder aislado de la mayoría deja de aceptar escrituras para evitar split-brain
+	if time.Since(cs.lastQuorumAck) > baseElectionTimeout() {
+		slog.Warn("Leader lost contact with majority, stepping down", "acks", acks, "quorum", quorum)
+		cs.stepDownUnsafe(cs.CurrentTerm)
+	}
+}
+
+// maybeStartSyncUnsafe lanza una sincronización completa si el nodo es un seguidor
+// que todavía no está listo y tiene su propia copia de los datos (usar solo con lock)
+func (cs *ClusterState) maybeStartSyncUnsafe() {
+	if cs.IsReady || cs.syncing || cs.shuttingDown || cs.sharedDatabase || cs.CurrentRole != Follower || cs.LeaderAddress == "" {
+		return
+	}
+	if time.Since(cs.lastSyncAttempt) < 5*time.Second {
+		return
+	}
+
+	cs.syncing = true
+	cs.lastSyncAttempt = time.Now()
+	leaderAddress := cs.LeaderAddress
+
+	go func() {
+		slog.Info("Follower not ready, requesting sync from leader", "leader_address", leaderAddress)
+		if err := cs.RequestSync(leaderAddress); err != nil {
+			slog.Error("Error syncing from leader", "error", err)
+		}
+
+		cs.mu.Lock()
+		cs.syncing = false
+		cs.mu.Unlock()
+	}()
+}
+
+// maybeCatchUpUnsafe descarga del líder las entradas que falten hasta leaderIndex, la
+// última entrada del líder según el heartbeat anterior: si todavía no llegaron, el
+// replicador no las va a reenviar (por ejemplo, porque se reinició después de que el
+// seguidor dejara de responder) (usar solo con lock)
+func (cs *ClusterState) maybeCatchUpUnsafe(leaderIndex uint64) {
+	if !cs.IsReady || cs.syncing || cs.shuttingDown || cs.sharedDatabase || cs.CurrentRole != Follower || leaderIndex == 0 {
+		return
+	}
+	db := cs.db
+	if db == nil {
+		return
+	}
+
+	cs.syncing = true
+	go func() {
+		cs.applyMu.Lock()
+		if lastIndex := LastLogIndex(db); lastIndex < leaderIndex {
+			slog.Info("Behind leader, catching up", "last_index", lastIndex, "leader_index", leaderIndex)
+			if err := cs.catchUpUnsafe(db, lastIndex+1); err != nil {
+				slog.Error("Error catching up with leader", "error", err)
+			}
+		}
+		cs.applyMu.Unlock()
+
+		cs.mu.Lock()
+		cs.syncing = false
+		cs.mu.Unlock()
+	}()
+}
+
+// WaitForLeader espera hasta que el cluster tenga un líder conocido o se agote el timeout
+func (cs *ClusterState) WaitForLeader(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if cs.IsLeader() || cs.GetLeaderAddress() != "" {
+			return true
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	return false
+}
+
+// resolveClusterSize retorna el número de nodos con voto: CLUSTER_SIZE o, si no está
+// definido, el tamaño guardado en disco. El quórum nunca se calcula con los nodos que el
+// descubrimiento o el gossip ven en cada momento: un nodo aislado vería un cluster de
+// uno y se elegiría a sí mismo. Cambiar CLUSTER_SIZE es la única forma de cambiarlo.
+func resolveClusterSize(persisted int) (int, error) {
+	value := os.Getenv("CLUSTER_SIZE")
+	if value == "" {
+		if persisted > 0 {
+			return persisted, nil
+		}
+		return 0, errors.New("CLUSTER_SIZE must be set to the number of voting nodes")
+	}
+
+	size, err := strconv.Atoi(value)
+	if err != nil || size < 1 {
+		return 0, fmt.Errorf("invalid CLUSTER_SIZE %q", value)
+	}
+	return size, nil
+}
+
+// quorumSizeUnsafe retorna el número de votos necesarios para formar mayoría entre los
+// nodos con voto, estén vivos o no (usar solo con lock)
+func (cs *ClusterState) quorumSizeUnsafe() int {
+	size := cs.clusterSize
+	if size < 1 {
+		size = 1
+	}
+	return size/2 + 1
+}
+
+// peersUnsafe retorna los nodos saludables distintos del actual (usar solo con lock)
+func (cs *ClusterState) peersUnsafe() []*Node {
+	peers := make([]*Node, 0, len(cs.Nodes))
+	for _, node := range cs.getAllNodesUnsafe() {
+		if node.ID != cs.CurrentNodeID {
+			peers = append(peers, node)
+		}
+	}
+	return peers
+}
+
+// membersUnsafe retorna todos los nodos distintos del actual, también los caídos: las
+// solicitudes de voto llegan así a un nodo que el gossip dio por caído por error
+// (usar solo con lock)
+func (cs *ClusterState) membersUnsafe() []*Node {
+	members := make([]*Node, 0, len(cs.Nodes))
+	for _, node := range cs.Nodes {
+		if node.ID != cs.CurrentNodeID {
+			members = append(members, node)
+		}
+	}
+	return members
+}
+
+// leaderDeadUnsafe indica si el gossip confirmó que el líder conocido está caído (usar solo con lock)
+func (cs *ClusterState) leaderDeadUnsafe() bool {
+	node, exists := cs.Nodes[cs.LeaderID]
+	return exists && node.State == MemberDead
+}
+
+// selfAddressUnsafe retorna la dirección del nodo actual (usar solo con lock)
+func (cs *ClusterState) selfAddressUnsafe() string {
+	if node, exists := cs.Nodes[cs.CurrentNodeID]; exists {
+		return node.Address
+	}
+	return ""
+}
+
+// ensureNodeUnsafe registra o refresca un nodo conocido por mensajes del cluster
+func (cs *ClusterState) ensureNodeUnsafe(nodeID string, address string) {
+	if nodeID == "" || address == "" {
+		return
+	}
+	cs.upsertNodeUnsafe(nodeID, address)
+}
+
+// updateNodeRolesUnsafe actualiza los roles en el mapa de nodos según el líder actual
+func (cs *ClusterState) updateNodeRolesUnsafe() {
+	for _, node := range cs.Nodes {
+		if node.ID == cs.LeaderID {
+			node.Role = Leader
+		} else {
+			node.Role = Follower
+		}
+	}
+}
+
+// postJSON envía un mensaje JSON a otro nodo del cluster y decodifica la respuesta
+func postJSON(url string, payload interface{}, response interface{}) (int, error) {
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return 0, fmt.Errorf("error marshaling message: %v", err)
+	}
+
+	resp, err := clusterClient.Post(url, "application/json", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if response != nil {
+		if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+			return resp.StatusCode, fmt.Errorf("error decoding response: %v", err)
+		}
+	}
+
+	return resp.StatusCode, nil
 }
 
 // getAllNodesUnsafe retorna nodos sin lock (usar solo dentro de funciones con lock)
 func (cs *ClusterState) getAllNodesUnsafe() []*Node {
 	nodes := make([]*Node, 0, len(cs.Nodes))
 	for _, node := range cs.Nodes {
-		if node.IsHealthy {
+		if node.IsHealthy() {
 			nodes = append(nodes, node)
 		}
 	}
@@ -132,108 +613,80 @@ func (cs *ClusterState) getAllNodesUnsafe() []*Node {
 	return nodes
 }
 
-// StartLeaderElection inicia el proceso de elección de líder cada 10 segundos
+// StartLeaderElection inicia el descubrimiento periódico de nodos, los heartbeats
+// del líder y la detección de timeouts de elección
 func (cs *ClusterState) StartLeaderElection(db *gorm.DB) {
-	ticker := time.NewTicker(30 * time.Second)
+	cs.mu.Lock()
+	cs.db = db
+	cs.mu.Unlock()
+
 	go func() {
-		for range ticker.C {
-			log.Println("Starting leader election cycle...")
+		for {
+			// Reintentar pronto mientras haya nodos sin identificar (por ejemplo,
+			// porque todavía no escuchaban durante el descubrimiento inicial)
+			if cs.hasUnidentifiedPeers() {
+				time.Sleep(2 * heartbeatInterval())
+			} else {
+				time.Sleep(discoveryInterval())
+			}
 
 			// Descubrir nodos
 			if err := cs.DiscoverNodes(); err != nil {
-				log.Printf("Error discovering nodes: %v", err)
+				slog.Error("Error discovering nodes", "error", err)
 				continue
 			}
 
-			// Elegir líder
-			cs.ElectLeader(db)
-
 			// Mostrar estado del cluster
 			cs.PrintClusterState()
+		}
+	}()
 
-			// Mostrar estado de la base de datos
-			cs.PrintDatabaseState(db)
+	// Aplicar los cambios de la lista de nodos en cuanto se detectan
+	if watcher, ok := cs.Discoverer.(WatchingDiscoverer); ok {
+		go watcher.Watch(func() {
+			if err := cs.DiscoverNodes(); err != nil {
+				slog.Error("Error discovering nodes", "error", err)
+			}
+		})
+	}
+
+	// Detección de fallos por gossip
+	cs.startGossip()
+
+	// Borrar del log las entradas que ya no hacen falta para poner al día a los seguidores
+	cs.startLogCompaction()
+
+	// Verificación periódica de las tablas contra el líder (no aplica si se comparte la DB)
+	if !cs.SharedDatabase() {
+		cs.startAntiEntropy()
+	}
+
+	heartbeatTicker := time.NewTicker(heartbeatInterval())
+	go func() {
+		for range heartbeatTicker.C {
+			if cs.IsLeader() {
+				cs.sendHeartbeats()
+			} else {
+				cs.ElectLeader()
+			}
 		}
 	}()
 
-	log.Println("Leader election process started (every 10 seconds)")
+	slog.Info("Leader election process started", "heartbeat_interval", heartbeatInterval().String(),
+		"election_timeout", baseElectionTimeout().String(), "discovery", cs.Discoverer.Name(),
+		"discovery_interval", discoveryInterval().String())
 }
 
-// PrintClusterState imprime el estado actual del cluster
+// PrintClusterState registra el estado actual del cluster (nivel debug)
 func (cs *ClusterState) PrintClusterState() {
 	cs.mu.RLock()
 	defer cs.mu.RUnlock()
 
-	log.Println("========== Cluster State ==========")
-	log.Printf("Current Node ID: %d", cs.CurrentNodeID)
-	log.Printf("Current Role: %s", cs.CurrentRole)
-	log.Printf("Leader ID: %d", cs.LeaderID)
-	log.Printf("Leader Address: %s", cs.LeaderAddress)
-	log.Printf("Total Healthy Nodes: %d", len(cs.Nodes))
+	slog.Debug("Cluster state", "node_id", cs.CurrentNodeID, "role", cs.CurrentRole, "term", cs.CurrentTerm,
+		"leader_id", cs.LeaderID, "leader_address", cs.LeaderAddress, "nodes", len(cs.Nodes))
 
 	for _, node := range cs.Nodes {
-		log.Printf("  Node ID=%d, Role=%s, Address=%s, Healthy=%v",
-			node.ID, node.Role, node.Address, node.IsHealthy)
-	}
-	log.Println("===================================")
-}
-
-// PrintDatabaseState imprime el contenido de todas las tablas de la base de datos
-func (cs *ClusterState) PrintDatabaseState(db *gorm.DB) {
-	log.Println("\n========== Database State ==========")
-	log.Printf("Node ID: %d | Role: %s", cs.CurrentNodeID, cs.CurrentRole)
-
-	tables := []string{"users", "posts", "connections", "notifications"}
-
-	for _, table := range tables {
-		var count int64
-
-		// Contar registros
-		if err := db.Table(table).Count(&count).Error; err != nil {
-			log.Printf("[%s] Error counting: %v", table, err)
-			continue
-		}
-
-		log.Printf("\n[Table: %s] Total records: %d", table, count)
-
-		if count == 0 {
-			log.Printf("  (empty)")
-			continue
-		}
-
-		// Obtener todos los registros como mapas
-		var records []map[string]interface{}
-		if err := db.Table(table).Find(&records).Error; err != nil {
-			log.Printf("  Error fetching records: %v", err)
-			continue
-		}
-
-		// Imprimir cada registro
-		log.Printf("  Records:")
-		for i, record := range records {
-			// Construir string con todos los campos dinámicamente
-			var fields []string
-			for key, value := range record {
-				// Formatear el valor según su tipo
-				var formattedValue string
-				switch v := value.(type) {
-				case string:
-					// Limitar strings largos a 50 caracteres
-					if len(v) > 50 {
-						formattedValue = v[:47] + "..."
-					} else {
-						formattedValue = v
-					}
-				case nil:
-					formattedValue = "<nil>"
-				default:
-					formattedValue = fmt.Sprintf("%v", v)
-				}
-				fields = append(fields, fmt.Sprintf("%s=%s", key, formattedValue))
-			}
-			log.Printf("    [%d] %s", i+1, strings.Join(fields, " | "))
-		}
+		slog.Debug("Cluster node", "node_id", node.ID, "role", node.Role, "address", node.Address,
+			"state", node.State, "last_seen", node.LastSeen.Format(time.RFC3339))
 	}
-
-	log.Println("\n=====================================")
 }
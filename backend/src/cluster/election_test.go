@@ -0,0 +1,192 @@
+package cluster
+
+import (
+	"path/filepath"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestDB abre una base de datos SQLite temporal con el log de replicación
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("opening test database: %v", err)
+	}
+	if err := MigrateReplicationLog(db); err != nil {
+		t.Fatalf("migrating replication log: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+// newTestClusterState crea un seguidor listo con su estado persistido en un directorio temporal
+func newTestClusterState(t *testing.T) *ClusterState {
+	t.Helper()
+	return restartTestClusterState(t, t.TempDir())
+}
+
+// restartTestClusterState crea un seguidor listo que recupera del directorio dataDir el
+// término y el voto persistidos, como NewClusterState al arrancar el nodo
+func restartTestClusterState(t *testing.T, dataDir string) *ClusterState {
+	t.Helper()
+	t.Setenv("CLUSTER_DATA_DIR", dataDir)
+
+	state, err := loadPersistentState()
+	if err != nil {
+		t.Fatalf("loading persisted state: %v", err)
+	}
+
+	return &ClusterState{
+		Nodes:         make(map[string]*Node),
+		CurrentNodeID: "node-a",
+		CurrentRole:   Follower,
+		IsReady:       true,
+		CurrentTerm:   state.CurrentTerm,
+		VotedFor:      state.VotedFor,
+		maintenance:   state.Maintenance,
+		clusterSize:   3,
+		replicators:   make(map[string]*followerReplicator),
+		matchIndex:    make(map[string]uint64),
+		ackCh:         make(chan struct{}),
+		appliedCh:     make(chan struct{}),
+		db:            newTestDB(t),
+	}
+}
+
+func TestQuorumSizeUsesClusterSize(t *testing.T) {
+	tests := []struct {
+		clusterSize int
+		quorum      int
+	}{
+		{0, 1},
+		{1, 1},
+		{2, 2},
+		{3, 2},
+		{4, 3},
+		{5, 3},
+	}
+
+	for _, tt := range tests {
+		cs := &ClusterState{clusterSize: tt.clusterSize, Nodes: make(map[string]*Node)}
+		if got := cs.quorumSizeUnsafe(); got != tt.quorum {
+			t.Errorf("clusterSize %d: quorum = %d, want %d", tt.clusterSize, got, tt.quorum)
+		}
+	}
+}
+
+func TestQuorumSizeIgnoresDeadMembers(t *testing.T) {
+	cs := &ClusterState{clusterSize: 5, CurrentNodeID: "a", Nodes: map[string]*Node{
+		"a": {ID: "a", State: MemberAlive},
+		"b": {ID: "b", State: MemberAlive},
+		"c": {ID: "c", State: MemberDead},
+		"d": {ID: "d", State: MemberDead},
+		"e": {ID: "e", State: MemberDead},
+	}}
+
+	// Con la mayoría caída los dos nodos vivos no pueden formar quórum entre ellos
+	if got := cs.quorumSizeUnsafe(); got != 3 {
+		t.Errorf("quorum = %d, want 3", got)
+	}
+	if got := len(cs.membersUnsafe()); got != 4 {
+		t.Errorf("members = %d, want 4", got)
+	}
+}
+
+func TestResolveClusterSize(t *testing.T) {
+	tests := []struct {
+		name      string
+		env       string
+		persisted int
+		want      int
+		wantErr   bool
+	}{
+		{name: "from environment", env: "5", want: 5},
+		{name: "environment overrides persisted", env: "5", persisted: 3, want: 5},
+		{name: "persisted without environment", persisted: 3, want: 3},
+		{name: "missing", wantErr: true},
+		{name: "invalid", env: "three", wantErr: true},
+		{name: "zero", env: "0", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CLUSTER_SIZE", tt.env)
+
+			got, err := resolveClusterSize(tt.persisted)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("resolveClusterSize(%d) = %d, want error", tt.persisted, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveClusterSize(%d): %v", tt.persisted, err)
+			}
+			if got != tt.want {
+				t.Errorf("resolveClusterSize(%d) = %d, want %d", tt.persisted, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleVoteRequestPersistsVote(t *testing.T) {
+	dataDir := t.TempDir()
+	cs := restartTestClusterState(t, dataDir)
+
+	response := cs.HandleVoteRequest(VoteRequest{Term: 2, CandidateID: "node-b"})
+	if !response.VoteGranted || response.Term != 2 {
+		t.Fatalf("vote for node-b = %+v, want granted in term 2", response)
+	}
+
+	// Después de reiniciar el nodo recupera el voto del disco y no puede votar por
+	// otro candidato en el mismo término
+	restarted := restartTestClusterState(t, dataDir)
+	if restarted.CurrentTerm != 2 || restarted.VotedFor != "node-b" {
+		t.Fatalf("restarted node has term %d and vote %q, want term 2 and vote for node-b", restarted.CurrentTerm, restarted.VotedFor)
+	}
+	if response := restarted.HandleVoteRequest(VoteRequest{Term: 2, CandidateID: "node-c"}); response.VoteGranted {
+		t.Fatalf("second vote in term 2 was granted: %+v", response)
+	}
+	if response := restarted.HandleVoteRequest(VoteRequest{Term: 2, CandidateID: "node-b"}); !response.VoteGranted {
+		t.Fatalf("repeated vote for the same candidate was rejected: %+v", response)
+	}
+
+	// Un término nuevo libera el voto, también en disco
+	if response := restarted.HandleVoteRequest(VoteRequest{Term: 3, CandidateID: "node-c"}); !response.VoteGranted {
+		t.Fatalf("vote for node-c in term 3 was rejected: %+v", response)
+	}
+	if again := restartTestClusterState(t, dataDir); again.CurrentTerm != 3 || again.VotedFor != "node-c" {
+		t.Errorf("restarted node has term %d and vote %q, want term 3 and vote for node-c", again.CurrentTerm, again.VotedFor)
+	}
+}
+
+func TestHandleVoteRequestRejectsStaleTermAndLog(t *testing.T) {
+	cs := newTestClusterState(t)
+	cs.CurrentTerm = 3
+	if _, err := cs.AppendToLog(cs.db, nil); err != nil {
+		t.Fatalf("appending to log: %v", err)
+	}
+
+	if response := cs.HandleVoteRequest(VoteRequest{Term: 2, CandidateID: "node-b", LastLogIndex: 5, LastLogTerm: 3}); response.VoteGranted {
+		t.Errorf("vote granted to a candidate from an older term: %+v", response)
+	}
+
+	// El log del candidato termina en un término anterior al de la última entrada local
+	if response := cs.HandleVoteRequest(VoteRequest{Term: 4, CandidateID: "node-b", LastLogIndex: 9, LastLogTerm: 2}); response.VoteGranted {
+		t.Errorf("vote granted to a candidate with an outdated log: %+v", response)
+	}
+	if cs.CurrentTerm != 4 {
+		t.Errorf("term = %d, want 4 after seeing the newer term", cs.CurrentTerm)
+	}
+}
@@ -0,0 +1,11 @@
+package cluster
+
+// RouteClassOf expone a los tests externos la clase con que se atiende una petición
+func (cs *ClusterState) RouteClassOf(method, path string) RouteClass {
+	return cs.routeClass(method, path)
+}
+
+// RoutePatternOf expone a los tests externos la ruta que atiende una petición
+func (cs *ClusterState) RoutePatternOf(method, path string) string {
+	return cs.routePattern(method, path)
+}
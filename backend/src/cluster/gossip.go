@@ -0,0 +1,500 @@
+package cluster
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"math/rand"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// gossipUpdate es un cambio de estado pendiente de difundir y cuántas veces se envió
+type gossipUpdate struct {
+	update    MemberUpdate
+	transmits int
+}
+
+// maxPiggybackUpdates limita los cambios de estado enviados en cada mensaje
+const maxPiggybackUpdates = 8
+
+// gossipInterval retorna cada cuánto se sondea a un nodo
+func gossipInterval() time.Duration {
+	return envDuration("CLUSTER_GOSSIP_INTERVAL", 500*time.Millisecond)
+}
+
+// gossipPingTimeout retorna cuánto se espera la respuesta a un ping directo
+func gossipPingTimeout() time.Duration {
+	return envDuration("CLUSTER_GOSSIP_PING_TIMEOUT", 300*time.Millisecond)
+}
+
+// gossipIndirectProbes retorna a cuántos nodos se pide un sondeo indirecto
+func gossipIndirectProbes() int {
+	return envInt("CLUSTER_GOSSIP_INDIRECT_PROBES", 3)
+}
+
+// gossipSuspectTimeout retorna cuánto tiempo un nodo sospechoso tiene para desmentirlo
+func gossipSuspectTimeout() time.Duration {
+	return envDuration("CLUSTER_GOSSIP_SUSPECT_TIMEOUT", 2*time.Second)
+}
+
+// startGossip sondea periódicamente a un nodo y revisa los timeouts de sospecha
+func (cs *ClusterState) startGossip() {
+	ticker := time.NewTicker(gossipInterval())
+	go func() {
+		for range ticker.C {
+			// Tras anunciar su salida el nodo no debe volver a parecer vivo
+			if cs.HasLeftCluster() {
+				continue
+			}
+			cs.expireSuspects()
+			cs.probeNext()
+		}
+	}()
+}
+
+// probeNext sondea al siguiente nodo: primero con un ping directo y, si no responde,
+// a través de otros nodos para no culparlo de un fallo de la red entre ambos
+func (cs *ClusterState) probeNext() {
+	cs.mu.Lock()
+	target := cs.nextProbeTargetUnsafe()
+	if target == nil {
+		cs.mu.Unlock()
+		return
+	}
+	targetID, targetAddress := target.ID, target.Address
+	targetDead := target.State == MemberDead
+	ping := cs.newPingUnsafe()
+	cs.mu.Unlock()
+
+	ack, err := sendGossip(targetAddress+"/cluster/gossip/ping", ping, gossipPingTimeout())
+	if err == nil {
+		cs.handleAck(targetID, targetAddress, ack)
+		return
+	}
+
+	// Un nodo caído que sigue sin responder no necesita sondeos indirectos
+	if targetDead {
+		return
+	}
+
+	if cs.probeIndirect(targetID, targetAddress) {
+		return
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if node, exists := cs.Nodes[targetID]; exists && node.State == MemberAlive {
+		slog.Info("Node did not respond to direct or indirect probes", "node_id", targetID, "error", err)
+		cs.applyUpdateUnsafe(MemberUpdate{
+			NodeID:      targetID,
+			Address:     node.Address,
+			State:       MemberSuspect,
+			Incarnation: node.Incarnation,
+		})
+	}
+}
+
+// nextProbeTargetUnsafe retorna el siguiente nodo a sondear. Se recorren todos los nodos
+// en un orden aleatorio que se renueva en cada vuelta; los caídos también, para notar
+// cuándo vuelven (usar solo con lock)
+func (cs *ClusterState) nextProbeTargetUnsafe() *Node {
+	for attempts := 0; attempts < 2; attempts++ {
+		for len(cs.probeOrder) > 0 {
+			nodeID := cs.probeOrder[0]
+			cs.probeOrder = cs.probeOrder[1:]
+			if node, exists := cs.Nodes[nodeID]; exists {
+				return node
+			}
+		}
+
+		for id := range cs.Nodes {
+			if id != cs.CurrentNodeID {
+				cs.probeOrder = append(cs.probeOrder, id)
+			}
+		}
+		rand.Shuffle(len(cs.probeOrder), func(i, j int) {
+			cs.probeOrder[i], cs.probeOrder[j] = cs.probeOrder[j], cs.probeOrder[i]
+		})
+	}
+	return nil
+}
+
+// probeIndirect pide a otros nodos que sondeen al objetivo y retorna si alguno obtuvo respuesta
+func (cs *ClusterState) probeIndirect(targetID, targetAddress string) bool {
+	cs.mu.Lock()
+	var helpers []*Node
+	for _, node := range cs.Nodes {
+		if node.ID != cs.CurrentNodeID && node.ID != targetID && node.State == MemberAlive {
+			helpers = append(helpers, node)
+		}
+	}
+	rand.Shuffle(len(helpers), func(i, j int) { helpers[i], helpers[j] = helpers[j], helpers[i] })
+	if len(helpers) > gossipIndirectProbes() {
+		helpers = helpers[:gossipIndirectProbes()]
+	}
+	request := GossipPingRequest{
+		FromID:        cs.CurrentNodeID,
+		TargetID:      targetID,
+		TargetAddress: targetAddress,
+		Updates:       cs.pendingUpdatesUnsafe(),
+	}
+	cs.mu.Unlock()
+
+	if len(helpers) == 0 {
+		return false
+	}
+
+	results := make(chan bool, len(helpers))
+	for _, helper := range helpers {
+		go func(node *Node) {
+			var response GossipPingRequestResponse
+			// El intermediario necesita tiempo para su propio ping al objetivo
+			if err := postGossip(node.Address+"/cluster/gossip/ping-req", request, &response, 2*gossipPingTimeout()); err != nil {
+				results <- false
+				return
+			}
+			cs.mergeUpdates(response.Updates)
+			results <- response.Acked
+		}(helper)
+	}
+
+	acked := false
+	for range helpers {
+		if <-results {
+			acked = true
+		}
+	}
+
+	if acked {
+		cs.mu.Lock()
+		cs.heardFromUnsafe(targetID, targetAddress, 0)
+		cs.mu.Unlock()
+	}
+	return acked
+}
+
+// HandleGossipPing responde a un ping y aplica los cambios de estado que trae
+func (cs *ClusterState) HandleGossipPing(ping GossipPing) GossipAck {
+	cs.mergeUpdates(ping.Updates)
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	cs.heardFromUnsafe(ping.FromID, ping.FromAddress, ping.Incarnation)
+	if node, exists := cs.Nodes[ping.FromID]; exists {
+		if ping.FromPublicAddress != "" {
+			node.PublicAddress = ping.FromPublicAddress
+		}
+		node.SchemaVersion = ping.FromSchemaVersion
+	}
+
+	return GossipAck{
+		NodeID:      cs.CurrentNodeID,
+		Incarnation: cs.incarnation,
+		Updates:     cs.pendingUpdatesUnsafe(),
+	}
+}
+
+// HandleGossipPingRequest sondea al nodo indicado en nombre de otro
+func (cs *ClusterState) HandleGossipPingRequest(request GossipPingRequest) GossipPingRequestResponse {
+	cs.mergeUpdates(request.Updates)
+
+	cs.mu.Lock()
+	ping := cs.newPingUnsafe()
+	cs.mu.Unlock()
+
+	ack, err := sendGossip(request.TargetAddress+"/cluster/gossip/ping", ping, gossipPingTimeout())
+	if err == nil {
+		cs.handleAck(request.TargetID, request.TargetAddress, ack)
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return GossipPingRequestResponse{
+		Acked:   err == nil && ack.NodeID == request.TargetID,
+		Updates: cs.pendingUpdatesUnsafe(),
+	}
+}
+
+// handleAck registra la respuesta de un nodo sondeado
+func (cs *ClusterState) handleAck(nodeID, address string, ack GossipAck) {
+	cs.mergeUpdates(ack.Updates)
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if ack.NodeID != nodeID {
+		// Otro nodo ocupa ahora esa dirección
+		slog.Warn("Probe answered by another node", "address", address, "answered_by", ack.NodeID, "node_id", nodeID)
+		cs.heardFromUnsafe(ack.NodeID, address, ack.Incarnation)
+		return
+	}
+	cs.heardFromUnsafe(nodeID, address, ack.Incarnation)
+}
+
+// newPingUnsafe construye un ping con los cambios pendientes de difundir (usar solo con lock)
+func (cs *ClusterState) newPingUnsafe() GossipPing {
+	return GossipPing{
+		FromID:            cs.CurrentNodeID,
+		FromAddress:       cs.selfAddressUnsafe(),
+		Incarnation:       cs.incarnation,
+		Updates:           cs.pendingUpdatesUnsafe(),
+		FromPublicAddress: cs.PublicAddress,
+		FromSchemaVersion: cs.codeSchemaVersion,
+	}
+}
+
+// mergeUpdates aplica los cambios de estado recibidos de otro nodo
+func (cs *ClusterState) mergeUpdates(updates []MemberUpdate) {
+	if len(updates) == 0 {
+		return
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	for _, update := range updates {
+		cs.applyUpdateUnsafe(update)
+	}
+}
+
+// heardFromUnsafe registra un mensaje directo de un nodo: es la mejor prueba de que
+// está vivo, así que vuelve a alive aunque estuviera sospechoso o caído (usar solo con lock)
+func (cs *ClusterState) heardFromUnsafe(nodeID, address string, incarnation uint64) {
+	if nodeID == "" || nodeID == cs.CurrentNodeID {
+		return
+	}
+
+	node, exists := cs.Nodes[nodeID]
+	if !exists {
+		if address == "" {
+			return
+		}
+		cs.upsertNodeUnsafe(nodeID, address)
+		node = cs.Nodes[nodeID]
+	}
+
+	node.LastSeen = time.Now()
+	if address != "" {
+		node.Address = address
+	}
+	if incarnation > node.Incarnation {
+		node.Incarnation = incarnation
+	}
+	if node.State != MemberAlive {
+		cs.setStateUnsafe(node, MemberAlive)
+	}
+}
+
+// applyUpdateUnsafe aplica un cambio de estado recibido por gossip según las reglas de
+// SWIM: alive solo gana con una incarnation mayor, suspect gana a alive con la misma
+// incarnation y dead gana a ambos (usar solo con lock)
+func (cs *ClusterState) applyUpdateUnsafe(update MemberUpdate) {
+	if update.NodeID == "" {
+		return
+	}
+
+	// Otro nodo sospecha de este: desmentirlo con una incarnation mayor
+	if update.NodeID == cs.CurrentNodeID {
+		if update.State != MemberAlive && update.Incarnation >= cs.incarnation {
+			cs.incarnation = update.Incarnation + 1
+			slog.Info("Refuting state for this node", "state", update.State, "incarnation", cs.incarnation)
+			cs.enqueueUpdateUnsafe(cs.selfUpdateUnsafe())
+		}
+		return
+	}
+
+	node, exists := cs.Nodes[update.NodeID]
+	if !exists {
+		if update.State == MemberDead || update.Address == "" {
+			return
+		}
+		cs.upsertNodeUnsafe(update.NodeID, update.Address)
+		node = cs.Nodes[update.NodeID]
+		node.State = update.State
+		node.Incarnation = update.Incarnation
+		node.Maintenance = update.Maintenance
+		node.PublicAddress = update.PublicAddress
+		node.SchemaVersion = update.SchemaVersion
+		cs.enqueueUpdateUnsafe(update)
+		return
+	}
+
+	apply := false
+	switch update.State {
+	case MemberAlive:
+		apply = update.Incarnation > node.Incarnation
+	case MemberSuspect:
+		apply = (node.State == MemberAlive && update.Incarnation >= node.Incarnation) ||
+			(node.State == MemberSuspect && update.Incarnation > node.Incarnation)
+	case MemberDead:
+		apply = node.State != MemberDead && update.Incarnation >= node.Incarnation
+	}
+	if !apply {
+		return
+	}
+
+	node.Incarnation = update.Incarnation
+	node.Maintenance = update.Maintenance
+	if update.PublicAddress != "" {
+		node.PublicAddress = update.PublicAddress
+	}
+	if update.SchemaVersion != 0 {
+		node.SchemaVersion = update.SchemaVersion
+	}
+	if update.Address != "" {
+		node.Address = update.Address
+	}
+	if node.State != update.State {
+		cs.setStateUnsafe(node, update.State)
+	} else {
+		cs.enqueueUpdateUnsafe(cs.memberUpdateUnsafe(node))
+	}
+}
+
+// setStateUnsafe cambia el estado de un nodo y difunde el cambio (usar solo con lock)
+func (cs *ClusterState) setStateUnsafe(node *Node, state MemberState) {
+	slog.Info("Node state changed", "node_id", node.ID, "state", state, "previous_state", node.State, "incarnation", node.Incarnation)
+
+	node.State = state
+	node.StateChanged = time.Now()
+	cs.enqueueUpdateUnsafe(cs.memberUpdateUnsafe(node))
+
+	// Si el líder cae no hace falta esperar el timeout de elección
+	if state == MemberDead && node.ID == cs.LeaderID && cs.CurrentRole == Follower {
+		slog.Warn("Leader declared dead by gossip, starting election", "leader_id", node.ID)
+		cs.timerReset = time.Time{}
+	}
+}
+
+// expireSuspects confirma como caídos a los sospechosos que no lo desmintieron a tiempo.
+// Los nodos caídos siguen siendo miembros del cluster: dejan de recibir tráfico pero no
+// se eliminan, solo un operador puede quitarlos (RemoveMember)
+func (cs *ClusterState) expireSuspects() {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	for _, node := range cs.Nodes {
+		if node.State == MemberSuspect && time.Since(node.StateChanged) > gossipSuspectTimeout() {
+			cs.setStateUnsafe(node, MemberDead)
+		}
+	}
+}
+
+// RemoveMember quita de la vista de este nodo a un miembro caído (por ejemplo, un nodo
+// retirado o recreado con otra identidad). El quórum no cambia: lo define CLUSTER_SIZE.
+func (cs *ClusterState) RemoveMember(nodeID string) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	node, exists := cs.Nodes[nodeID]
+	if !exists {
+		return fmt.Errorf("unknown node %s", nodeID)
+	}
+	if node.ID == cs.CurrentNodeID || node.State != MemberDead {
+		return fmt.Errorf("node %s is not dead (%s)", nodeID, node.State)
+	}
+
+	slog.Info("Removing dead node", "node_id", nodeID)
+	delete(cs.Nodes, nodeID)
+	delete(cs.gossipQueue, nodeID)
+	return nil
+}
+
+// enqueueUpdateUnsafe agrega un cambio de estado a difundir, reemplazando el anterior
+// del mismo nodo (usar solo con lock)
+func (cs *ClusterState) enqueueUpdateUnsafe(update MemberUpdate) {
+	cs.gossipQueue[update.NodeID] = &gossipUpdate{update: update}
+}
+
+// pendingUpdatesUnsafe retorna los cambios menos difundidos para adjuntarlos a un
+// mensaje. Cada cambio se envía unas 3·log2(n) veces, suficiente para que llegue a
+// todo el cluster con alta probabilidad (usar solo con lock)
+func (cs *ClusterState) pendingUpdatesUnsafe() []MemberUpdate {
+	if len(cs.gossipQueue) == 0 {
+		return nil
+	}
+
+	queued := make([]*gossipUpdate, 0, len(cs.gossipQueue))
+	for _, pending := range cs.gossipQueue {
+		queued = append(queued, pending)
+	}
+	sort.Slice(queued, func(i, j int) bool {
+		return queued[i].transmits < queued[j].transmits
+	})
+	if len(queued) > maxPiggybackUpdates {
+		queued = queued[:maxPiggybackUpdates]
+	}
+
+	limit := 3 * int(math.Ceil(math.Log2(float64(len(cs.Nodes)+1))))
+	updates := make([]MemberUpdate, 0, len(queued))
+	for _, pending := range queued {
+		updates = append(updates, pending.update)
+		pending.transmits++
+		if pending.transmits >= limit {
+			delete(cs.gossipQueue, pending.update.NodeID)
+		}
+	}
+	return updates
+}
+
+// memberUpdateUnsafe retorna el estado actual de un nodo como cambio a difundir
+func (cs *ClusterState) memberUpdateUnsafe(node *Node) MemberUpdate {
+	return MemberUpdate{
+		NodeID:        node.ID,
+		Address:       node.Address,
+		State:         node.State,
+		Incarnation:   node.Incarnation,
+		Maintenance:   node.Maintenance,
+		PublicAddress: node.PublicAddress,
+		SchemaVersion: node.SchemaVersion,
+	}
+}
+
+// selfUpdateUnsafe retorna el estado del nodo actual como cambio a difundir
+func (cs *ClusterState) selfUpdateUnsafe() MemberUpdate {
+	return MemberUpdate{
+		NodeID:        cs.CurrentNodeID,
+		Address:       cs.selfAddressUnsafe(),
+		State:         MemberAlive,
+		Incarnation:   cs.incarnation,
+		Maintenance:   cs.maintenance,
+		PublicAddress: cs.PublicAddress,
+		SchemaVersion: cs.codeSchemaVersion,
+	}
+}
+
+// sendGossip envía un ping y retorna la respuesta
+func sendGossip(url string, ping GossipPing, timeout time.Duration) (GossipAck, error) {
+	var ack GossipAck
+	err := postGossip(url, ping, &ack, timeout)
+	return ack, err
+}
+
+// postGossip envía un mensaje de gossip con un timeout propio, mucho menor que el de
+// los mensajes de elección para detectar fallos rápido
+func postGossip(url string, payload interface{}, response interface{}, timeout time.Duration) error {
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("error marshaling gossip message: %v", err)
+	}
+
+	client := newClusterClient(timeout)
+	resp, err := client.Post(url, "application/json", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("gossip request failed with status: %d", resp.StatusCode)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+		return fmt.Errorf("error decoding gossip response: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package cluster
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// readyMaxLag retorna cuántas entradas puede estar un seguidor por detrás del líder y
+// seguir recibiendo tráfico
+func readyMaxLag() uint64 {
+	lag := envInt("CLUSTER_READY_MAX_LAG", 100)
+	if lag < 0 {
+		return 0
+	}
+	return uint64(lag)
+}
+
+// readyMaxStaleness retorna cuánto puede pasar un seguidor sin noticias del líder y
+// seguir recibiendo tráfico
+func readyMaxStaleness() time.Duration {
+	return envDuration("CLUSTER_READY_MAX_STALENESS", baseElectionTimeout())
+}
+
+// Readiness es el resultado de /readyz: si el nodo puede recibir tráfico y, si no, por qué
+type Readiness struct {
+	Ready            bool     `json:"ready"`
+	NodeID           string   `json:"node_id"`
+	Role             NodeRole `json:"role"`
+	LastIndex        uint64   `json:"last_index"`   // Última entrada aplicada en este nodo
+	LeaderIndex      uint64   `json:"leader_index"` // Última entrada del líder conocida
+	Lag              uint64   `json:"replication_lag"`
+	LeaderContactAge string   `json:"leader_contact_age,omitempty"` // Solo seguidores
+	Reasons          []string `json:"reasons,omitempty"`
+}
+
+// CheckReadiness indica si el nodo puede recibir tráfico: base de datos abierta, datos
+// sincronizados con el líder, contacto reciente con él y un retraso de replicación
+// menor que CLUSTER_READY_MAX_LAG
+func (cs *ClusterState) CheckReadiness() Readiness {
+	var reasons []string
+
+	var lastIndex uint64
+	db := cs.getDB()
+	if db == nil {
+		reasons = append(reasons, "database not open")
+	} else if sqlDB, err := db.DB(); err != nil {
+		reasons = append(reasons, fmt.Sprintf("database unavailable: %v", err))
+	} else if err := sqlDB.Ping(); err != nil {
+		reasons = append(reasons, fmt.Sprintf("database unavailable: %v", err))
+	} else {
+		lastIndex = LastLogIndex(db)
+	}
+
+	cs.mu.RLock()
+	readiness := Readiness{
+		NodeID:      cs.CurrentNodeID,
+		Role:        cs.CurrentRole,
+		LastIndex:   lastIndex,
+		LeaderIndex: lastIndex,
+	}
+	if cs.shuttingDown {
+		reasons = append(reasons, "shutting down")
+	}
+	if cs.CurrentRole == Leader && !cs.IsReady {
+		if cs.migrationError != "" {
+			reasons = append(reasons, "schema migrations failed: "+cs.migrationError)
+		} else {
+			reasons = append(reasons, "applying schema migrations")
+		}
+	}
+	if cs.CurrentRole != Leader {
+		readiness.LeaderIndex = cs.leaderLastIndex
+		readiness.Lag = lagBehind(cs.leaderLastIndex, lastIndex)
+
+		switch {
+		case cs.LeaderID == "":
+			reasons = append(reasons, "no leader")
+		case !cs.IsReady && cs.sharedDatabase:
+			reasons = append(reasons, fmt.Sprintf("waiting for schema migrations (schema version %d, binary %d)", cs.appliedSchemaVersion, cs.codeSchemaVersion))
+		case !cs.IsReady:
+			reasons = append(reasons, "synchronizing with the leader")
+		default:
+			age := time.Since(cs.lastHeartbeat)
+			readiness.LeaderContactAge = age.Round(time.Millisecond).String()
+			if age > readyMaxStaleness() {
+				reasons = append(reasons, fmt.Sprintf("no contact with the leader for %v", age.Round(time.Second)))
+			}
+			if readiness.Lag > readyMaxLag() {
+				reasons = append(reasons, fmt.Sprintf("replication lag of %d entries (max %d)", readiness.Lag, readyMaxLag()))
+			}
+		}
+	}
+	cs.mu.RUnlock()
+
+	readiness.Ready = len(reasons) == 0
+	readiness.Reasons = reasons
+	return readiness
+}
+
+// replicationLags retorna cuántas entradas le faltan a cada seguidor según las que
+// confirmó (solo líder)
+func (cs *ClusterState) replicationLags(leaderIndex uint64) map[string]uint64 {
+	cs.ackMu.Lock()
+	defer cs.ackMu.Unlock()
+
+	lags := make(map[string]uint64, len(cs.matchIndex))
+	for id, index := range cs.matchIndex {
+		lags[id] = lagBehind(leaderIndex, index)
+	}
+	return lags
+}
+
+// lagBehind retorna cuántas entradas separan index de leaderIndex
+func lagBehind(leaderIndex, index uint64) uint64 {
+	if index >= leaderIndex {
+		return 0
+	}
+	return leaderIndex - index
+}
+
+// isHealthEndpoint indica si el path es un endpoint de salud o de métricas (siempre
+// responde el propio nodo, aunque no esté listo)
+func isHealthEndpoint(path string) bool {
+	path = strings.ToLower(path)
+	return path == "/healthz" || path == "/readyz" || path == "/metrics"
+}
@@ -1,13 +1,18 @@
 package cluster
 
 import (
-	"encoding/json"
-	"log"
-	"time"
+	"fmt"
+	"log/slog"
 
+	"github.com/theleywin/Backend-Talent-Nest/src/logging"
 	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+	"gorm.io/gorm/schema"
 )
 
+// affectedKeysKey guarda en el statement las claves de las filas que cumplen la condición
+const affectedKeysKey = "replication:affected_keys"
+
 // ReplicationHook es un plugin de GORM que captura operaciones de escritura
 type ReplicationHook struct {
 	ClusterState *ClusterState
@@ -20,90 +25,83 @@ func (h *ReplicationHook) Name() string {
 
 // Initialize inicializa el plugin y registra los callbacks
 func (h *ReplicationHook) Initialize(db *gorm.DB) error {
+	// Los callbacks se ejecutan dentro de la transacción de GORM (antes del commit)
+	// para que la captura de las filas vea el cambio y se confirme con él
+
 	// Callback DESPUÉS de INSERT
-	db.Callback().Create().After("gorm:create").Register("replication:after_create", h.afterCreate)
+	db.Callback().Create().After("gorm:create").Before("gorm:commit_or_rollback_transaction").Register("replication:after_create", h.afterCreate)
 
 	// Callback DESPUÉS de UPDATE
-	db.Callback().Update().After("gorm:update").Register("replication:after_update", h.afterUpdate)
+	db.Callback().Update().After("gorm:update").Before("gorm:commit_or_rollback_transaction").Register("replication:after_update", h.afterUpdate)
 
 	// Callback DESPUÉS de DELETE
-	db.Callback().Delete().After("gorm:delete").Register("replication:after_delete", h.afterDelete)
+	db.Callback().Delete().After("gorm:delete").Before("gorm:commit_or_rollback_transaction").Register("replication:after_delete", h.afterDelete)
+
+	// Callbacks ANTES de UPDATE/DELETE por condición: guardan las filas afectadas
+	db.Callback().Update().After("gorm:begin_transaction").Before("gorm:update").Register("replication:before_update", h.beforeWrite)
+	db.Callback().Delete().After("gorm:begin_transaction").Before("gorm:delete").Register("replication:before_delete", h.beforeWrite)
 
-	log.Println("✓ Replication hooks registered in GORM")
+	// Sentencias SQL escritas a mano (db.Exec)
+	db.Callback().Raw().Before("gorm:raw").Register("replication:begin_raw", h.beginRaw)
+	db.Callback().Raw().After("gorm:raw").Register("replication:after_raw", h.afterRaw)
+	db.Callback().Raw().After("replication:after_raw").Register("replication:commit_raw", callbacks.CommitOrRollbackTransaction)
+
+	// Las transacciones acumulan sus cambios y los escriben en el log al confirmarse
+	if _, wrapped := db.ConnPool.(*replicatedPool); !wrapped {
+		pool := &replicatedPool{ConnPool: db.ConnPool, db: db, cs: h.ClusterState}
+		db.ConnPool = pool
+		db.Statement.ConnPool = pool
+	}
+
+	slog.Debug("Replication hooks registered in GORM")
 	return nil
 }
 
 // afterCreate se ejecuta después de cada INSERT
 func (h *ReplicationHook) afterCreate(db *gorm.DB) {
-	// Solo replicar si somos el líder
-	if !h.ClusterState.IsLeader() {
-		return
-	}
+	h.captureChange(db, "INSERT")
+}
 
-	// Verificar que no hubo error
-	if db.Error != nil {
+// afterUpdate se ejecuta después de cada UPDATE
+func (h *ReplicationHook) afterUpdate(db *gorm.DB) {
+	h.captureChange(db, "UPDATE")
+}
+
+// afterDelete se ejecuta después de cada DELETE
+func (h *ReplicationHook) afterDelete(db *gorm.DB) {
+	h.captureChange(db, "DELETE")
+}
+
+// beforeWrite guarda las claves de las filas que afectará un UPDATE o DELETE por
+// condición (Where(...).Updates, Delete(&Model{}, ids)), antes de que el propio
+// cambio haga que dejen de cumplirla
+func (h *ReplicationHook) beforeWrite(db *gorm.DB) {
+	if !h.ClusterState.IsLeader() || db.Error != nil {
 		return
 	}
 
-	// Verificar que tenemos el statement y schema
-	statement := db.Statement
-	if statement == nil || statement.Schema == nil {
+	sch := h.schemaOf(db)
+	if sch == nil || isInternalTable(sch.Table) || sch.PrioritizedPrimaryField == nil {
 		return
 	}
 
-	tableName := statement.Schema.Table
-
-	// Extraer todos los campos del modelo insertado
-	data := make(map[string]interface{})
-
-	for _, field := range statement.Schema.Fields {
-		if field.Readable && field.DBName != "" {
-			var value interface{}
-			var isZero bool
-
-			// Para campos con serializador JSON, obtener el valor real del struct
-			if field.Serializer != nil {
-				fieldValue := statement.ReflectValue.FieldByName(field.Name)
-				if fieldValue.IsValid() && fieldValue.CanInterface() {
-					value = fieldValue.Interface()
-					isZero = fieldValue.IsZero()
-				} else {
-					continue
-				}
-			} else {
-				value, isZero = field.ValueOf(db.Statement.Context, statement.ReflectValue)
-			}
-
-			if !isZero {
-				// Solo agregar valores primitivos o serializables
-				cleanValue := sanitizeValue(value)
-				if cleanValue != nil {
-					data[field.DBName] = cleanValue
-				}
-			}
-		}
+	// Con la clave primaria en el modelo el cambio ya se limita a esas filas
+	if len(primaryKeysOf(db.Statement, sch)) > 0 {
+		return
 	}
 
-	// Obtener el ID del registro insertado
-	var recordID uint
-	if idField := statement.Schema.PrioritizedPrimaryField; idField != nil {
-		value, _ := idField.ValueOf(db.Statement.Context, statement.ReflectValue)
-		if id, ok := value.(uint); ok {
-			recordID = id
-		}
+	keys, err := matchingKeys(db, sch)
+	if err != nil {
+		db.AddError(err)
+		return
 	}
-
-	log.Printf("[ReplicationHook] 📝 Captured INSERT on %s (ID=%d): %v", tableName, recordID, data)
-
-	// Replicar de forma asíncrona
-	go func() {
-		h.ClusterState.ReplicateToFollowers("INSERT", tableName, data, recordID)
-		log.Printf("[ReplicationHook] ✓ Replicated INSERT on %s (ID=%d) to followers", tableName, recordID)
-	}()
+	db.InstanceSet(affectedKeysKey, keys)
 }
 
-// afterUpdate se ejecuta después de cada UPDATE
-func (h *ReplicationHook) afterUpdate(db *gorm.DB) {
+// captureChange agrega a la transacción la imagen de cada fila afectada por la operación,
+// leída de la base de datos dentro de la misma transacción. Así el seguidor recibe
+// exactamente los valores que guardó el líder, sin depender de cómo se escribió el cambio.
+func (h *ReplicationHook) captureChange(db *gorm.DB, operation string) {
 	// Solo replicar si somos el líder
 	if !h.ClusterState.IsLeader() {
 		return
@@ -114,186 +112,129 @@ func (h *ReplicationHook) afterUpdate(db *gorm.DB) {
 		return
 	}
 
-	statement := db.Statement
-	if statement == nil || statement.Schema == nil {
+	// Verificar que tenemos el statement y schema
+	sch := h.schemaOf(db)
+	if sch == nil || sch.PrioritizedPrimaryField == nil {
 		return
 	}
 
-	tableName := statement.Schema.Table
-
-	// Extraer datos actualizados
-	data := make(map[string]interface{})
+	tableName := sch.Table
+	if isInternalTable(tableName) {
+		return
+	}
 
-	// Si se usó Updates() con un map, los datos están en statement.Dest
-	if destMap, ok := statement.Dest.(map[string]interface{}); ok {
-		// Usar directamente los campos del map que se pasaron a Updates()
-		for k, v := range destMap {
-			cleanValue := sanitizeValue(v)
-			if cleanValue != nil {
-				data[k] = cleanValue
-			}
+	keys := primaryKeysOf(db.Statement, sch)
+	if len(keys) == 0 {
+		affected, found := db.InstanceGet(affectedKeysKey)
+		if !found {
+			logging.FromContext(db.Statement.Context).Warn("Write without primary key or condition, change not replicated", "operation", operation, "table", tableName)
+			return
 		}
-		log.Printf("[ReplicationHook] UPDATE using map with %d fields", len(data))
-	} else {
-		// Si se usó Save() o Updates() con struct, extraer TODOS los campos
-		for _, field := range statement.Schema.Fields {
-			if field.Readable && field.DBName != "" && field.DBName != "id" {
-				// Para campos con serializador JSON, obtener el valor real del struct
-				var value interface{}
-				if field.Serializer != nil {
-					// Campo serializado: obtener el valor directamente del struct
-					fieldValue := statement.ReflectValue.FieldByName(field.Name)
-					if fieldValue.IsValid() && fieldValue.CanInterface() {
-						value = fieldValue.Interface()
-						log.Printf("[ReplicationHook] Field %s (serialized, type: %T)", field.DBName, value)
-					} else {
-						log.Printf("[ReplicationHook] ⚠️ Cannot access serialized field %s", field.DBName)
-						continue
-					}
-				} else {
-					// Campo normal: usar ValueOf
-					value, _ = field.ValueOf(db.Statement.Context, statement.ReflectValue)
-					log.Printf("[ReplicationHook] Field %s (type: %T)", field.DBName, value)
-				}
-
-				// No filtrar por isZero porque Save() guarda todo
-				cleanValue := sanitizeValue(value)
-				if cleanValue != nil {
-					data[field.DBName] = cleanValue
-					log.Printf("[ReplicationHook] ✓ Added field %s to replication data", field.DBName)
-				} else {
-					log.Printf("[ReplicationHook] ⚠️ Field %s returned nil after sanitization (type: %T)", field.DBName, value)
-				}
-			}
-		}
-		log.Printf("[ReplicationHook] UPDATE using struct with %d fields", len(data))
+		keys = affected.([]interface{})
+	}
+	if len(keys) == 0 {
+		return
 	}
 
-	// Siempre incluir updated_at
-	data["updated_at"] = time.Now().Format(time.RFC3339)
+	rows, err := captureRows(db, sch, keys)
+	if err != nil {
+		db.AddError(err)
+		return
+	}
 
-	// Obtener el ID del registro actualizado
-	var recordID uint
-	if idField := statement.Schema.PrioritizedPrimaryField; idField != nil {
-		value, _ := idField.ValueOf(db.Statement.Context, statement.ReflectValue)
-		if id, ok := value.(uint); ok {
-			recordID = id
+	changes := make([]Change, 0, len(keys))
+	for _, key := range keys {
+		row, exists := rows[fmt.Sprint(key)]
+		if !exists && operation != "DELETE" {
+			logging.FromContext(db.Statement.Context).Warn("Row not found after write, change not replicated", "key", key, "table", tableName, "operation", operation)
+			continue
 		}
+
+		// Un DELETE sin imagen es un borrado físico; con imagen, un borrado lógico
+		changes = append(changes, Change{
+			Operation: operation,
+			Table:     tableName,
+			RecordID:  recordIDOf(key),
+			Data:      row,
+		})
 	}
 
-	log.Printf("[ReplicationHook] 📝 Captured UPDATE on %s (ID=%d): %v", tableName, recordID, data)
+	h.record(db, changes)
+}
 
-	// Replicar de forma asíncrona
-	go func() {
-		h.ClusterState.ReplicateToFollowers("UPDATE", tableName, data, recordID)
-		log.Printf("[ReplicationHook] ✓ Replicated UPDATE on %s (ID=%d) to followers", tableName, recordID)
-	}()
+// beginRaw abre una transacción para las sentencias db.Exec que se replican, así la
+// sentencia y su entrada en el log se confirman juntas
+func (h *ReplicationHook) beginRaw(db *gorm.DB) {
+	if h.ClusterState.IsLeader() && isReplicatedSQL(db.Statement.SQL.String()) {
+		callbacks.BeginTransaction(db)
+	}
 }
 
-// afterDelete se ejecuta después de cada DELETE
-func (h *ReplicationHook) afterDelete(db *gorm.DB) {
-	// Solo replicar si somos el líder
-	if !h.ClusterState.IsLeader() {
+// afterRaw registra en el log una sentencia db.Exec que modificó datos. No se sabe qué
+// filas tocó, así que se replica la sentencia con sus parámetros.
+func (h *ReplicationHook) afterRaw(db *gorm.DB) {
+	// Transacciones anidadas: al volver a un punto de guardado se descartan los
+	// cambios acumulados desde entonces
+	if tx, ok := db.Statement.ConnPool.(*replicatedTx); ok && db.Error == nil {
+		tx.trackSavepoint(db.Statement.SQL.String())
+	}
+
+	if !h.ClusterState.IsLeader() || db.Error != nil || db.RowsAffected == 0 {
 		return
 	}
 
-	// Verificar que no hubo error
-	if db.Error != nil {
+	sql := db.Statement.SQL.String()
+	if !isReplicatedSQL(sql) {
 		return
 	}
 
-	statement := db.Statement
-	if statement == nil || statement.Schema == nil {
+	statement, err := newSQLStatement(sql, db.Statement.Vars)
+	if err != nil {
+		db.AddError(err)
 		return
 	}
 
-	tableName := statement.Schema.Table
+	h.record(db, []Change{{Operation: "EXEC", Statement: &statement}})
+}
 
-	// Obtener el ID del registro eliminado
-	var recordID uint
-	if idField := statement.Schema.PrioritizedPrimaryField; idField != nil {
-		value, _ := idField.ValueOf(db.Statement.Context, statement.ReflectValue)
-		if id, ok := value.(uint); ok {
-			recordID = id
-		}
+// record agrega los cambios a la transacción en curso, que los escribe en el log al
+// confirmarse. Fuera de una transacción (SkipDefaultTransaction) se registran de
+// inmediato; si no se pueden registrar, la escritura falla en lugar de quedar sin replicar.
+func (h *ReplicationHook) record(db *gorm.DB, changes []Change) {
+	if len(changes) == 0 {
+		return
 	}
 
-	// Para soft delete, enviar el timestamp
-	data := map[string]interface{}{
-		"deleted_at": time.Now(),
+	if tx, ok := db.Statement.ConnPool.(*replicatedTx); ok {
+		tx.changes = append(tx.changes, changes...)
+		return
 	}
 
-	log.Printf("[ReplicationHook] 📝 Captured DELETE on %s (ID=%d)", tableName, recordID)
-
-	// Replicar de forma asíncrona
-	go func() {
-		h.ClusterState.ReplicateToFollowers("DELETE", tableName, data, recordID)
-		log.Printf("[ReplicationHook] ✓ Replicated DELETE on %s (ID=%d) to followers", tableName, recordID)
-	}()
+	index, err := h.ClusterState.AppendToLog(db, changes)
+	if err != nil {
+		db.AddError(err)
+		return
+	}
+	recordWrite(db.Statement.Context, index)
+	logging.FromContext(db.Statement.Context).Info("Logged changes", "changes", len(changes), "index", index)
+	h.ClusterState.NotifyReplicators()
 }
 
-// sanitizeValue convierte valores complejos a tipos serializables en JSON
-func sanitizeValue(value interface{}) interface{} {
-	if value == nil {
+// schemaOf retorna el esquema de la tabla de la operación; para db.Table(...) sin
+// modelo se usa el modelo registrado para esa tabla
+func (h *ReplicationHook) schemaOf(db *gorm.DB) *schema.Schema {
+	if db.Statement == nil {
 		return nil
 	}
-
-	switch v := value.(type) {
-	case string, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64, bool:
-		// Tipos primitivos se devuelven directamente
-		return v
-	case time.Time:
-		// Convertir time.Time a string ISO
-		return v.Format(time.RFC3339)
-	case []byte:
-		// Bytes pueden ser JSON serializado por GORM, intentar deserializar
-		if len(v) == 0 {
-			return nil
-		}
-		var jsonData interface{}
-		if err := json.Unmarshal(v, &jsonData); err == nil {
-			log.Printf("[sanitizeValue] ✓ Deserialized []byte to JSON: %v", jsonData)
-			return jsonData
-		}
-		// Si no es JSON válido, devolver como string
-		return string(v)
-	case []string:
-		return v
-	case []int:
-		return v
-	case []uint:
-		return v
-	case []float64:
-		return v
-	case []interface{}:
-		// Slice de interfaces (pueden ser arrays JSON)
-		log.Printf("[sanitizeValue] ✓ Found []interface{} with %d elements", len(v))
-		return v
-	case []map[string]interface{}:
-		// Slice de mapas (experience, education, etc.)
-		log.Printf("[sanitizeValue] ✓ Found []map[string]interface{} with %d elements", len(v))
-		return v
-	case map[string]interface{}:
-		// Map genérico
-		return v
-	default:
-		// Para otros tipos complejos, intentar serializar como JSON
-		// Esto captura structs, slices de structs, etc.
-		log.Printf("[sanitizeValue] Attempting to serialize type %T", v)
-		jsonBytes, err := json.Marshal(v)
-		if err != nil {
-			log.Printf("[sanitizeValue] ❌ Cannot serialize value of type %T: %v", v, err)
-			return nil
-		}
-
-		// Deserializar de nuevo para obtener un tipo nativo de Go
-		var jsonData interface{}
-		if err := json.Unmarshal(jsonBytes, &jsonData); err != nil {
-			log.Printf("[sanitizeValue] ❌ Cannot deserialize JSON: %v", err)
-			return nil
-		}
-
-		log.Printf("[sanitizeValue] ✓ Serialized type %T to: %v", v, jsonData)
-		return jsonData
+	if db.Statement.Schema != nil {
+		return db.Statement.Schema
+	}
+	if db.Statement.Table == "" {
+		return nil
+	}
+	sch, err := h.ClusterState.schemaForTable(db.Statement.Table)
+	if err != nil {
+		return nil
 	}
+	return sch
 }
@@ -0,0 +1,249 @@
+package cluster
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metricsNamespace es el prefijo de todas las métricas de la aplicación
+const metricsNamespace = "talentnest"
+
+// metricsRegistry guarda las métricas que expone /metrics
+var metricsRegistry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "HTTP requests handled by this node, by method, route and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Time to handle an HTTP request, by method and route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	leaderChanges = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "cluster",
+		Name:      "leader_changes_total",
+		Help:      "Times this node learned of a new leader (including itself).",
+	})
+
+	replicationSent = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "replication",
+		Name:      "messages_sent_total",
+		Help:      "Replication messages sent by the leader, by follower.",
+	}, []string{"follower"})
+
+	replicationFailed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "replication",
+		Name:      "messages_failed_total",
+		Help:      "Replication messages the follower did not apply or answer, by follower.",
+	}, []string{"follower"})
+
+	replicationAcked = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "replication",
+		Name:      "messages_applied_total",
+		Help:      "Replication messages the follower confirmed as applied, by follower.",
+	}, []string{"follower"})
+
+	replicationApplied = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "replication",
+		Name:      "entries_applied_total",
+		Help:      "Replication log entries applied locally by this follower.",
+	})
+
+	syncDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "sync",
+		Name:      "duration_seconds",
+		Help:      "Time to synchronize with the leader, by mode and result.",
+		Buckets:   []float64{0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+	}, []string{"mode", "result"})
+
+	syncBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "sync",
+		Name:      "received_bytes_total",
+		Help:      "Bytes received from the leader while synchronizing, by mode.",
+	}, []string{"mode"})
+
+	forwardedRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "proxy",
+		Name:      "forwarded_requests_total",
+		Help:      "Client requests forwarded to another node, by target and status code (error if it did not answer).",
+	}, []string{"target", "status"})
+
+	forwardRetries = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "proxy",
+		Name:      "forward_retries_total",
+		Help:      "Forwarded requests retried against a new leader.",
+	})
+)
+
+func init() {
+	metricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests, httpDuration, leaderChanges,
+		replicationSent, replicationFailed, replicationAcked, replicationApplied,
+		syncDuration, syncBytes, forwardedRequests, forwardRetries,
+	)
+}
+
+// Metrics middleware cuenta las peticiones HTTP y su duración por ruta. La ruta es el
+// patrón registrado (/api/v1/posts/:id), no el path, para acotar las series; las
+// peticiones sin ruta se agrupan en "unmatched".
+func Metrics(clusterState *ClusterState) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		// Fiber reutiliza el buffer del método: copiarlo antes de guardarlo como etiqueta
+		method := strings.Clone(c.Method())
+		route := clusterState.routePattern(method, c.Path())
+
+		// Aplicar el error handler aquí para registrar el status que recibe el cliente
+		if err := c.Next(); err != nil {
+			if err := c.App().Config().ErrorHandler(c, err); err != nil {
+				return err
+			}
+		}
+
+		status := strconv.Itoa(c.Response().StatusCode())
+		httpRequests.WithLabelValues(method, route, status).Inc()
+		httpDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+		return nil
+	}
+}
+
+// MetricsHandler atiende /metrics en el formato de Prometheus. Las métricas del estado
+// del cluster y de la base de datos se calculan al consultarlas.
+func (cs *ClusterState) MetricsHandler() fiber.Handler {
+	metricsRegistry.MustRegister(&clusterCollector{cs: cs})
+	return adaptor.HTTPHandler(promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{}))
+}
+
+var (
+	termDesc = prometheus.NewDesc(metricsNamespace+"_cluster_term",
+		"Current election term.", nil, nil)
+	leaderDesc = prometheus.NewDesc(metricsNamespace+"_cluster_leader",
+		"Current leader known by this node (always 1, the ID is in the label).", []string{"leader_id"}, nil)
+	isLeaderDesc = prometheus.NewDesc(metricsNamespace+"_cluster_is_leader",
+		"1 if this node is the leader.", nil, nil)
+	nodesDesc = prometheus.NewDesc(metricsNamespace+"_cluster_nodes",
+		"Known nodes by membership state.", []string{"state"}, nil)
+	lastIndexDesc = prometheus.NewDesc(metricsNamespace+"_replication_last_index",
+		"Last entry of the local replication log.", nil, nil)
+	lagDesc = prometheus.NewDesc(metricsNamespace+"_replication_lag_entries",
+		"Entries a node is behind the leader (each follower on the leader, this node on followers).", []string{"node"}, nil)
+	tableRowsDesc = prometheus.NewDesc(metricsNamespace+"_db_table_rows",
+		"Rows per replicated table and in the replication log.", []string{"table"}, nil)
+	dbSizeDesc = prometheus.NewDesc(metricsNamespace+"_db_size_bytes",
+		"Size of the local database.", nil, nil)
+	schemaVersionDesc = prometheus.NewDesc(metricsNamespace+"_db_schema_version",
+		"Last schema migration applied to the local database and last one known by this binary.", []string{"source"}, nil)
+)
+
+// clusterCollector lee el estado del cluster y de la base de datos en cada consulta
+type clusterCollector struct {
+	cs *ClusterState
+}
+
+func (collector *clusterCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{termDesc, leaderDesc, isLeaderDesc, nodesDesc,
+		lastIndexDesc, lagDesc, tableRowsDesc, dbSizeDesc, schemaVersionDesc} {
+		ch <- desc
+	}
+}
+
+func (collector *clusterCollector) Collect(ch chan<- prometheus.Metric) {
+	cs := collector.cs
+	db := cs.getDB()
+
+	var lastIndex uint64
+	if db != nil {
+		lastIndex = LastLogIndex(db)
+	}
+
+	cs.mu.RLock()
+	nodeID, role, term, leaderID, leaderIndex := cs.CurrentNodeID, cs.CurrentRole, cs.CurrentTerm, cs.LeaderID, cs.leaderLastIndex
+	appliedSchema, knownSchema := cs.appliedSchemaVersion, cs.codeSchemaVersion
+	states := make(map[MemberState]int)
+	for _, node := range cs.Nodes {
+		states[node.State]++
+	}
+	tables := []string{ReplicationLogEntry{}.TableName()}
+	for table := range cs.schemas {
+		tables = append(tables, table)
+	}
+	cs.mu.RUnlock()
+
+	ch <- prometheus.MustNewConstMetric(termDesc, prometheus.GaugeValue, float64(term))
+	if leaderID != "" {
+		ch <- prometheus.MustNewConstMetric(leaderDesc, prometheus.GaugeValue, 1, leaderID)
+	}
+	isLeader := 0.0
+	if role == Leader {
+		isLeader = 1
+	}
+	ch <- prometheus.MustNewConstMetric(isLeaderDesc, prometheus.GaugeValue, isLeader)
+	for state, count := range states {
+		ch <- prometheus.MustNewConstMetric(nodesDesc, prometheus.GaugeValue, float64(count), string(state))
+	}
+
+	ch <- prometheus.MustNewConstMetric(schemaVersionDesc, prometheus.GaugeValue, float64(appliedSchema), "database")
+	ch <- prometheus.MustNewConstMetric(schemaVersionDesc, prometheus.GaugeValue, float64(knownSchema), "binary")
+
+	ch <- prometheus.MustNewConstMetric(lastIndexDesc, prometheus.GaugeValue, float64(lastIndex))
+	if role == Leader {
+		for id, lag := range cs.replicationLags(lastIndex) {
+			ch <- prometheus.MustNewConstMetric(lagDesc, prometheus.GaugeValue, float64(lag), id)
+		}
+	} else if leaderID != "" {
+		ch <- prometheus.MustNewConstMetric(lagDesc, prometheus.GaugeValue, float64(lagBehind(leaderIndex, lastIndex)), nodeID)
+	}
+
+	if db == nil {
+		return
+	}
+	for _, table := range tables {
+		var rows int64
+		if err := db.Table(table).Count(&rows).Error; err == nil {
+			ch <- prometheus.MustNewConstMetric(tableRowsDesc, prometheus.GaugeValue, float64(rows), table)
+		}
+	}
+	var pageCount, pageSize int64
+	if db.Raw("PRAGMA page_count").Scan(&pageCount).Error == nil && db.Raw("PRAGMA page_size").Scan(&pageSize).Error == nil {
+		ch <- prometheus.MustNewConstMetric(dbSizeDesc, prometheus.GaugeValue, float64(pageCount*pageSize))
+	}
+}
+
+// countingReader cuenta los bytes leídos de otro reader
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.count += int64(n)
+	return n, err
+}
@@ -1,63 +1,53 @@
 package cluster
 
 import (
-	"bytes"
-	"io"
+	"strings"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/theleywin/Backend-Talent-Nest/src/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// ReplicationMiddleware intercepta peticiones de escritura y las redirige al líder si es necesario
+// ReplicationMiddleware envía al líder las peticiones a rutas declaradas como
+// LeaderOnly; las de solo lectura y las locales las atiende cualquier nodo. Con una
+// base de datos compartida cualquier nodo atiende también las escrituras.
 func ReplicationMiddleware(clusterState *ClusterState) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		method := c.Method()
-		path := c.Path()
-
-		// Permitir endpoints del cluster siempre
-		if isClusterEndpoint(path) {
+		if clusterState.routeClass(c.Method(), c.Path()) != RouteLeaderOnly {
 			return c.Next()
 		}
 
-		// Permitir operaciones de lectura en cualquier nodo
-		if method == "GET" || method == "HEAD" || method == "OPTIONS" {
-			return c.Next()
+		// Un nodo en mantenimiento no recibe escrituras: el cliente debe usar otro nodo
+		if clusterState.InMaintenance() {
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+				"error":   "Node in maintenance",
+				"message": "This node is in maintenance mode and does not accept writes",
+			})
 		}
 
-		// Permitir operaciones de solo lectura (login, logout) en cualquier nodo
-		if isReadOnlyOperation(path) {
+		if clusterState.SharedDatabase() {
 			return c.Next()
 		}
 
-		// Operaciones de escritura (POST, PUT, DELETE, PATCH)
-		if isWriteOperation(method) {
-			// Si este nodo es el líder, procesar normalmente
-			if clusterState.IsLeader() {
-				return c.Next()
-			}
-
-			// Si este nodo es seguidor, redirigir al líder
-			return forwardToLeader(c, clusterState)
+		// Si este nodo es el líder, procesar y esperar las confirmaciones requeridas
+		if clusterState.IsLeader() {
+			return processLeaderWrite(c, clusterState)
 		}
 
-		// Por defecto, continuar
-		return c.Next()
+		// Si este nodo es seguidor, reenviar la escritura al líder o indicarle al
+		// cliente a dónde enviarla (CLUSTER_WRITE_MODE)
+		return routeToLeader(c, clusterState)
 	}
 }
 
 // isClusterEndpoint verifica si el path es un endpoint del cluster
+// (incluye rutas con parámetros como /cluster/sync/:snapshotId/chunks/:index).
+// Fiber compara las rutas sin distinguir mayúsculas: /CLUSTER/replicate llega al mismo
+// handler, así que la comparación tampoco las distingue.
 func isClusterEndpoint(path string) bool {
-	clusterPaths := []string{
-		"/cluster/status",
-		"/cluster/replicate",
-		"/cluster/sync",
-	}
-
-	for _, cp := range clusterPaths {
-		if path == cp {
-			return true
-		}
-	}
-	return false
+	return strings.HasPrefix(strings.ToLower(path), "/cluster/")
 }
 
 // isWriteOperation verifica si el método HTTP es una operación de escritura
@@ -71,92 +61,133 @@ func isWriteOperation(method string) bool {
 	return false
 }
 
-// isReadOnlyOperation identifica operaciones POST que no modifican la base de datos
-func isReadOnlyOperation(path string) bool {
-	readOnlyPaths := []string{
-		"/api/v1/auth/login",  // Autenticación, no crea/modifica datos
-		"/api/v1/auth/logout", // Solo limpia sesión, no modifica DB
+// processLeaderWrite ejecuta la escritura en el líder, informa la posición del log en
+// ReplicationPositionHeader y, según el write concern, espera a que los seguidores
+// confirmen las entradas del log antes de responder
+func processLeaderWrite(c *fiber.Ctx, clusterState *ClusterState) error {
+	// Un líder que se está apagando no acepta escrituras nuevas: las que ya están en
+	// curso terminan y se replican antes de ceder el liderazgo
+	if !clusterState.beginWrite() {
+		c.Set(fiber.HeaderRetryAfter, "1")
+		c.Set(notProcessedHeader, "1")
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error":   "Leader is shutting down",
+			"message": "The leader is handing off leadership, retry the write shortly",
+		})
 	}
+	defer clusterState.endWrite()
 
-	for _, rop := range readOnlyPaths {
-		if path == rop {
-			return true
-		}
+	// Las transacciones de la petición registran en su contexto las entradas que escriben
+	ctx, writes := trackWrites(c.UserContext())
+	c.SetUserContext(ctx)
+
+	if err := c.Next(); err != nil {
+		return err
 	}
-	return false
-}
 
-// forwardToLeader redirige la petición al líder
-func forwardToLeader(c *fiber.Ctx, clusterState *ClusterState) error {
-	leaderAddress := clusterState.GetLeaderAddress()
-	if leaderAddress == "" {
-		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
-			"error":   "No leader available",
-			"message": "The cluster has no active leader to process write operations",
-		})
+	// Solo una escritura que terminó bien informa su posición y espera a los seguidores:
+	// una respuesta de error no debe cambiar a 503 ni hacer esperar al cliente
+	index := writes.lastWrite()
+	status := c.Response().StatusCode()
+	if index == 0 || status < fiber.StatusOK || status >= fiber.StatusMultipleChoices {
+		return nil
+	}
+	c.Set(ReplicationPositionHeader, FormatReplicationPosition(index))
+
+	if clusterState.GetWriteConcern() == WriteConcernAsync {
+		return nil
 	}
 
-	// Extraer headers relevantes
-	headers := make(map[string]string)
-	c.Request().Header.VisitAll(func(key, value []byte) {
-		headers[string(key)] = string(value)
-	})
-
-	// Leer el body
-	bodyBytes := c.Body()
-	bodyReader := bytes.NewReader(bodyBytes)
-
-	// Hacer forward al líder
-	resp, err := clusterState.ForwardToLeader(
-		c.Method(),
-		c.Path(),
-		bodyReader,
-		headers,
+	// La espera por las confirmaciones de los seguidores es un span propio de la petición
+	_, span := tracing.Tracer().Start(c.UserContext(), "cluster.wait_replication",
+		trace.WithAttributes(
+			attribute.Int64("replication.index", int64(index)),
+			attribute.String("replication.write_concern", string(clusterState.GetWriteConcern())),
+		),
 	)
+	err := clusterState.WaitForReplication(index, writeConcernTimeout())
 	if err != nil {
-		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
-			"error":   "Failed to forward to leader",
-			"message": err.Error(),
-		})
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 	}
-	defer resp.Body.Close()
+	span.End()
 
-	// Copiar la respuesta del líder
-	responseBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   "Failed to read leader response",
-			"message": err.Error(),
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error":   "Write not acknowledged by followers",
+			"message": "The write was applied on the leader but not confirmed by the required followers (" + err.Error() + ")",
 		})
 	}
 
-	// Copiar status code y headers
-	c.Status(resp.StatusCode)
-	for key, values := range resp.Header {
-		for _, value := range values {
-			c.Set(key, value)
-		}
+	return nil
+}
+
+// forwardToLeader redirige la petición al líder
+func forwardToLeader(c *fiber.Ctx, clusterState *ClusterState) error {
+	leaderAddress := clusterState.GetLeaderAddress()
+	if leaderAddress == "" {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error":   "No leader available",
+			"message": "The cluster has no active leader to process write operations",
+		})
 	}
 
-	return c.Send(responseBody)
+	return proxyRequest(c, clusterState, leaderAddress, "leader")
 }
 
-// ReadinessCheck middleware verifica que el nodo esté listo
+// ReadinessCheck middleware verifica que el nodo esté listo. Mientras se sincroniza,
+// las peticiones que aún le llegan (el balanceador deja de enviarlas al fallar /readyz)
+// se reenvían al líder.
 func ReadinessCheck(clusterState *ClusterState) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		// Permitir siempre endpoints del cluster
-		if isClusterEndpoint(c.Path()) {
+		// Permitir siempre endpoints del cluster y de salud
+		if isClusterEndpoint(c.Path()) || isHealthEndpoint(c.Path()) {
+			return c.Next()
+		}
+
+		if clusterState.IsNodeReady() {
 			return c.Next()
 		}
 
-		// Verificar que el nodo esté listo
-		if !clusterState.IsNodeReady() {
+		// El líder no está listo mientras aplica las migraciones del esquema
+		if clusterState.IsLeader() {
+			c.Set(fiber.HeaderRetryAfter, "1")
+			c.Set(notProcessedHeader, "1")
 			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
 				"error":   "Node not ready",
-				"message": "This node is still synchronizing data from the leader",
+				"message": "The leader is applying schema migrations, retry the request shortly",
 			})
 		}
 
-		return c.Next()
+		if clusterState.GetLeaderAddress() != "" {
+			return forwardToLeader(c, clusterState)
+		}
+
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error":   "Node not ready",
+			"message": "This node is still synchronizing data from the leader",
+		})
+	}
+}
+
+// ReadYourWrites middleware garantiza que un cliente lea sus propias escrituras en un
+// seguidor: si la lectura trae ReplicationPositionHeader y el nodo no aplicó esa
+// posición, espera un momento y, si no la alcanza, reenvía la lectura al líder
+func ReadYourWrites(clusterState *ClusterState) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if isClusterEndpoint(c.Path()) || isWriteOperation(c.Method()) || clusterState.IsLeader() || clusterState.SharedDatabase() {
+			return c.Next()
+		}
+
+		position, ok := ParseReplicationPosition(c.Get(ReplicationPositionHeader))
+		if !ok {
+			return c.Next()
+		}
+
+		if clusterState.WaitForApplied(position, readWaitTimeout()) {
+			return c.Next()
+		}
+
+		return forwardToLeader(c, clusterState)
 	}
 }
@@ -0,0 +1,89 @@
+package cluster
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestProcessLeaderWriteWaitsForOwnEntry(t *testing.T) {
+	t.Setenv("CLUSTER_WRITE_TIMEOUT", "50ms")
+
+	cs := newTestClusterState(t)
+	cs.CurrentRole = Leader
+	cs.WriteConcern = WriteConcernOne
+	cs.matchIndex["node-b"] = 5
+
+	// Una escritura de otra petición mueve el final del log mientras se atiende esta
+	concurrentWrite := func() {
+		if _, err := cs.AppendToLog(cs.db.WithContext(context.Background()), nil); err != nil {
+			t.Errorf("appending concurrent entry: %v", err)
+		}
+	}
+
+	app := fiber.New()
+	app.Use(ReplicationMiddleware(cs))
+	app.Post("/acked", func(c *fiber.Ctx) error {
+		recordWrite(c.UserContext(), 3)
+		return c.SendStatus(fiber.StatusCreated)
+	})
+	app.Post("/unacked", func(c *fiber.Ctx) error {
+		recordWrite(c.UserContext(), 9)
+		return c.SendStatus(fiber.StatusCreated)
+	})
+	app.Post("/failed", func(c *fiber.Ctx) error {
+		recordWrite(c.UserContext(), 9)
+		return c.SendStatus(fiber.StatusBadRequest)
+	})
+	app.Post("/no-write", func(c *fiber.Ctx) error {
+		concurrentWrite()
+		return c.SendStatus(fiber.StatusCreated)
+	})
+
+	tests := []struct {
+		path     string
+		status   int
+		position string
+	}{
+		{path: "/acked", status: fiber.StatusCreated, position: "3"},
+		{path: "/unacked", status: fiber.StatusServiceUnavailable, position: "9"},
+		{path: "/failed", status: fiber.StatusBadRequest},
+		{path: "/no-write", status: fiber.StatusCreated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			resp, err := app.Test(httptest.NewRequest(http.MethodPost, tt.path, nil), -1)
+			if err != nil {
+				t.Fatalf("sending request: %v", err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+			if position := resp.Header.Get(ReplicationPositionHeader); position != tt.position {
+				t.Errorf("%s = %q, want %q", ReplicationPositionHeader, position, tt.position)
+			}
+		})
+	}
+}
+
+func TestRecordWriteKeepsLastEntry(t *testing.T) {
+	ctx, writes := trackWrites(context.Background())
+	for _, index := range []uint64{4, 7, 5} {
+		recordWrite(ctx, index)
+	}
+	if got := writes.lastWrite(); got != 7 {
+		t.Errorf("lastWrite() = %d, want 7", got)
+	}
+
+	// Las escrituras fuera de una petición del líder no se registran en ninguna
+	recordWrite(context.Background(), 10)
+	if got := writes.lastWrite(); got != 7 {
+		t.Errorf("lastWrite() = %d, want 7", got)
+	}
+}
@@ -0,0 +1,453 @@
+package cluster
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// schemaMigrationsTable guarda las migraciones aplicadas en la base de datos local
+const schemaMigrationsTable = "schema_migrations"
+
+// Direcciones de una migración replicada
+const (
+	MigrationUp   = "up"
+	MigrationDown = "down"
+)
+
+// migrationFileName reconoce los archivos NNNN_nombre.up.sql y NNNN_nombre.down.sql
+var migrationFileName = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Migration es una versión numerada del esquema: el SQL que la aplica y el que la revierte
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string // Vacío si la migración no se puede revertir
+}
+
+// SchemaChange es una migración aplicada o revertida por el líder. Se replica como un
+// cambio del log con el SQL que ejecutó el líder, así cada seguidor deja su esquema
+// igual aunque su binario no conozca esa versión.
+type SchemaChange struct {
+	Version   int       `json:"version"`
+	Name      string    `json:"name"`
+	Direction string    `json:"direction"` // up, down
+	SQL       string    `json:"sql"`
+	AppliedAt time.Time `json:"applied_at"` // Momento en que la aplicó el líder
+}
+
+// SchemaMigration es una migración aplicada en la base de datos local
+type SchemaMigration struct {
+	Version   int       `gorm:"primaryKey;autoIncrement:false" json:"version"`
+	Name      string    `gorm:"not null" json:"name"`
+	AppliedAt time.Time `json:"applied_at"`
+}
+
+// TableName define el nombre de la tabla de migraciones aplicadas
+func (SchemaMigration) TableName() string {
+	return schemaMigrationsTable
+}
+
+// MigrationStatus es el estado de una migración en este nodo
+type MigrationStatus struct {
+	Version    int        `json:"version"`
+	Name       string     `json:"name"`
+	Applied    bool       `json:"applied"`
+	AppliedAt  *time.Time `json:"applied_at,omitempty"`
+	Known      bool       `json:"known"`      // El binario del nodo incluye la migración
+	Reversible bool       `json:"reversible"` // Tiene SQL para revertirla
+}
+
+// LoadMigrations lee las migraciones de fsys ordenadas por versión. Las versiones
+// deben ser consecutivas desde 1 y cada una debe tener su archivo up.
+func LoadMigrations(fsys fs.FS) ([]Migration, error) {
+	files, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, file := range files {
+		match := migrationFileName.FindStringSubmatch(file)
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %s (expected NNNN_name.up.sql or NNNN_name.down.sql)", file)
+		}
+		version, _ := strconv.Atoi(match[1])
+		if version == 0 {
+			return nil, fmt.Errorf("invalid migration version in %s: versions start at 1", file)
+		}
+
+		content, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, fmt.Errorf("error reading migration %s: %v", file, err)
+		}
+
+		migration, exists := byVersion[version]
+		if !exists {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has files with different names (%s and %s)", version, migration.Name, match[2])
+		}
+		if match[3] == MigrationUp {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	for i, migration := range migrations {
+		if migration.Version != i+1 {
+			return nil, fmt.Errorf("missing migration %d", i+1)
+		}
+		if migration.Up == "" {
+			return nil, fmt.Errorf("migration %d (%s) has no up file", migration.Version, migration.Name)
+		}
+	}
+	return migrations, nil
+}
+
+// SetMigrations registra las migraciones que conoce el binario y lee la versión del
+// esquema de la base de datos local. Un nodo cuyo binario es anterior al esquema no
+// puede ser líder.
+func (cs *ClusterState) SetMigrations(db *gorm.DB, migrations []Migration) error {
+	applied, err := AppliedSchemaVersion(db)
+	if err != nil {
+		return err
+	}
+
+	cs.mu.Lock()
+	cs.migrations = migrations
+	cs.codeSchemaVersion = 0
+	if len(migrations) > 0 {
+		cs.codeSchemaVersion = migrations[len(migrations)-1].Version
+	}
+	cs.appliedSchemaVersion = applied
+	code := cs.codeSchemaVersion
+	cs.mu.Unlock()
+
+	slog.Info("Schema version", "applied", applied, "known", code)
+	if code < applied {
+		slog.Warn("Database schema is newer than this binary: the node will not take leadership", "applied", applied, "known", code)
+	}
+	return nil
+}
+
+// AppliedSchemaVersion retorna la última migración aplicada en la base de datos (0 si ninguna)
+func AppliedSchemaVersion(db *gorm.DB) (int, error) {
+	var version int
+	err := db.Model(&SchemaMigration{}).Select("COALESCE(MAX(version), 0)").Scan(&version).Error
+	if err != nil {
+		return 0, fmt.Errorf("error reading schema version: %v", err)
+	}
+	return version, nil
+}
+
+// refreshSchemaVersion vuelve a leer la versión del esquema de la base de datos local
+func (cs *ClusterState) refreshSchemaVersion(db *gorm.DB) {
+	applied, err := AppliedSchemaVersion(db)
+	if err != nil {
+		slog.Error("Error reading schema version", "error", err)
+		return
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.setAppliedSchemaVersionUnsafe(applied)
+}
+
+// setAppliedSchemaVersionUnsafe registra la versión del esquema de la base de datos y
+// avisa si es posterior al binario (usar solo con lock)
+func (cs *ClusterState) setAppliedSchemaVersionUnsafe(applied int) {
+	if applied == cs.appliedSchemaVersion {
+		return
+	}
+	cs.appliedSchemaVersion = applied
+	if cs.codeSchemaVersion < applied {
+		slog.Warn("Database schema is newer than this binary: the node will not take leadership", "applied", applied, "known", cs.codeSchemaVersion)
+	}
+}
+
+// SchemaVersions retorna la versión del esquema de la base de datos local y la última
+// que conoce el binario
+func (cs *ClusterState) SchemaVersions() (applied, known int) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	return cs.appliedSchemaVersion, cs.codeSchemaVersion
+}
+
+// schemaOutdatedUnsafe indica si el binario es anterior al esquema de la base de datos
+// (usar solo con lock)
+func (cs *ClusterState) schemaOutdatedUnsafe() bool {
+	return cs.codeSchemaVersion < cs.appliedSchemaVersion
+}
+
+// minLeaderSchemaVersionUnsafe retorna la versión del esquema que debe conocer un
+// líder: la aplicada en el cluster y la de este binario, para que las migraciones
+// nuevas lleguen en cuanto lidere un nodo actualizado (usar solo con lock)
+func (cs *ClusterState) minLeaderSchemaVersionUnsafe() int {
+	if cs.codeSchemaVersion > cs.appliedSchemaVersion {
+		return cs.codeSchemaVersion
+	}
+	return cs.appliedSchemaVersion
+}
+
+// migrateAsLeader aplica las migraciones pendientes al asumir el liderazgo. Hasta
+// terminar el líder no está listo; si una migración falla se reintenta mientras siga
+// siendo líder en el mismo término.
+func (cs *ClusterState) migrateAsLeader(term uint64) {
+	for {
+		cs.mu.RLock()
+		current := cs.CurrentRole == Leader && cs.CurrentTerm == term
+		cs.mu.RUnlock()
+		if !current {
+			return
+		}
+
+		err := cs.ApplyPendingMigrations()
+		if err == nil || errors.Is(err, ErrNotLeader) {
+			cs.mu.Lock()
+			cs.migrationError = ""
+			if err == nil && cs.CurrentRole == Leader && cs.CurrentTerm == term {
+				cs.IsReady = true
+				slog.Info("Schema migrations applied, leader ready", "schema_version", cs.appliedSchemaVersion)
+			}
+			cs.mu.Unlock()
+			return
+		}
+
+		slog.Error("Failed to apply schema migrations, retrying", "error", err)
+		cs.mu.Lock()
+		cs.migrationError = err.Error()
+		cs.mu.Unlock()
+		time.Sleep(baseElectionTimeout())
+	}
+}
+
+// ApplyPendingMigrations aplica en orden las migraciones del binario posteriores al
+// esquema de la base de datos (solo líder)
+func (cs *ClusterState) ApplyPendingMigrations() error {
+	db := cs.getDB()
+	if db == nil {
+		return fmt.Errorf("database not open")
+	}
+
+	applied, err := AppliedSchemaVersion(db)
+	if err != nil {
+		return err
+	}
+
+	cs.mu.RLock()
+	migrations := cs.migrations
+	cs.mu.RUnlock()
+
+	for _, migration := range migrations {
+		if migration.Version <= applied {
+			continue
+		}
+		change := SchemaChange{
+			Version:   migration.Version,
+			Name:      migration.Name,
+			Direction: MigrationUp,
+			SQL:       migration.Up,
+			AppliedAt: time.Now().UTC(),
+		}
+		if err := cs.runSchemaChange(db, change); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RollbackMigration revierte la última migración aplicada y retorna el cambio
+// replicado (solo líder). Al asumir el liderazgo un nodo vuelve a aplicar las
+// migraciones que conoce, así que después se debe desplegar el binario anterior.
+func (cs *ClusterState) RollbackMigration() (SchemaChange, error) {
+	if !cs.IsLeader() {
+		return SchemaChange{}, ErrNotLeader
+	}
+
+	db := cs.getDB()
+	if db == nil {
+		return SchemaChange{}, fmt.Errorf("database not open")
+	}
+
+	applied, err := AppliedSchemaVersion(db)
+	if err != nil {
+		return SchemaChange{}, err
+	}
+	if applied == 0 {
+		return SchemaChange{}, fmt.Errorf("no migrations applied")
+	}
+
+	cs.mu.RLock()
+	var migration *Migration
+	for i := range cs.migrations {
+		if cs.migrations[i].Version == applied {
+			migration = &cs.migrations[i]
+		}
+	}
+	cs.mu.RUnlock()
+
+	if migration == nil {
+		return SchemaChange{}, fmt.Errorf("migration %d is not known by this node", applied)
+	}
+	if migration.Down == "" {
+		return SchemaChange{}, fmt.Errorf("migration %d (%s) cannot be reverted", migration.Version, migration.Name)
+	}
+
+	change := SchemaChange{
+		Version:   migration.Version,
+		Name:      migration.Name,
+		Direction: MigrationDown,
+		SQL:       migration.Down,
+		AppliedAt: time.Now().UTC(),
+	}
+	if err := cs.runSchemaChange(db, change); err != nil {
+		return SchemaChange{}, err
+	}
+	return change, nil
+}
+
+// runSchemaChange ejecuta una migración en el líder y la registra en el log en la
+// misma transacción, para que los seguidores la apliquen en el mismo punto del log.
+// Con una base de datos compartida no se registra: los seguidores ya ven el esquema
+// nuevo y lo conocen por el heartbeat.
+func (cs *ClusterState) runSchemaChange(db *gorm.DB, change SchemaChange) error {
+	if !cs.IsLeader() {
+		return ErrNotLeader
+	}
+	// Cuenta como una escritura: un líder que se apaga espera a que termine
+	if !cs.beginWrite() {
+		return fmt.Errorf("leader is not accepting writes")
+	}
+	defer cs.endWrite()
+
+	var index uint64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := applySchemaChange(tx, &change); err != nil {
+			return err
+		}
+		if cs.SharedDatabase() {
+			return nil
+		}
+
+		var err error
+		index, err = cs.AppendToLog(tx, []Change{{
+			Operation: "MIGRATE",
+			Table:     schemaMigrationsTable,
+			RecordID:  uint(change.Version),
+			Migration: &change,
+		}})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("migration %d (%s) %s failed: %v", change.Version, change.Name, change.Direction, err)
+	}
+
+	cs.refreshSchemaVersion(db)
+	slog.Info("Schema migration applied", "version", change.Version, "name", change.Name, "direction", change.Direction, "index", index)
+	cs.NotifyReplicators()
+	return nil
+}
+
+// applySchemaChange ejecuta el SQL de una migración y actualiza la tabla de migraciones
+// aplicadas. Se envía directamente a la conexión para que los hooks de replicación no
+// registren las sentencias de datos de la migración como cambios propios.
+func applySchemaChange(tx *gorm.DB, change *SchemaChange) error {
+	if change == nil {
+		return fmt.Errorf("MIGRATE entry without migration")
+	}
+
+	conn := tx.Statement.ConnPool
+	ctx := tx.Statement.Context
+	if _, err := conn.ExecContext(ctx, change.SQL); err != nil {
+		return fmt.Errorf("error executing migration %d (%s): %v", change.Version, change.Name, err)
+	}
+
+	// La conexión recibe el SQL tal cual: los parámetros van con el marcador del dialecto
+	bindVar := func(n int) string {
+		if tx.Dialector.Name() == "postgres" {
+			return "$" + strconv.Itoa(n)
+		}
+		return "?"
+	}
+
+	var err error
+	switch change.Direction {
+	case MigrationUp:
+		_, err = conn.ExecContext(ctx, "INSERT INTO "+schemaMigrationsTable+" (version, name, applied_at) VALUES ("+
+			bindVar(1)+", "+bindVar(2)+", "+bindVar(3)+")", change.Version, change.Name, change.AppliedAt)
+	case MigrationDown:
+		_, err = conn.ExecContext(ctx, "DELETE FROM "+schemaMigrationsTable+" WHERE version = "+bindVar(1), change.Version)
+	default:
+		err = fmt.Errorf("unknown migration direction %q", change.Direction)
+	}
+	if err != nil {
+		return fmt.Errorf("error recording migration %d (%s): %v", change.Version, change.Name, err)
+	}
+	return nil
+}
+
+// Migrations retorna el estado de las migraciones que conoce el binario y de las
+// aplicadas en la base de datos local
+func (cs *ClusterState) Migrations() ([]MigrationStatus, error) {
+	db := cs.getDB()
+	if db == nil {
+		return nil, fmt.Errorf("database not open")
+	}
+
+	var applied []SchemaMigration
+	if err := db.Order("version").Find(&applied).Error; err != nil {
+		return nil, fmt.Errorf("error reading applied migrations: %v", err)
+	}
+
+	cs.mu.RLock()
+	statuses := make(map[int]*MigrationStatus, len(cs.migrations))
+	for _, migration := range cs.migrations {
+		statuses[migration.Version] = &MigrationStatus{
+			Version:    migration.Version,
+			Name:       migration.Name,
+			Known:      true,
+			Reversible: migration.Down != "",
+		}
+	}
+	cs.mu.RUnlock()
+
+	for _, migration := range applied {
+		status, exists := statuses[migration.Version]
+		if !exists {
+			status = &MigrationStatus{Version: migration.Version, Name: migration.Name}
+			statuses[migration.Version] = status
+		}
+		appliedAt := migration.AppliedAt
+		status.Applied = true
+		status.AppliedAt = &appliedAt
+	}
+
+	result := make([]MigrationStatus, 0, len(statuses))
+	for _, status := range statuses {
+		result = append(result, *status)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Version < result[j].Version
+	})
+	return result, nil
+}
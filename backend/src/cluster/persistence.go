@@ -0,0 +1,171 @@
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// persistentState es el estado del cluster que debe sobrevivir a reinicios
+type persistentState struct {
+	CurrentTerm uint64 `json:"current_term"`
+	VotedFor    string `json:"voted_for"`
+	Maintenance bool   `json:"maintenance,omitempty"`
+	ClusterSize int    `json:"cluster_size,omitempty"` // Nodos con voto (CLUSTER_SIZE)
+}
+
+// UnmarshalJSON acepta también el formato anterior, en el que voted_for era el ID
+// numérico derivado de la IP. Se conserva como texto: no coincide con ningún UUID,
+// así que el nodo no vuelve a votar en ese término.
+func (s *persistentState) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		CurrentTerm uint64          `json:"current_term"`
+		VotedFor    json.RawMessage `json:"voted_for"`
+		Maintenance bool            `json:"maintenance"`
+		ClusterSize int             `json:"cluster_size"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	s.CurrentTerm = raw.CurrentTerm
+	s.Maintenance = raw.Maintenance
+	s.ClusterSize = raw.ClusterSize
+	s.VotedFor = ""
+	if len(raw.VotedFor) == 0 || string(raw.VotedFor) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(raw.VotedFor, &s.VotedFor); err == nil {
+		return nil
+	}
+
+	var legacyVote int
+	if err := json.Unmarshal(raw.VotedFor, &legacyVote); err != nil {
+		return fmt.Errorf("invalid voted_for: %s", raw.VotedFor)
+	}
+	if legacyVote != 0 {
+		s.VotedFor = fmt.Sprintf("%d", legacyVote)
+	}
+	return nil
+}
+
+// databasePath retorna la ruta del archivo SQLite
+func databasePath() string {
+	dbPath := os.Getenv("DB_PATH")
+	if dbPath == "" {
+		dbPath = "./talentnest.db"
+	}
+	return dbPath
+}
+
+// clusterDataDir retorna el directorio donde se guarda el estado del cluster.
+// Por defecto es el mismo directorio que contiene la base de datos.
+func clusterDataDir() string {
+	if dir := os.Getenv("CLUSTER_DATA_DIR"); dir != "" {
+		return dir
+	}
+	return filepath.Dir(databasePath())
+}
+
+// termFilePath retorna la ruta del archivo con el término persistido
+func termFilePath() string {
+	return filepath.Join(clusterDataDir(), "cluster_term.json")
+}
+
+// nodeIDFilePath retorna la ruta del archivo con el ID persistente del nodo
+func nodeIDFilePath() string {
+	return filepath.Join(clusterDataDir(), "node_id")
+}
+
+// loadOrCreateNodeID lee el ID del nodo del directorio de datos o genera un UUID
+// nuevo y lo guarda, para que el nodo conserve su identidad aunque cambie de IP
+func loadOrCreateNodeID() (string, error) {
+	data, err := os.ReadFile(nodeIDFilePath())
+	if err == nil {
+		nodeID := strings.TrimSpace(string(data))
+		if _, err := uuid.Parse(nodeID); err != nil {
+			return "", fmt.Errorf("invalid node id in %s: %v", nodeIDFilePath(), err)
+		}
+		return nodeID, nil
+	}
+	if !os.IsNotExist(err) {
+		return "", fmt.Errorf("error reading node id file: %v", err)
+	}
+
+	nodeID := uuid.NewString()
+	if err := writeFileAtomic(nodeIDFilePath(), []byte(nodeID+"\n")); err != nil {
+		return "", err
+	}
+	return nodeID, nil
+}
+
+// loadPersistentState lee el término y el voto del disco. Solo un archivo inexistente
+// equivale al estado vacío; cualquier otro error se retorna.
+func loadPersistentState() (persistentState, error) {
+	var state persistentState
+
+	data, err := os.ReadFile(termFilePath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, nil
+		}
+		return state, fmt.Errorf("error reading term file: %v", err)
+	}
+
+	if err := json.Unmarshal(data, &state); err != nil {
+		return persistentState{}, fmt.Errorf("error decoding term file: %v", err)
+	}
+
+	return state, nil
+}
+
+// persistStateUnsafe guarda el término, el voto, el modo mantenimiento y el tamaño del
+// cluster actuales (usar solo con lock)
+func (cs *ClusterState) persistStateUnsafe() error {
+	state := persistentState{
+		CurrentTerm: cs.CurrentTerm,
+		VotedFor:    cs.VotedFor,
+		Maintenance: cs.maintenance,
+		ClusterSize: cs.clusterSize,
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("error encoding term file: %v", err)
+	}
+
+	return writeFileAtomic(termFilePath(), data)
+}
+
+// writeFileAtomic escribe un archivo en un temporal y lo renombra para evitar escrituras parciales
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("error creating data directory: %v", err)
+	}
+
+	tmpPath := path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("error creating %s: %v", tmpPath, err)
+	}
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return fmt.Errorf("error writing %s: %v", tmpPath, err)
+	}
+
+	// Forzar a disco antes del rename para que el término no retroceda tras un crash
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("error syncing %s: %v", tmpPath, err)
+	}
+
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("error closing %s: %v", tmpPath, err)
+	}
+
+	return os.Rename(tmpPath, path)
+}
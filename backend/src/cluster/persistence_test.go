@@ -0,0 +1,66 @@
+package cluster
+
+import (
+	"os"
+	"testing"
+)
+
+func TestLoadPersistentState(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string // "" = sin archivo
+		want    persistentState
+		wantErr bool
+	}{
+		{name: "missing file", want: persistentState{}},
+		{name: "current format", content: `{"current_term":7,"voted_for":"node-b","cluster_size":3}`, want: persistentState{CurrentTerm: 7, VotedFor: "node-b", ClusterSize: 3}},
+		{name: "legacy numeric vote", content: `{"current_term":4,"voted_for":12345}`, want: persistentState{CurrentTerm: 4, VotedFor: "12345"}},
+		{name: "legacy empty vote", content: `{"current_term":4,"voted_for":0}`, want: persistentState{CurrentTerm: 4}},
+		{name: "corrupt file", content: `{"current_term":`, wantErr: true},
+		{name: "invalid vote", content: `{"current_term":4,"voted_for":true}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CLUSTER_DATA_DIR", t.TempDir())
+			if tt.content != "" {
+				if err := os.WriteFile(termFilePath(), []byte(tt.content), 0o600); err != nil {
+					t.Fatalf("writing term file: %v", err)
+				}
+			}
+
+			state, err := loadPersistentState()
+			if tt.wantErr {
+				// Un archivo ilegible no puede tratarse como término 0: el nodo votaría dos veces
+				if err == nil {
+					t.Fatalf("loadPersistentState() = %+v, want error", state)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadPersistentState(): %v", err)
+			}
+			if state != tt.want {
+				t.Errorf("loadPersistentState() = %+v, want %+v", state, tt.want)
+			}
+		})
+	}
+}
+
+func TestPersistStateRoundTrip(t *testing.T) {
+	cs := newTestClusterState(t)
+	cs.CurrentTerm, cs.VotedFor, cs.maintenance = 9, "node-c", true
+
+	if err := cs.persistStateUnsafe(); err != nil {
+		t.Fatalf("persisting state: %v", err)
+	}
+
+	state, err := loadPersistentState()
+	if err != nil {
+		t.Fatalf("loading persisted state: %v", err)
+	}
+	want := persistentState{CurrentTerm: 9, VotedFor: "node-c", Maintenance: true, ClusterSize: 3}
+	if state != want {
+		t.Errorf("persisted state = %+v, want %+v", state, want)
+	}
+}
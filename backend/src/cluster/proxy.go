@@ -0,0 +1,267 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/theleywin/Backend-Talent-Nest/src/logging"
+	"github.com/theleywin/Backend-Talent-Nest/src/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.43.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// forwardedByHeader lista los IDs de los nodos que ya reenviaron la petición, para
+// detectar ciclos entre nodos que creen que el líder es el otro
+const forwardedByHeader = "X-Cluster-Forwarded-By"
+
+// notProcessedHeader marca las respuestas de un nodo que rechazó la petición antes de
+// ejecutarla, como un líder que está cediendo el liderazgo: reenviarla a otro nodo no
+// puede aplicar la escritura dos veces
+const notProcessedHeader = "X-Cluster-Not-Processed"
+
+// forwardTimeout retorna el tiempo máximo de una petición reenviada a otro nodo
+func forwardTimeout() time.Duration {
+	return envDuration("CLUSTER_FORWARD_TIMEOUT", 30*time.Second)
+}
+
+// hopByHopHeaders son los headers que describen la conexión y no se reenvían
+// (RFC 9110, sección 7.6.1). Host y Content-Length los calcula el cliente HTTP.
+var hopByHopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+	"Host",
+	"Content-Length",
+}
+
+// proxyClient reenvía las peticiones de los clientes a otros nodos reutilizando las
+// conexiones. No sigue redirecciones: se devuelven tal cual al cliente.
+var proxyClient = newProxyClient()
+
+// proxyTransport es el transporte de proxyClient (con TLS, ver configureTLS)
+var proxyTransport = newProxyTransport()
+
+func newProxyTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = 64
+	return transport
+}
+
+func newProxyClient() *http.Client {
+	return &http.Client{
+		Transport: tracing.Transport(proxyTransport),
+		Timeout:   forwardTimeout(),
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// proxyRequest reenvía la petición a otro nodo (target describe el nodo en los errores)
+// y transmite su respuesta al cliente. Una petición reenviada al líder se reintenta una
+// vez contra el nuevo líder si el anterior no la recibió o la rechazó sin ejecutarla;
+// las lecturas se reintentan también si el líder deja de responder.
+func proxyRequest(c *fiber.Ctx, clusterState *ClusterState, address, target string) error {
+	nodeID := clusterState.GetCurrentNodeID()
+	logger := logging.FromContext(c.UserContext())
+
+	forwardedBy := c.Get(forwardedByHeader)
+	for _, id := range strings.Split(forwardedBy, ",") {
+		if strings.TrimSpace(id) == nodeID {
+			logger.Warn("Forwarding loop detected", "method", c.Method(), "uri", c.OriginalURL(), "forwarded_by", forwardedBy)
+			return c.Status(fiber.StatusLoopDetected).JSON(fiber.Map{
+				"error":   "Forwarding loop detected",
+				"message": "The nodes do not agree on the current " + target + ", retry the request shortly",
+			})
+		}
+	}
+
+	headers := forwardHeaders(c, nodeID)
+	body := c.Body()
+
+	resp, err := clusterState.ForwardToNode(c.UserContext(), address, c.Method(), c.OriginalURL(), body, headers)
+	if target == "leader" && shouldRetryForward(c.Method(), resp, err) {
+		if newAddress, changed := clusterState.waitForLeaderChange(address, 2*baseElectionTimeout()); changed {
+			if resp != nil {
+				resp.Body.Close()
+			}
+			logger.Info("Leader changed while forwarding, retrying", "method", c.Method(), "uri", c.OriginalURL(), "leader_address", newAddress)
+			forwardRetries.Inc()
+			resp, err = clusterState.ForwardToNode(c.UserContext(), newAddress, c.Method(), c.OriginalURL(), body, headers)
+		}
+	}
+	if err != nil {
+		forwardedRequests.WithLabelValues(target, "error").Inc()
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error":   "Failed to forward to " + target,
+			"message": err.Error(),
+		})
+	}
+
+	// Copiar status code y headers; el cuerpo se transmite sin cargarlo en memoria
+	// (fasthttp cierra resp.Body al terminar de enviarlo)
+	forwardedRequests.WithLabelValues(target, strconv.Itoa(resp.StatusCode)).Inc()
+	c.Status(resp.StatusCode)
+	removeHopByHopHeaders(resp.Header)
+	for key, values := range resp.Header {
+		c.Response().Header.Del(key)
+		for _, value := range values {
+			c.Response().Header.Add(key, value)
+		}
+	}
+
+	return c.SendStream(resp.Body, int(resp.ContentLength))
+}
+
+// forwardHeaders copia los headers de la petición sin los de la conexión y agrega los
+// X-Forwarded-* y el nodo actual a la lista de nodos que la reenviaron
+func forwardHeaders(c *fiber.Ctx, nodeID string) http.Header {
+	headers := make(http.Header)
+	c.Request().Header.VisitAll(func(key, value []byte) {
+		headers.Add(string(key), string(value))
+	})
+	removeHopByHopHeaders(headers)
+
+	if prior := headers.Get(fiber.HeaderXForwardedFor); prior != "" {
+		headers.Set(fiber.HeaderXForwardedFor, prior+", "+c.IP())
+	} else {
+		headers.Set(fiber.HeaderXForwardedFor, c.IP())
+	}
+	if headers.Get(fiber.HeaderXForwardedHost) == "" {
+		headers.Set(fiber.HeaderXForwardedHost, c.Hostname())
+	}
+	if headers.Get(fiber.HeaderXForwardedProto) == "" {
+		headers.Set(fiber.HeaderXForwardedProto, c.Protocol())
+	}
+
+	// El nodo que recibe la petición reenviada registra el mismo ID en sus logs
+	if requestID := logging.RequestID(c.UserContext()); requestID != "" {
+		headers.Set(logging.RequestIDHeader, requestID)
+	}
+
+	if prior := headers.Get(forwardedByHeader); prior != "" {
+		headers.Set(forwardedByHeader, prior+","+nodeID)
+	} else {
+		headers.Set(forwardedByHeader, nodeID)
+	}
+
+	return headers
+}
+
+// removeHopByHopHeaders elimina los headers de la conexión, incluidos los que nombra Connection
+func removeHopByHopHeaders(headers http.Header) {
+	for _, connection := range headers.Values("Connection") {
+		for _, name := range strings.Split(connection, ",") {
+			if name = textproto.TrimString(name); name != "" {
+				headers.Del(name)
+			}
+		}
+	}
+	for _, name := range hopByHopHeaders {
+		headers.Del(name)
+	}
+}
+
+// isSafeMethod indica si la petición solo lee, así que repetirla no cambia nada
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead
+}
+
+// shouldRetryForward indica si una petición reenviada al líder puede repetirse contra
+// el nuevo líder. Una escritura solo se repite si el líder seguro no la ejecutó: no
+// se pudo abrir la conexión o respondió 503 con Retry-After y notProcessedHeader.
+// Con cualquier otro error pudo haberla ejecutado antes de fallar, así que solo se
+// repiten las lecturas.
+func shouldRetryForward(method string, resp *http.Response, err error) bool {
+	if err != nil {
+		return isDialError(err) || isSafeMethod(method)
+	}
+	if resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get(fiber.HeaderRetryAfter) == "" {
+		return false
+	}
+	return resp.Header.Get(notProcessedHeader) != "" || isSafeMethod(method)
+}
+
+// isDialError indica si el error ocurrió al abrir la conexión, antes de enviar la petición
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// waitForLeaderChange espera a que el cluster elija un líder con otra dirección
+func (cs *ClusterState) waitForLeaderChange(previous string, timeout time.Duration) (string, bool) {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		address := cs.GetLeaderAddress()
+		if address != "" && address != previous {
+			return address, true
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return "", false
+}
+
+// ForwardToLeader redirige una petición HTTP al líder
+func (cs *ClusterState) ForwardToLeader(ctx context.Context, method, uri string, body []byte, headers http.Header) (*http.Response, error) {
+	leaderAddress := cs.GetLeaderAddress()
+	if leaderAddress == "" {
+		return nil, fmt.Errorf("no leader available")
+	}
+
+	return cs.ForwardToNode(ctx, leaderAddress, method, uri, body, headers)
+}
+
+// ForwardToNode redirige una petición HTTP (uri incluye la query string) al nodo con
+// la dirección dada. El span del reenvío cubre hasta recibir los headers de la respuesta.
+func (cs *ClusterState) ForwardToNode(ctx context.Context, address, method, uri string, body []byte, headers http.Header) (*http.Response, error) {
+	url := address + uri
+
+	logging.With(headers.Get(logging.RequestIDHeader)).Info("Forwarding request", "method", method, "url", url)
+
+	ctx, span := tracing.Tracer().Start(ctx, "cluster.forward",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(strings.Clone(method)),
+			semconv.URLFull(url),
+			attribute.String("cluster.node_address", address),
+		),
+	)
+	defer span.End()
+
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("error creating forward request: %v", err)
+	}
+	req.Header = headers.Clone()
+	req.ContentLength = int64(len(body))
+
+	resp, err := proxyClient.Do(req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+	return resp, nil
+}
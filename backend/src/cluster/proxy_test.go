@@ -0,0 +1,56 @@
+package cluster
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+)
+
+// unavailable construye una respuesta 503 con las cabeceras dadas
+func unavailable(headers map[string]string) *http.Response {
+	resp := &http.Response{StatusCode: http.StatusServiceUnavailable, Header: make(http.Header)}
+	for header, value := range headers {
+		resp.Header.Set(header, value)
+	}
+	return resp
+}
+
+func TestShouldRetryForward(t *testing.T) {
+	dialErr := &url.Error{Op: "Post", URL: "http://node-b/api", Err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("no route to host")}}
+	refused := &url.Error{Op: "Post", URL: "http://node-b/api", Err: &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNREFUSED)}}
+	reset := &url.Error{Op: "Post", URL: "http://node-b/api", Err: &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}}
+
+	tests := []struct {
+		name   string
+		method string
+		resp   *http.Response
+		err    error
+		want   bool
+	}{
+		{name: "write not connected", method: http.MethodPost, err: dialErr, want: true},
+		{name: "write refused", method: http.MethodPost, err: refused, want: true},
+		{name: "write reset after sending", method: http.MethodPost, err: reset, want: false},
+		{name: "write without response", method: http.MethodPost, err: io.ErrUnexpectedEOF, want: false},
+		{name: "read without response", method: http.MethodGet, err: io.ErrUnexpectedEOF, want: true},
+		{name: "write not processed by leader", method: http.MethodPost, resp: unavailable(map[string]string{"Retry-After": "1", notProcessedHeader: "true"}), want: true},
+		{name: "write unavailable", method: http.MethodPost, resp: unavailable(map[string]string{"Retry-After": "1"}), want: false},
+		{name: "read unavailable", method: http.MethodGet, resp: unavailable(map[string]string{"Retry-After": "1"}), want: true},
+		{name: "head unavailable", method: http.MethodHead, resp: unavailable(map[string]string{"Retry-After": "1"}), want: true},
+		{name: "unavailable without retry after", method: http.MethodGet, resp: unavailable(nil), want: false},
+		{name: "write succeeded", method: http.MethodPost, resp: &http.Response{StatusCode: http.StatusCreated, Header: make(http.Header)}, want: false},
+		{name: "write failed", method: http.MethodPut, resp: &http.Response{StatusCode: http.StatusInternalServerError, Header: make(http.Header)}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := shouldRetryForward(tt.method, tt.resp, tt.err); got != tt.want {
+				t.Errorf("shouldRetryForward(%s) = %v, want %v", tt.method, got, tt.want)
+			}
+		})
+	}
+}
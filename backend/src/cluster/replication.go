@@ -2,369 +2,267 @@ package cluster
 
 import (
 	"bytes"
-	"encoding/base64"
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
-	"log"
+	"log/slog"
 	"net/http"
-	"os"
-	"strings"
-	"time"
 
-	"gorm.io/driver/sqlite"
+	"github.com/theleywin/Backend-Talent-Nest/src/logging"
+	"github.com/theleywin/Backend-Talent-Nest/src/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"gorm.io/gorm"
-	"gorm.io/gorm/logger"
 )
 
-// ReplicateToFollowers envía un mensaje de replicación a todos los seguidores
-func (cs *ClusterState) ReplicateToFollowers(operation, table string, data map[string]interface{}, recordID uint) {
-	if !cs.IsLeader() {
-		log.Println("Warning: Non-leader node attempted to replicate")
-		return
-	}
-
-	cs.mu.RLock()
-	followers := make([]*Node, 0)
-	for _, node := range cs.Nodes {
-		if node.ID != cs.CurrentNodeID && node.IsHealthy {
-			followers = append(followers, node)
+// replicationClient envía los mensajes de replicación y descarga las entradas para
+// ponerse al día (sin timeout: la descarga del log puede ser larga)
+var replicationClient = newClusterClient(0)
+
+// sendReplicationMessage envía un mensaje de replicación a un seguidor específico y
+// retorna el índice de la última entrada que el seguidor tiene aplicada
+func (cs *ClusterState) sendReplicationMessage(ctx context.Context, nodeID, address string, message ReplicationMessage) (lastIndex uint64, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "cluster.replicate",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("cluster.follower_id", nodeID),
+			attribute.Int64("replication.index", int64(message.Index)),
+			attribute.Int64("replication.term", int64(message.Term)),
+			attribute.String("request.id", message.RequestID),
+		),
+	)
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
 		}
-	}
-	cs.mu.RUnlock()
-
-	if len(followers) == 0 {
-		log.Println("No followers to replicate to")
-		return
-	}
-
-	message := ReplicationMessage{
-		Operation: operation,
-		Table:     table,
-		Data:      data,
-		LeaderID:  cs.CurrentNodeID,
-		Timestamp: time.Now(),
-		RecordID:  recordID,
-	}
+		span.SetAttributes(attribute.Int64("replication.follower_last_index", int64(lastIndex)))
+		span.End()
+	}()
 
-	log.Printf("Replicating %s operation on table %s to %d followers", operation, table, len(followers))
-
-	// Enviar a todos los seguidores en paralelo
-	for _, follower := range followers {
-		go func(node *Node) {
-			if err := cs.sendReplicationMessage(node.Address, message); err != nil {
-				log.Printf("Failed to replicate to node %d: %v", node.ID, err)
-			} else {
-				log.Printf("Successfully replicated to node %d", node.ID)
-			}
-		}(follower)
-	}
-}
-
-// sendReplicationMessage envía un mensaje de replicación a un seguidor específico
-func (cs *ClusterState) sendReplicationMessage(address string, message ReplicationMessage) error {
 	url := fmt.Sprintf("%s/cluster/replicate", address)
 
 	jsonData, err := json.Marshal(message)
 	if err != nil {
-		return fmt.Errorf("error marshaling replication message: %v", err)
+		return 0, fmt.Errorf("error marshaling replication message: %v", err)
 	}
 
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(jsonData))
 	if err != nil {
-		return fmt.Errorf("error sending replication message: %v", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("replication failed with status: %d", resp.StatusCode)
+		return 0, fmt.Errorf("error creating replication request: %v", err)
 	}
+	req.Header.Set("Content-Type", "application/json")
 
-	return nil
-}
-
-// ApplyReplication aplica un mensaje de replicación en un nodo seguidor
-func (cs *ClusterState) ApplyReplication(message ReplicationMessage, db interface{}) error {
-	if cs.IsLeader() {
-		return fmt.Errorf("leader node should not receive replication messages")
+	resp, err := replicationClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("error sending replication message: %v", err)
 	}
+	defer resp.Body.Close()
 
-	// Verificar que el mensaje venga del líder actual
-	if message.LeaderID != cs.LeaderID {
-		return fmt.Errorf("replication message from non-leader node: %d (expected: %d)", message.LeaderID, cs.LeaderID)
+	var result struct {
+		Term      uint64 `json:"term"`
+		LastIndex uint64 `json:"last_index"`
 	}
+	decodeErr := json.NewDecoder(resp.Body).Decode(&result)
 
-	log.Printf("Applying replication: %s on table %s (RecordID: %d)", message.Operation, message.Table, message.RecordID)
-
-	// Convertir db interface a *gorm.DB
-	gormDB, ok := db.(*gorm.DB)
-	if !ok {
-		return fmt.Errorf("invalid database instance")
+	// El seguidor conoce un término más reciente: este nodo ya no es el líder
+	if resp.StatusCode == http.StatusConflict {
+		if decodeErr == nil && result.Term > message.Term {
+			cs.stepDown(result.Term)
+		}
+		return 0, fmt.Errorf("replication rejected: stale term %d", message.Term)
 	}
 
-	// Aplicar la operación según el tipo
-	switch message.Operation {
-	case "INSERT":
-		return cs.applyInsert(message.Table, message.Data, gormDB)
-	case "UPDATE":
-		return cs.applyUpdate(message.Table, message.RecordID, message.Data, gormDB)
-	case "DELETE":
-		return cs.applyDelete(message.Table, message.RecordID, gormDB)
-	default:
-		return fmt.Errorf("unknown operation: %s", message.Operation)
+	if resp.StatusCode != http.StatusOK {
+		return result.LastIndex, fmt.Errorf("replication failed with status: %d", resp.StatusCode)
 	}
-}
-
-// applyInsert aplica una operación INSERT replicada
-func (cs *ClusterState) applyInsert(table string, data map[string]interface{}, db *gorm.DB) error {
-	log.Printf("[Replication] Inserting into %s: %v", table, data)
 
-	// Convertir campos complejos (arrays, objects) a JSON para campos serializados
-	processedData := make(map[string]interface{})
-	for key, value := range data {
-		processedData[key] = serializeForDB(key, value)
+	if decodeErr != nil {
+		return 0, fmt.Errorf("error decoding replication response: %v", decodeErr)
 	}
 
-	// Ejecutar INSERT usando GORM
-	result := db.Table(table).Create(processedData)
-	if result.Error != nil {
-		log.Printf("[Replication] ❌ Error inserting into %s: %v", table, result.Error)
-		return fmt.Errorf("error inserting into %s: %v", table, result.Error)
-	}
-	log.Printf("[Replication] ✓ Successfully inserted into %s (rows affected: %d)", table, result.RowsAffected)
-	return nil
+	return result.LastIndex, nil
 }
 
-// applyUpdate aplica una operación UPDATE replicada
-func (cs *ClusterState) applyUpdate(table string, recordID uint, data map[string]interface{}, db *gorm.DB) error {
-	log.Printf("Updating %s record %d: %v", table, recordID, data)
-
-	// Convertir campos complejos (arrays, objects) a JSON para campos serializados
-	processedData := make(map[string]interface{})
-	for key, value := range data {
-		processedData[key] = serializeForDB(key, value)
+// ApplyReplication aplica un mensaje de replicación en un nodo seguidor. Las entradas
+// se aplican exactamente una vez y en orden; si faltan entradas anteriores se
+// recuperan del líder antes de aplicar el mensaje.
+func (cs *ClusterState) ApplyReplication(message ReplicationMessage, db interface{}) error {
+	// Verificar que el mensaje venga del líder actual y no de un término anterior
+	if err := cs.checkLeaderTerm(message.Term, message.LeaderID); err != nil {
+		return err
 	}
 
-	// Ejecutar UPDATE en la tabla correspondiente
-	result := db.Table(table).Where("id = ?", recordID).Updates(processedData)
-	if result.Error != nil {
-		return fmt.Errorf("error updating record: %v", result.Error)
+	// Convertir db interface a *gorm.DB
+	gormDB, ok := db.(*gorm.DB)
+	if !ok {
+		return fmt.Errorf("invalid database instance")
 	}
 
-	log.Printf("Updated %d rows in %s", result.RowsAffected, table)
-	return nil
-}
-
-// applyDelete aplica una operación DELETE replicada
-func (cs *ClusterState) applyDelete(table string, recordID uint, db *gorm.DB) error {
-	log.Printf("Deleting from %s record %d", table, recordID)
-
-	// Ejecutar soft delete (deleted_at)
-	result := db.Table(table).Where("id = ?", recordID).Update("deleted_at", time.Now())
-	if result.Error != nil {
-		return fmt.Errorf("error deleting record: %v", result.Error)
+	// Un nodo sin sincronizar no puede aplicar cambios incrementales; el líder
+	// reintentará cuando termine la sincronización completa
+	if !cs.IsNodeReady() {
+		return fmt.Errorf("node is not ready to apply replication messages")
 	}
 
-	log.Printf("Deleted record %d from %s", recordID, table)
-	return nil
-}
+	cs.applyMu.Lock()
+	defer cs.applyMu.Unlock()
 
-// RequestFullSync solicita una sincronización completa de la base de datos al líder
-func (cs *ClusterState) RequestFullSync(leaderAddress string) error {
-	if leaderAddress == "" {
-		return fmt.Errorf("no leader available for sync")
+	lastIndex, _, err := lastLogEntry(gormDB)
+	if err != nil {
+		return err
 	}
 
-	log.Printf("Requesting full sync from leader at %s", leaderAddress)
-
-	url := fmt.Sprintf("%s/cluster/sync", leaderAddress)
-
-	request := SyncRequest{
-		NodeID:    cs.CurrentNodeID,
-		Timestamp: time.Now(),
+	if message.Index > lastIndex+1 {
+		logging.With(message.RequestID).Info("Missing entries, catching up from leader", "from", lastIndex+1, "to", message.Index-1)
+		if err := cs.catchUpUnsafe(gormDB, lastIndex+1); err != nil {
+			return fmt.Errorf("%w: %v", ErrLogGap, err)
+		}
 	}
 
-	jsonData, err := json.Marshal(request)
-	if err != nil {
-		return fmt.Errorf("error marshaling sync request: %v", err)
-	}
+	return cs.applyInOrder(gormDB, message)
+}
 
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonData))
+// applyInOrder aplica un mensaje solo si es la siguiente entrada del log local
+// (usar con applyMu tomado)
+func (cs *ClusterState) applyInOrder(db *gorm.DB, message ReplicationMessage) error {
+	lastIndex, lastTerm, err := lastLogEntry(db)
 	if err != nil {
-		return fmt.Errorf("error requesting sync: %v", err)
+		return err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("sync request failed with status: %d", resp.StatusCode)
+	// Entrada ya aplicada: confirmar que es la misma que tiene el líder. Si la
+	// compactación ya la borró del log local no hay término con el que compararla
+	if message.Index <= lastIndex {
+		if compacted, err := logCompacted(db, message.Index); err != nil || compacted {
+			return err
+		}
+		localTerm, err := logTermAt(db, message.Index)
+		if err != nil {
+			return err
+		}
+		if localTerm != message.EntryTerm {
+			cs.requestResync("replication log diverged from leader")
+			return fmt.Errorf("%w: entry %d has term %d locally, %d on leader", ErrLogDiverged, message.Index, localTerm, message.EntryTerm)
+		}
+		return nil
 	}
 
-	var syncResponse SyncResponse
-	if err := json.NewDecoder(resp.Body).Decode(&syncResponse); err != nil {
-		return fmt.Errorf("error decoding sync response: %v", err)
+	if message.Index != lastIndex+1 {
+		return fmt.Errorf("%w: received entry %d, last applied %d", ErrLogGap, message.Index, lastIndex)
 	}
 
-	// Decodificar la base de datos de base64
-	dbData, err := base64.StdEncoding.DecodeString(syncResponse.Database)
-	if err != nil {
-		return fmt.Errorf("error decoding database: %v", err)
+	if lastIndex > 0 && message.PrevTerm != lastTerm {
+		cs.requestResync("replication log diverged from leader")
+		return fmt.Errorf("%w: entry %d has term %d locally, %d on leader", ErrLogDiverged, lastIndex, lastTerm, message.PrevTerm)
 	}
 
-	log.Printf("📥 Received database from leader (%d bytes)", len(dbData))
+	changes := message.changes()
+	logging.With(message.RequestID).Info("Applying replication entry", "index", message.Index, "operation", message.Operation, "changes", len(changes))
 
-	// 🔍 PREVIEW DE DATOS RECIBIDOS (antes de aplicar)
-	if err := previewSyncedDatabase(dbData); err != nil {
-		log.Printf("⚠️  Warning: Could not preview synced database: %v", err)
-	}
+	entry, err := logEntryFromMessage(message)
+	if err != nil {
+		return err
+	}
+
+	// Los cambios de la transacción del líder y su entrada en el log se confirman juntos
+	migrated := false
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for _, change := range changes {
+			var err error
+			switch change.Operation {
+			case "INSERT", "UPDATE", "DELETE":
+				err = cs.applyRowChange(tx, change)
+			case "EXEC":
+				err = applyStatement(tx, change.Statement)
+			case "MIGRATE":
+				err = applySchemaChange(tx, change.Migration)
+				migrated = true
+			default:
+				err = fmt.Errorf("unknown operation: %s", change.Operation)
+			}
+			if err != nil {
+				return err
+			}
+		}
 
-	// Guardar la base de datos recibida
-	dbPath := os.Getenv("DB_PATH")
-	if dbPath == "" {
-		dbPath = "./talentnest.db"
+		return tx.Create(&entry).Error
+	})
+	if err != nil {
+		return err
 	}
 
-	if err := os.WriteFile(dbPath, dbData, 0644); err != nil {
-		return fmt.Errorf("error writing database file: %v", err)
+	replicationApplied.Inc()
+	if migrated {
+		cs.refreshSchemaVersion(db)
+		applied, _ := cs.SchemaVersions()
+		slog.Info("Schema migration replicated", "index", message.Index, "schema_version", applied)
 	}
 
-	log.Printf("✅ Successfully synced database from leader (size: %d bytes)", len(dbData))
-
-	// Marcar el nodo como listo
-	cs.mu.Lock()
-	cs.IsReady = true
-	cs.mu.Unlock()
-
+	// Despertar a las lecturas que esperan esta posición del log
+	cs.notifyApplied()
 	return nil
 }
 
-// previewSyncedDatabase abre temporalmente la DB recibida y muestra su contenido
-func previewSyncedDatabase(dbData []byte) error {
-	// Crear archivo temporal
-	tempPath := "/tmp/preview_sync.db"
-	if err := os.WriteFile(tempPath, dbData, 0644); err != nil {
-		return fmt.Errorf("error writing temp db: %v", err)
+// catchUpUnsafe descarga del líder las entradas desde el índice dado y las aplica
+// en orden (usar con applyMu tomado)
+func (cs *ClusterState) catchUpUnsafe(db *gorm.DB, from uint64) error {
+	leaderAddress := cs.GetLeaderAddress()
+	if leaderAddress == "" {
+		return fmt.Errorf("no leader available for catch-up")
 	}
-	defer os.Remove(tempPath)
 
-	// Abrir DB temporal con GORM
-	dsn := fmt.Sprintf("file:%s?mode=ro", tempPath) // modo read-only
-	tempDB, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Silent),
-	})
+	url := fmt.Sprintf("%s/cluster/replicate?from=%d", leaderAddress, from)
+	resp, err := replicationClient.Get(url)
 	if err != nil {
-		return fmt.Errorf("error opening temp db: %v", err)
+		return fmt.Errorf("error requesting catch-up: %v", err)
 	}
+	defer resp.Body.Close()
 
-	log.Println("\n========== PREVIEW: Database Received from Leader ==========")
-
-	tables := []string{"users", "posts", "connections", "notifications"}
+	// El líder compactó las entradas que faltan: solo queda sincronizar con un snapshot
+	if resp.StatusCode == http.StatusGone {
+		cs.requestResync("missing entries were compacted from the leader log")
+		return fmt.Errorf("%w: entries from %d are no longer in the leader log", ErrLogCompacted, from)
+	}
 
-	for _, table := range tables {
-		var count int64
-		if err := tempDB.Table(table).Count(&count).Error; err != nil {
-			log.Printf("[%s] Error counting: %v", table, err)
-			continue
-		}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("catch-up request failed with status: %d", resp.StatusCode)
+	}
 
-		log.Printf("\n[Table: %s] Total records: %d", table, count)
+	body := &countingReader{reader: resp.Body}
+	defer func() { syncBytes.WithLabelValues(string(SyncModeLog)).Add(float64(body.count)) }()
 
-		if count == 0 {
-			log.Printf("  (empty)")
-			continue
+	applied := 0
+	decoder := json.NewDecoder(body)
+	for decoder.More() {
+		var message ReplicationMessage
+		if err := decoder.Decode(&message); err != nil {
+			return fmt.Errorf("error decoding catch-up entry: %v", err)
 		}
-
-		// Obtener primeros 5 registros para preview
-		var records []map[string]interface{}
-		if err := tempDB.Table(table).Limit(10).Find(&records).Error; err != nil {
-			log.Printf("  Error fetching records: %v", err)
-			continue
+		if err := cs.checkLeaderTerm(message.Term, message.LeaderID); err != nil {
+			return err
 		}
-
-		log.Printf("  Sample records (first 5):")
-		for i, record := range records {
-			var fields []string
-			for key, value := range record {
-				var formattedValue string
-				switch v := value.(type) {
-				case string:
-					if len(v) > 50 {
-						formattedValue = v[:47] + "..."
-					} else {
-						formattedValue = v
-					}
-				case nil:
-					formattedValue = "<nil>"
-				default:
-					formattedValue = fmt.Sprintf("%v", v)
-				}
-				fields = append(fields, fmt.Sprintf("%s=%s", key, formattedValue))
-			}
-			log.Printf("    [%d] %s", i+1, strings.Join(fields, " | "))
+		if err := cs.applyInOrder(db, message); err != nil {
+			return err
 		}
+		applied++
 	}
 
-	log.Println("============================================================")
-
+	slog.Info("Caught up entries from leader", "entries", applied, "from", from)
 	return nil
 }
 
-// ProvideSyncData proporciona la base de datos completa a un seguidor (solo líder)
-func (cs *ClusterState) ProvideSyncData() (SyncResponse, error) {
-	if !cs.IsLeader() {
-		return SyncResponse{}, fmt.Errorf("only leader can provide sync data")
-	}
-
-	dbPath := os.Getenv("DB_PATH")
-	if dbPath == "" {
-		dbPath = "./talentnest.db"
-	}
-
-	// Leer el archivo de la base de datos
-	dbData, err := os.ReadFile(dbPath)
-	if err != nil {
-		return SyncResponse{}, fmt.Errorf("error reading database file: %v", err)
-	}
-
-	// Codificar en base64
-	encodedDB := base64.StdEncoding.EncodeToString(dbData)
-
-	response := SyncResponse{
-		Database:  encodedDB,
-		LeaderID:  cs.CurrentNodeID,
-		Timestamp: time.Now(),
-	}
-
-	log.Printf("Providing sync data (size: %d bytes)", len(dbData))
-
-	return response, nil
-}
-
-// ForwardToLeader redirige una petición HTTP al líder
-func (cs *ClusterState) ForwardToLeader(method, path string, body io.Reader, headers map[string]string) (*http.Response, error) {
-	leaderAddress := cs.GetLeaderAddress()
-	if leaderAddress == "" {
-		return nil, fmt.Errorf("no leader available")
-	}
-
-	url := fmt.Sprintf("%s%s", leaderAddress, path)
-
-	log.Printf("Forwarding %s request to leader: %s", method, url)
-
-	req, err := http.NewRequest(method, url, body)
-	if err != nil {
-		return nil, fmt.Errorf("error creating forward request: %v", err)
-	}
-
-	// Copiar headers
-	for key, value := range headers {
-		req.Header.Set(key, value)
-	}
+// requestResync marca el nodo como no listo para que se sincronice de nuevo
+// con el líder en el siguiente heartbeat
+func (cs *ClusterState) requestResync(reason string) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
 
-	client := &http.Client{
-		Timeout: 30 * time.Second,
+	if cs.IsReady {
+		slog.Warn("Resync with leader required", "reason", reason)
 	}
-
-	return client.Do(req)
+	cs.IsReady = false
 }
 
 // IsReady verifica si el nodo está listo para aceptar requests
@@ -379,48 +277,5 @@ func (cs *ClusterState) SetReady(ready bool) {
 	cs.mu.Lock()
 	defer cs.mu.Unlock()
 	cs.IsReady = ready
-	log.Printf("Node ready status set to: %v", ready)
-}
-
-// serializeForDB convierte valores complejos a formato JSON para campos serializados
-func serializeForDB(fieldName string, value interface{}) interface{} {
-	if value == nil {
-		return nil
-	}
-
-	// Lista de campos que usan serializer:json en la tabla users
-	jsonFields := map[string]bool{
-		"skills":     true,
-		"experience": true,
-		"education":  true,
-	}
-
-	// Si es un campo serializado y es un tipo complejo, convertir a JSON
-	if jsonFields[fieldName] {
-		switch v := value.(type) {
-		case []interface{}, []map[string]interface{}, map[string]interface{}:
-			// Serializar a JSON bytes
-			jsonBytes, err := json.Marshal(v)
-			if err != nil {
-				log.Printf("[serializeForDB] Error serializing %s: %v", fieldName, err)
-				return nil
-			}
-			log.Printf("[serializeForDB] ✓ Serialized %s to JSON (%d bytes)", fieldName, len(jsonBytes))
-			return jsonBytes
-		case string:
-			// Ya es string, puede ser JSON serializado
-			return v
-		default:
-			// Intentar serializar cualquier otro tipo
-			jsonBytes, err := json.Marshal(v)
-			if err != nil {
-				log.Printf("[serializeForDB] Error serializing %s (type %T): %v", fieldName, v, err)
-				return value
-			}
-			return jsonBytes
-		}
-	}
-
-	// Para campos no serializados, devolver el valor tal cual
-	return value
+	slog.Info("Node ready status changed", "ready", ready)
 }
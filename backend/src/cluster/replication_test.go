@@ -0,0 +1,130 @@
+package cluster
+
+import (
+	"errors"
+	"testing"
+)
+
+// batchEntry construye la entrada index del líder, creada en term y precedida por una de prevTerm
+func batchEntry(index, term, prevTerm uint64) ReplicationMessage {
+	return ReplicationMessage{
+		Operation: "BATCH",
+		LeaderID:  "node-b",
+		Term:      term,
+		Index:     index,
+		EntryTerm: term,
+		PrevTerm:  prevTerm,
+	}
+}
+
+func TestAppendToLogAssignsSequentialIndexes(t *testing.T) {
+	cs := newTestClusterState(t)
+	cs.CurrentTerm = 2
+
+	for want := uint64(1); want <= 3; want++ {
+		index, err := cs.AppendToLog(cs.db, []Change{{Operation: "INSERT", Table: "posts", RecordID: uint(want)}})
+		if err != nil {
+			t.Fatalf("appending entry %d: %v", want, err)
+		}
+		if index != want {
+			t.Fatalf("AppendToLog() = %d, want %d", index, want)
+		}
+	}
+
+	cs.CurrentTerm = 3
+	if _, err := cs.AppendToLog(cs.db, nil); err != nil {
+		t.Fatalf("appending entry 4: %v", err)
+	}
+
+	lastIndex, lastTerm, err := lastLogEntry(cs.db)
+	if err != nil {
+		t.Fatalf("reading last entry: %v", err)
+	}
+	if lastIndex != 4 || lastTerm != 3 {
+		t.Errorf("last entry = (%d, %d), want (4, 3)", lastIndex, lastTerm)
+	}
+	if term, err := logTermAt(cs.db, 2); err != nil || term != 2 {
+		t.Errorf("logTermAt(2) = %d, %v, want 2", term, err)
+	}
+}
+
+func TestAppendToLogRejectsSharedDatabase(t *testing.T) {
+	cs := newTestClusterState(t)
+	cs.sharedDatabase = true
+
+	if index, err := cs.AppendToLog(cs.db, []Change{{Operation: "INSERT", Table: "posts", RecordID: 1}}); err == nil {
+		t.Fatalf("AppendToLog() = %d with a shared database, want error", index)
+	}
+	if lastIndex, _, err := lastLogEntry(cs.db); err != nil || lastIndex != 0 {
+		t.Errorf("last entry = %d, %v, want an empty log", lastIndex, err)
+	}
+}
+
+func TestApplyInOrder(t *testing.T) {
+	tests := []struct {
+		name      string
+		message   ReplicationMessage
+		wantErr   error
+		wantLast  uint64
+		wantReady bool
+	}{
+		{name: "next entry", message: batchEntry(3, 2, 2), wantLast: 3, wantReady: true},
+		{name: "next entry in a newer term", message: batchEntry(3, 4, 2), wantLast: 3, wantReady: true},
+		{name: "already applied", message: batchEntry(2, 2, 1), wantLast: 2, wantReady: true},
+		{name: "gap", message: batchEntry(5, 2, 2), wantErr: ErrLogGap, wantLast: 2, wantReady: true},
+		{name: "applied entry with another term", message: batchEntry(2, 3, 1), wantErr: ErrLogDiverged, wantLast: 2},
+		{name: "previous entry with another term", message: batchEntry(3, 3, 3), wantErr: ErrLogDiverged, wantLast: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cs := newTestClusterState(t)
+
+			// Log local: entrada 1 del término 1 y entrada 2 del término 2
+			for _, entry := range []ReplicationMessage{batchEntry(1, 1, 0), batchEntry(2, 2, 1)} {
+				if err := cs.applyInOrder(cs.db, entry); err != nil {
+					t.Fatalf("applying entry %d: %v", entry.Index, err)
+				}
+			}
+
+			err := cs.applyInOrder(cs.db, tt.message)
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("applyInOrder(): %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("applyInOrder() error = %v, want %v", err, tt.wantErr)
+			}
+
+			lastIndex, _, err := lastLogEntry(cs.db)
+			if err != nil {
+				t.Fatalf("reading last entry: %v", err)
+			}
+			if lastIndex != tt.wantLast {
+				t.Errorf("last index = %d, want %d", lastIndex, tt.wantLast)
+			}
+			if cs.IsNodeReady() != tt.wantReady {
+				t.Errorf("ready = %v, want %v", cs.IsNodeReady(), tt.wantReady)
+			}
+		})
+	}
+}
+
+func TestApplyInOrderAcceptsCompactedEntries(t *testing.T) {
+	cs := newTestClusterState(t)
+	for _, entry := range []ReplicationMessage{batchEntry(1, 1, 0), batchEntry(2, 1, 1), batchEntry(3, 2, 1)} {
+		if err := cs.applyInOrder(cs.db, entry); err != nil {
+			t.Fatalf("applying entry %d: %v", entry.Index, err)
+		}
+	}
+	if err := cs.db.Where("log_index < ?", 3).Delete(&ReplicationLogEntry{}).Error; err != nil {
+		t.Fatalf("compacting log: %v", err)
+	}
+
+	// La entrada 1 ya no está en el log local: no hay término con el que compararla
+	if err := cs.applyInOrder(cs.db, batchEntry(1, 5, 0)); err != nil {
+		t.Errorf("applyInOrder() on a compacted entry: %v", err)
+	}
+	if err := cs.applyInOrder(cs.db, batchEntry(4, 2, 2)); err != nil {
+		t.Errorf("applyInOrder() after compaction: %v", err)
+	}
+}
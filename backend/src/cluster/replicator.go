@@ -0,0 +1,174 @@
+package cluster
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/theleywin/Backend-Talent-Nest/src/logging"
+	"github.com/theleywin/Backend-Talent-Nest/src/tracing"
+)
+
+// followerReplicator envía en orden las entradas del log a un seguidor. Solo avanza
+// nextIndex cuando el seguidor confirma, así que un fallo se reintenta en el siguiente ciclo.
+type followerReplicator struct {
+	nodeID    string
+	address   string
+	nextIndex uint64
+	notify    chan struct{}
+	stop      chan struct{}
+}
+
+// syncReplicatorsUnsafe crea replicadores para los seguidores nuevos y detiene los de
+// nodos que ya no están en el cluster. Con una base de datos compartida no hay nada
+// que replicar (usar solo con lock)
+func (cs *ClusterState) syncReplicatorsUnsafe() {
+	if cs.CurrentRole != Leader || cs.db == nil || cs.sharedDatabase {
+		return
+	}
+
+	peers := make(map[string]*Node)
+	for _, node := range cs.peersUnsafe() {
+		peers[node.ID] = node
+	}
+
+	for id, replicator := range cs.replicators {
+		if node, exists := peers[id]; !exists || node.Address != replicator.address {
+			close(replicator.stop)
+			delete(cs.replicators, id)
+			cs.forgetAcks(id)
+		}
+	}
+
+	// Empezar justo después de la última entrada del líder; si el seguidor está
+	// atrasado lo informará y el replicador retrocederá hasta su posición
+	lastIndex, _, err := lastLogEntry(cs.db)
+	if err != nil {
+		slog.Error("Error reading replication log", "error", err)
+		return
+	}
+
+	for id, node := range peers {
+		if _, exists := cs.replicators[id]; exists {
+			continue
+		}
+
+		replicator := &followerReplicator{
+			nodeID:    id,
+			address:   node.Address,
+			nextIndex: lastIndex + 1,
+			notify:    make(chan struct{}, 1),
+			stop:      make(chan struct{}),
+		}
+		cs.replicators[id] = replicator
+		go cs.runReplicator(replicator)
+		slog.Info("Started replicator", "node_id", id, "next_index", replicator.nextIndex)
+	}
+}
+
+// stopReplicatorsUnsafe detiene todos los replicadores (usar solo con lock)
+func (cs *ClusterState) stopReplicatorsUnsafe() {
+	for id, replicator := range cs.replicators {
+		close(replicator.stop)
+		delete(cs.replicators, id)
+	}
+	cs.forgetAcks("")
+}
+
+// NotifyReplicators avisa a los replicadores de que hay entradas nuevas en el log
+func (cs *ClusterState) NotifyReplicators() {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	for _, replicator := range cs.replicators {
+		select {
+		case replicator.notify <- struct{}{}:
+		default:
+			// Ya hay una notificación pendiente
+		}
+	}
+}
+
+// runReplicator envía entradas al seguidor cuando hay novedades o periódicamente
+func (cs *ClusterState) runReplicator(replicator *followerReplicator) {
+	ticker := time.NewTicker(heartbeatInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-replicator.stop:
+			return
+		case <-replicator.notify:
+		case <-ticker.C:
+		}
+
+		cs.replicateTo(replicator)
+	}
+}
+
+// replicateTo envía al seguidor todas las entradas desde nextIndex
+func (cs *ClusterState) replicateTo(replicator *followerReplicator) {
+	prevTerm, err := logTermAt(cs.db, replicator.nextIndex-1)
+	if err != nil {
+		slog.Error("Error reading replication log", "node_id", replicator.nodeID, "error", err)
+		return
+	}
+
+	// Si el seguidor está detrás del punto de compactación, la primera entrada leída no
+	// sigue a la suya: al recibirla pide las que faltan, el líder responde que ya no
+	// están en el log (CheckLogFrom) y el seguidor se sincroniza con un snapshot
+	for {
+		entries, err := readLogFrom(cs.db, replicator.nextIndex, 100)
+		if err != nil {
+			slog.Error("Error reading replication log", "node_id", replicator.nodeID, "error", err)
+			return
+		}
+		if len(entries) == 0 {
+			return
+		}
+
+		for _, entry := range entries {
+			select {
+			case <-replicator.stop:
+				return
+			default:
+			}
+
+			cs.mu.RLock()
+			leaderID, term := cs.CurrentNodeID, cs.CurrentTerm
+			cs.mu.RUnlock()
+
+			message, err := entry.toMessage(leaderID, term, prevTerm)
+			if err != nil {
+				slog.Error("Error building replication message", "error", err)
+				return
+			}
+
+			replicationSent.WithLabelValues(replicator.nodeID).Inc()
+			// El envío forma parte de la traza de la escritura que originó la entrada
+			ctx := tracing.WithTraceParent(context.Background(), entry.TraceParent)
+			lastIndex, err := cs.sendReplicationMessage(ctx, replicator.nodeID, replicator.address, message)
+			if lastIndex > 0 || err == nil {
+				replicator.nextIndex = lastIndex + 1
+			}
+			if err != nil {
+				replicationFailed.WithLabelValues(replicator.nodeID).Inc()
+				logging.With(entry.RequestID).Warn("Failed to replicate entry", "index", entry.Index, "node_id", replicator.nodeID, "error", err)
+				return
+			}
+			replicationAcked.WithLabelValues(replicator.nodeID).Inc()
+			cs.recordAck(replicator.nodeID, lastIndex)
+
+			if replicator.nextIndex != entry.Index+1 {
+				// El seguidor está en otra posición del log: continuar desde ahí
+				break
+			}
+			prevTerm = entry.Term
+		}
+
+		if prevTerm, err = logTermAt(cs.db, replicator.nextIndex-1); err != nil {
+			slog.Error("Error reading replication log", "node_id", replicator.nodeID, "error", err)
+			return
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package cluster
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/theleywin/Backend-Talent-Nest/src/logging"
+	"github.com/theleywin/Backend-Talent-Nest/src/tracing"
+	"gorm.io/gorm"
+)
+
+// ReplicationLogEntry es una entrada del log de replicación. El líder la escribe en la
+// misma transacción que el cambio que describe y los seguidores al aplicarlo, de modo
+// que la última entrada del log es siempre el último cambio aplicado en el nodo.
+type ReplicationLogEntry struct {
+	Index       uint64 `gorm:"column:log_index;primaryKey"`
+	Term        uint64 `gorm:"not null"`
+	Operation   string `gorm:"type:varchar(10);not null"`
+	Table       string `gorm:"column:table_name;not null"`
+	RecordID    uint
+	Data        string `gorm:"type:text"` // Cambios de la transacción ([]Change) en JSON
+	RequestID   string // Petición que originó la escritura (X-Request-ID)
+	TraceParent string // Contexto de traza W3C de la escritura, para trazar su replicación
+	CreatedAt   time.Time
+}
+
+// TableName define el nombre de la tabla del log
+func (ReplicationLogEntry) TableName() string {
+	return "replication_log"
+}
+
+// MigrateReplicationLog crea las tablas del propio mecanismo de replicación: el log y
+// las migraciones del esquema aplicadas. Las tablas de la aplicación se crean con
+// migraciones versionadas que aplica el líder.
+func MigrateReplicationLog(db *gorm.DB) error {
+	err := db.AutoMigrate(&ReplicationLogEntry{}, &SchemaMigration{})
+	if err != nil {
+		// Con una base de datos compartida otro nodo que arranca a la vez puede crear la
+		// tabla entre la verificación y el CREATE: el segundo intento la encuentra creada
+		slog.Warn("Failed to migrate replication log, retrying", "error", err)
+		err = db.AutoMigrate(&ReplicationLogEntry{}, &SchemaMigration{})
+	}
+	return err
+}
+
+// isInternalTable indica si una tabla pertenece al propio mecanismo de replicación
+func isInternalTable(table string) bool {
+	return table == "replication_log" || table == schemaMigrationsTable
+}
+
+// LastLogIndex retorna el índice de la última entrada aplicada en este nodo
+func LastLogIndex(db *gorm.DB) uint64 {
+	index, _, _ := lastLogEntry(db)
+	return index
+}
+
+// lastLogEntry retorna el índice y el término de la última entrada del log
+func lastLogEntry(db *gorm.DB) (uint64, uint64, error) {
+	var entry ReplicationLogEntry
+	err := db.Order("log_index DESC").Limit(1).Find(&entry).Error
+	if err != nil {
+		return 0, 0, fmt.Errorf("error reading replication log: %v", err)
+	}
+	return entry.Index, entry.Term, nil
+}
+
+// logTermAt retorna el término de la entrada en el índice dado (0 si no existe)
+func logTermAt(db *gorm.DB, index uint64) (uint64, error) {
+	if index == 0 {
+		return 0, nil
+	}
+
+	var entry ReplicationLogEntry
+	if err := db.Where("log_index = ?", index).Limit(1).Find(&entry).Error; err != nil {
+		return 0, fmt.Errorf("error reading replication log: %v", err)
+	}
+	return entry.Term, nil
+}
+
+// readLogFrom retorna hasta limit entradas a partir del índice dado (inclusive)
+func readLogFrom(db *gorm.DB, from uint64, limit int) ([]ReplicationLogEntry, error) {
+	var entries []ReplicationLogEntry
+	err := db.Where("log_index >= ?", from).Order("log_index ASC").Limit(limit).Find(&entries).Error
+	if err != nil {
+		return nil, fmt.Errorf("error reading replication log: %v", err)
+	}
+	return entries, nil
+}
+
+// AppendToLog agrega al log los cambios de una transacción como una sola entrada.
+// Debe llamarse con la misma conexión (transacción) que ejecutó los cambios para que
+// todo se confirme junto. Solo vale con la base de datos local de cada nodo (SQLite):
+// con una base de datos compartida no hay log y retorna un error.
+func (cs *ClusterState) AppendToLog(tx *gorm.DB, changes []Change) (uint64, error) {
+	// El orden del log depende de que SQLite serialice las escrituras (ver abajo); con
+	// PostgreSQL o MySQL dos transacciones podrían confirmarse en orden distinto al de
+	// sus índices y los seguidores aplicarían los cambios desordenados
+	if cs.SharedDatabase() {
+		return 0, fmt.Errorf("replication log not available with a shared database")
+	}
+
+	jsonData, err := json.Marshal(changes)
+	if err != nil {
+		return 0, fmt.Errorf("error marshaling replication data: %v", err)
+	}
+
+	entry := ReplicationLogEntry{
+		Term:        cs.GetCurrentTerm(),
+		Operation:   "BATCH",
+		Data:        string(jsonData),
+		RequestID:   logging.RequestID(tx.Statement.Context),
+		TraceParent: tracing.TraceParent(tx.Statement.Context),
+	}
+
+	// Tabla y registro como referencia cuando la transacción toca una sola fila
+	if len(changes) == 1 {
+		entry.Table = changes[0].Table
+		entry.RecordID = changes[0].RecordID
+	}
+
+	// El índice lo asigna SQLite: el cambio ya tomó el lock de escritura de la base de
+	// datos, así que el orden de los índices coincide con el orden de commit
+	if err := tx.Session(&gorm.Session{NewDB: true}).Create(&entry).Error; err != nil {
+		return 0, fmt.Errorf("error appending to replication log: %v", err)
+	}
+
+	return entry.Index, nil
+}
+
+// toMessage convierte una entrada del log en un mensaje de replicación
+func (entry ReplicationLogEntry) toMessage(leaderID string, term, prevTerm uint64) (ReplicationMessage, error) {
+	message := ReplicationMessage{
+		Operation:   entry.Operation,
+		Table:       entry.Table,
+		LeaderID:    leaderID,
+		Term:        term,
+		Timestamp:   entry.CreatedAt,
+		RecordID:    entry.RecordID,
+		Index:       entry.Index,
+		EntryTerm:   entry.Term,
+		PrevTerm:    prevTerm,
+		RequestID:   entry.RequestID,
+		TraceParent: entry.TraceParent,
+	}
+
+	if entry.Data != "" {
+		var target interface{}
+		switch entry.Operation {
+		case "BATCH":
+			target = &message.Changes
+		case "EXEC":
+			message.Statement = &SQLStatement{}
+			target = message.Statement
+		default:
+			target = &message.Data
+		}
+		if err := json.Unmarshal([]byte(entry.Data), target); err != nil {
+			return ReplicationMessage{}, fmt.Errorf("error decoding log entry %d: %v", entry.Index, err)
+		}
+	}
+
+	return message, nil
+}
+
+// logEntryFromMessage construye la entrada del log local para un mensaje aplicado
+func logEntryFromMessage(message ReplicationMessage) (ReplicationLogEntry, error) {
+	var payload interface{} = message.Data
+	switch message.Operation {
+	case "BATCH":
+		payload = message.Changes
+	case "EXEC":
+		payload = message.Statement
+	}
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return ReplicationLogEntry{}, fmt.Errorf("error marshaling replication data: %v", err)
+	}
+
+	return ReplicationLogEntry{
+		Index:       message.Index,
+		Term:        message.EntryTerm,
+		Operation:   message.Operation,
+		Table:       message.Table,
+		RecordID:    message.RecordID,
+		Data:        string(jsonData),
+		RequestID:   message.RequestID,
+		TraceParent: message.TraceParent,
+		CreatedAt:   message.Timestamp,
+	}, nil
+}
+
+// StreamLog escribe en formato NDJSON (un mensaje por línea) todas las entradas del
+// log a partir del índice dado. Lo usan los seguidores para recuperar mensajes perdidos.
+func (cs *ClusterState) StreamLog(db *gorm.DB, from uint64, w *bufio.Writer) error {
+	if from == 0 {
+		from = 1
+	}
+
+	leaderID := cs.GetCurrentNodeID()
+	term := cs.GetCurrentTerm()
+
+	prevTerm, err := logTermAt(db, from-1)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(w)
+	for {
+		entries, err := readLogFrom(db, from, 500)
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+
+		for _, entry := range entries {
+			message, err := entry.toMessage(leaderID, term, prevTerm)
+			if err != nil {
+				return err
+			}
+			if err := encoder.Encode(message); err != nil {
+				return fmt.Errorf("error writing log entry %d: %v", entry.Index, err)
+			}
+			prevTerm = entry.Term
+			from = entry.Index + 1
+		}
+
+		if err := w.Flush(); err != nil {
+			return fmt.Errorf("error flushing log stream: %v", err)
+		}
+	}
+}
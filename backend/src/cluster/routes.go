@@ -0,0 +1,281 @@
+package cluster
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RouteClass indica qué nodo puede atender una ruta
+type RouteClass string
+
+const (
+	RouteReadOnly   RouteClass = "read-only"   // Solo lee datos: la atiende cualquier nodo
+	RouteLeaderOnly RouteClass = "leader-only" // Modifica datos replicados: la atiende el líder
+	RouteLocalOnly  RouteClass = "local-only"  // Solo afecta al nodo que la recibe (endpoints del cluster, logout)
+)
+
+// classifiedRoute es una ruta registrada con su clase
+type classifiedRoute struct {
+	path     string
+	segments []string
+	class    RouteClass
+}
+
+// routeTable guarda las rutas de cada método en el orden de registro, el mismo en que
+// Fiber las compara
+type routeTable map[string][]classifiedRoute
+
+// Router registra las rutas de la aplicación declarando a la vez su clase, que usa
+// ReplicationMiddleware para decidir qué nodo atiende cada petición:
+//
+//	auth := ClusterState.Router(app).Group("/api/v1/auth")
+//	auth.Post("/signup", cluster.RouteLeaderOnly, controllers.Signup)
+//
+// Todas las rutas deben registrarse con un Router: ClassifyRoutes rechaza al arrancar
+// las que se registraron directamente en la app.
+type Router struct {
+	cs     *ClusterState
+	router fiber.Router
+	prefix string
+}
+
+// Router crea un Router que registra las rutas en la app o grupo dado
+func (cs *ClusterState) Router(router fiber.Router) *Router {
+	return &Router{cs: cs, router: router}
+}
+
+// Group crea un grupo de rutas con el prefijo y los middleware dados
+func (r *Router) Group(prefix string, handlers ...fiber.Handler) *Router {
+	return &Router{
+		cs:     r.cs,
+		router: r.router.Group(prefix, handlers...),
+		prefix: groupPath(r.prefix, prefix),
+	}
+}
+
+// Get registra una ruta GET (y la ruta HEAD que Fiber agrega con ella)
+func (r *Router) Get(path string, class RouteClass, handlers ...fiber.Handler) {
+	r.router.Get(path, handlers...)
+	r.cs.declareRoute(fiber.MethodHead, groupPath(r.prefix, path), class)
+	r.cs.declareRoute(fiber.MethodGet, groupPath(r.prefix, path), class)
+}
+
+// Post registra una ruta POST
+func (r *Router) Post(path string, class RouteClass, handlers ...fiber.Handler) {
+	r.Add(fiber.MethodPost, path, class, handlers...)
+}
+
+// Put registra una ruta PUT
+func (r *Router) Put(path string, class RouteClass, handlers ...fiber.Handler) {
+	r.Add(fiber.MethodPut, path, class, handlers...)
+}
+
+// Patch registra una ruta PATCH
+func (r *Router) Patch(path string, class RouteClass, handlers ...fiber.Handler) {
+	r.Add(fiber.MethodPatch, path, class, handlers...)
+}
+
+// Delete registra una ruta DELETE
+func (r *Router) Delete(path string, class RouteClass, handlers ...fiber.Handler) {
+	r.Add(fiber.MethodDelete, path, class, handlers...)
+}
+
+// Add registra una ruta del método dado
+func (r *Router) Add(method, path string, class RouteClass, handlers ...fiber.Handler) {
+	r.router.Add(method, path, handlers...)
+	r.cs.declareRoute(method, groupPath(r.prefix, path), class)
+}
+
+// groupPath une el prefijo de un grupo y el path de una ruta como lo hace Fiber
+func groupPath(prefix, path string) string {
+	if path == "" {
+		return prefix
+	}
+	if path[0] != '/' {
+		path = "/" + path
+	}
+	return strings.TrimRight(prefix, "/") + path
+}
+
+// declareRoute agrega una ruta con su clase a las declaradas
+func (cs *ClusterState) declareRoute(method, path string, class RouteClass) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if cs.declaredRoutes == nil {
+		cs.declaredRoutes = make(routeTable)
+	}
+	cs.declaredRoutes[method] = append(cs.declaredRoutes[method], classifiedRoute{
+		path:     path,
+		segments: pathSegments(path),
+		class:    class,
+	})
+}
+
+// ClassifyRoutes activa las clases declaradas con Router. Si alguna ruta de la app no
+// se registró con un Router se retorna un error, para no arrancar con rutas cuya
+// clase se adivina por el método.
+//
+// Las peticiones se comparan con las rutas como lo hace Fiber con su configuración por
+// defecto, pero solo con patrones de segmentos completos: textos fijos, parámetros
+// (:id, :id?) y un comodín final (*, +). Las rutas con otros patrones (/:a-:b,
+// /file.:ext) y las apps con CaseSensitive o StrictRouting se rechazan, porque una
+// petición a esas rutas podría clasificarse con la clase de otra ruta.
+func (cs *ClusterState) ClassifyRoutes(app *fiber.App) error {
+	if config := app.Config(); config.CaseSensitive || config.StrictRouting {
+		return errors.New("route classes do not support the CaseSensitive and StrictRouting options")
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	declared := make(map[string]bool)
+	var unsupported []string
+	for method, routes := range cs.declaredRoutes {
+		for _, route := range routes {
+			declared[method+" "+strings.Join(route.segments, "/")] = true
+			if !supportedRoutePattern(route.segments) {
+				unsupported = append(unsupported, method+" "+route.path)
+			}
+		}
+	}
+
+	if len(unsupported) > 0 {
+		sort.Strings(unsupported)
+		return fmt.Errorf("route patterns not supported by route classes (use whole-segment parameters): %s",
+			strings.Join(unsupported, ", "))
+	}
+
+	// GetRoutes(true) omite los middleware (app.Use, grupos y archivos estáticos)
+	var missing []string
+	for _, route := range app.GetRoutes(true) {
+		if !declared[route.Method+" "+strings.Join(pathSegments(route.Path), "/")] {
+			missing = append(missing, route.Method+" "+route.Path)
+		}
+	}
+
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("routes registered without a class (register them with ClusterState.Router): %s",
+			strings.Join(missing, ", "))
+	}
+
+	cs.routes = cs.declaredRoutes
+	return nil
+}
+
+// routeClass retorna la clase de la ruta que atiende la petición. Sin rutas
+// clasificadas se decide por el método; una petición sin ruta la responde el propio
+// nodo (404).
+func (cs *ClusterState) routeClass(method, path string) RouteClass {
+	cs.mu.RLock()
+	table := cs.routes
+	cs.mu.RUnlock()
+
+	if table == nil {
+		if isClusterEndpoint(path) || !isWriteOperation(method) {
+			return RouteLocalOnly
+		}
+		return RouteLeaderOnly
+	}
+
+	if route, found := matchRoute(table, method, path); found {
+		return route.class
+	}
+	return RouteLocalOnly
+}
+
+// routePattern retorna el patrón de la ruta que atiende la petición ("unmatched" si no
+// hay ninguna o las rutas todavía no están clasificadas)
+func (cs *ClusterState) routePattern(method, path string) string {
+	cs.mu.RLock()
+	table := cs.routes
+	cs.mu.RUnlock()
+
+	if route, found := matchRoute(table, method, path); found {
+		return route.path
+	}
+	return "unmatched"
+}
+
+// matchRoute busca la primera ruta del método que coincide con el path
+func matchRoute(table routeTable, method, path string) (classifiedRoute, bool) {
+	segments := pathSegments(path)
+	for _, route := range table[method] {
+		if matchSegments(route.segments, segments) {
+			return route, true
+		}
+	}
+	return classifiedRoute{}, false
+}
+
+// pathSegments divide un path en segmentos como lo compara Fiber por defecto: sin
+// distinguir mayúsculas ni la barra final
+func pathSegments(path string) []string {
+	path = strings.Trim(strings.ToLower(path), "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+// supportedRoutePattern indica si matchSegments compara el patrón igual que Fiber: cada
+// segmento es un texto fijo o un parámetro completo, los parámetros opcionales solo
+// van al final y el comodín es el último segmento
+func supportedRoutePattern(segments []string) bool {
+	optional := false
+	for i, segment := range segments {
+		switch {
+		case segment == "*" || segment == "+":
+			if i != len(segments)-1 {
+				return false
+			}
+		case strings.HasPrefix(segment, ":"):
+			name, isOptional := strings.CutSuffix(segment[1:], "?")
+			if name == "" || strings.IndexFunc(name, func(r rune) bool {
+				return r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r)
+			}) >= 0 {
+				return false
+			}
+			if optional && !isOptional {
+				return false
+			}
+			optional = isOptional
+		case strings.ContainsAny(segment, ":*+?\\"):
+			return false
+		default:
+			if optional {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// matchSegments compara un path con el patrón de una ruta (:param, :param? y *)
+func matchSegments(pattern, path []string) bool {
+	for i, segment := range pattern {
+		if segment == "*" || segment == "+" {
+			return true
+		}
+		optional := strings.HasPrefix(segment, ":") && strings.HasSuffix(segment, "?")
+		if i >= len(path) {
+			if optional {
+				continue
+			}
+			return false
+		}
+		if strings.HasPrefix(segment, ":") {
+			continue
+		}
+		if segment != path[i] {
+			return false
+		}
+	}
+	return len(path) <= len(pattern)
+}
@@ -0,0 +1,191 @@
+package cluster_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/theleywin/Backend-Talent-Nest/src/cluster"
+	"github.com/theleywin/Backend-Talent-Nest/src/routes"
+)
+
+// routeHeader es el header con el que la app espejo informa qué ruta atendió la petición
+const routeHeader = "X-Test-Route"
+
+// newAPIApp registra las rutas del API como main.go y activa sus clases
+func newAPIApp(t *testing.T) (*fiber.App, *cluster.ClusterState) {
+	t.Helper()
+
+	cs := &cluster.ClusterState{}
+	app := fiber.New()
+	router := cs.Router(app)
+	routes.UserRoutes(router)
+	routes.AuthRoutes(router)
+	routes.PostRoutes(router)
+	routes.NotificationRoutes(router)
+	routes.ConnectionRoutes(router)
+
+	if err := cs.ClassifyRoutes(app); err != nil {
+		t.Fatalf("classifying routes: %v", err)
+	}
+	return app, cs
+}
+
+// normalizeRoute compara las rutas sin distinguir mayúsculas ni la barra final, como Fiber
+func normalizeRoute(path string) string {
+	return "/" + strings.Trim(strings.ToLower(path), "/")
+}
+
+func TestRouteClassOfAPIRoutes(t *testing.T) {
+	_, cs := newAPIApp(t)
+
+	tests := []struct {
+		method string
+		path   string
+		class  cluster.RouteClass
+	}{
+		{"POST", "/api/v1/auth/signup", cluster.RouteLeaderOnly},
+		{"POST", "/api/v1/auth/login", cluster.RouteReadOnly},
+		{"POST", "/api/v1/auth/logout", cluster.RouteLocalOnly},
+		{"GET", "/api/v1/auth/me", cluster.RouteReadOnly},
+		{"HEAD", "/api/v1/auth/me", cluster.RouteReadOnly},
+
+		{"GET", "/api/v1/users/suggestions", cluster.RouteReadOnly},
+		{"GET", "/api/v1/users/search", cluster.RouteReadOnly},
+		{"GET", "/api/v1/users/ada", cluster.RouteReadOnly},
+		{"PUT", "/api/v1/users/profile", cluster.RouteLeaderOnly},
+
+		{"GET", "/api/v1/posts", cluster.RouteReadOnly},
+		{"GET", "/api/v1/posts/", cluster.RouteReadOnly},
+		{"POST", "/api/v1/posts/create", cluster.RouteLeaderOnly},
+		{"DELETE", "/api/v1/posts/delete/3", cluster.RouteLeaderOnly},
+		{"GET", "/api/v1/posts/3", cluster.RouteReadOnly},
+		{"POST", "/api/v1/posts/3/comment", cluster.RouteLeaderOnly},
+		{"POST", "/api/v1/posts/3/like", cluster.RouteLeaderOnly},
+
+		{"GET", "/api/v1/notifications", cluster.RouteReadOnly},
+		{"PUT", "/api/v1/notifications/3/read", cluster.RouteLeaderOnly},
+		{"DELETE", "/api/v1/notifications/3", cluster.RouteLeaderOnly},
+
+		{"POST", "/api/v1/connections/request/5", cluster.RouteLeaderOnly},
+		{"PUT", "/api/v1/connections/accept/5", cluster.RouteLeaderOnly},
+		{"PUT", "/api/v1/connections/reject/5", cluster.RouteLeaderOnly},
+		{"GET", "/api/v1/connections/requests", cluster.RouteReadOnly},
+		{"GET", "/api/v1/connections", cluster.RouteReadOnly},
+		{"DELETE", "/api/v1/connections/5", cluster.RouteLeaderOnly},
+		{"GET", "/api/v1/connections/status/5", cluster.RouteReadOnly},
+
+		// Fiber no distingue mayúsculas ni la barra final
+		{"POST", "/API/V1/Posts/3/Like/", cluster.RouteLeaderOnly},
+		{"PUT", "/api/v1/users/PROFILE", cluster.RouteLeaderOnly},
+
+		// Sin ruta la petición la responde el propio nodo (404)
+		{"POST", "/api/v1/posts/3/share", cluster.RouteLocalOnly},
+		{"PATCH", "/api/v1/users/profile", cluster.RouteLocalOnly},
+		{"DELETE", "/api/v1/posts/delete/3/4", cluster.RouteLocalOnly},
+	}
+
+	for _, tt := range tests {
+		if got := cs.RouteClassOf(tt.method, tt.path); got != tt.class {
+			t.Errorf("RouteClassOf(%s %s) = %s, want %s", tt.method, tt.path, got, tt.class)
+		}
+	}
+}
+
+func TestRoutePatternMatchesFiber(t *testing.T) {
+	app, cs := newAPIApp(t)
+
+	// App espejo con las mismas rutas en el mismo orden: responde qué ruta eligió Fiber
+	mirror := fiber.New()
+	registered := app.GetRoutes(true)
+	for _, route := range registered {
+		mirror.Add(route.Method, route.Path, func(c *fiber.Ctx) error {
+			c.Set(routeHeader, c.Route().Path)
+			return nil
+		})
+	}
+
+	for _, route := range registered {
+		concrete := strings.NewReplacer(":userId", "7", ":requestId", "7", ":id", "7", ":username", "ada").Replace(route.Path)
+		for _, path := range []string{concrete, strings.ToUpper(concrete), strings.TrimRight(concrete, "/") + "/"} {
+			resp, err := mirror.Test(httptest.NewRequest(route.Method, path, nil), -1)
+			if err != nil {
+				t.Fatalf("sending %s %s: %v", route.Method, path, err)
+			}
+			resp.Body.Close()
+
+			want := "unmatched"
+			if resp.StatusCode != http.StatusNotFound {
+				want = normalizeRoute(resp.Header.Get(routeHeader))
+			}
+			got := cs.RoutePatternOf(route.Method, path)
+			if got != "unmatched" {
+				got = normalizeRoute(got)
+			}
+			if got != want {
+				t.Errorf("RoutePatternOf(%s %s) = %s, Fiber matched %s", route.Method, path, got, want)
+			}
+		}
+	}
+}
+
+func TestClassifyRoutesRejectsUnsupportedPatterns(t *testing.T) {
+	tests := []struct {
+		name   string
+		path   string
+		config fiber.Config
+	}{
+		{name: "several parameters in a segment", path: "/range/:from-:to"},
+		{name: "parameter with an extension", path: "/files/:name.:ext"},
+		{name: "text before a parameter", path: "/users/id:id"},
+		{name: "wildcard in the middle", path: "/files/*/meta"},
+		{name: "optional parameter in the middle", path: "/posts/:id?/comments"},
+		{name: "case sensitive routing", path: "/posts", config: fiber.Config{CaseSensitive: true}},
+		{name: "strict routing", path: "/posts", config: fiber.Config{StrictRouting: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cs := &cluster.ClusterState{}
+			app := fiber.New(tt.config)
+			cs.Router(app).Post(tt.path, cluster.RouteLeaderOnly, func(c *fiber.Ctx) error { return nil })
+
+			if err := cs.ClassifyRoutes(app); err == nil {
+				t.Errorf("ClassifyRoutes accepted POST %s", tt.path)
+			}
+		})
+	}
+}
+
+func TestClassifyRoutesAcceptsSupportedPatterns(t *testing.T) {
+	cs := &cluster.ClusterState{}
+	app := fiber.New()
+	router := cs.Router(app)
+	handler := func(c *fiber.Ctx) error { return nil }
+	router.Get("/files/*", cluster.RouteReadOnly, handler)
+	router.Get("/posts/:id/:page?", cluster.RouteReadOnly, handler)
+	router.Delete("/posts/:id", cluster.RouteLeaderOnly, handler)
+
+	if err := cs.ClassifyRoutes(app); err != nil {
+		t.Fatalf("ClassifyRoutes: %v", err)
+	}
+
+	tests := []struct {
+		method string
+		path   string
+		class  cluster.RouteClass
+	}{
+		{"GET", "/files/a/b/c", cluster.RouteReadOnly},
+		{"GET", "/posts/3", cluster.RouteReadOnly},
+		{"GET", "/posts/3/2", cluster.RouteReadOnly},
+		{"GET", "/posts/3/2/1", cluster.RouteLocalOnly},
+		{"DELETE", "/posts/3", cluster.RouteLeaderOnly},
+	}
+	for _, tt := range tests {
+		if got := cs.RouteClassOf(tt.method, tt.path); got != tt.class {
+			t.Errorf("RouteClassOf(%s %s) = %s, want %s", tt.method, tt.path, got, tt.class)
+		}
+	}
+}
@@ -0,0 +1,369 @@
+package cluster
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// RowData es la imagen de una fila tal como quedó en la base de datos del líder:
+// cada columna se guarda con el valor crudo que devolvió el driver codificado en JSON
+// (los tiempos en RFC3339 con nanosegundos y los BLOB en base64)
+type RowData map[string]json.RawMessage
+
+// RegisterModels registra los modelos replicados. Los seguidores usan su esquema para
+// decodificar cada columna según el tipo del campo.
+func (cs *ClusterState) RegisterModels(db *gorm.DB, models ...interface{}) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	for _, model := range models {
+		statement := &gorm.Statement{DB: db}
+		if err := statement.Parse(model); err != nil {
+			return fmt.Errorf("error parsing model %T: %v", model, err)
+		}
+		cs.schemas[statement.Schema.Table] = statement.Schema
+	}
+	return nil
+}
+
+// schemaForTable retorna el esquema del modelo registrado para una tabla
+func (cs *ClusterState) schemaForTable(table string) (*schema.Schema, error) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	sch, exists := cs.schemas[table]
+	if !exists {
+		return nil, fmt.Errorf("no model registered for table %s", table)
+	}
+	return sch, nil
+}
+
+// primaryKeysOf retorna las claves primarias de los registros del statement
+// (uno para un struct, varios para un slice o una lista de maps); vacío si no se conocen
+func primaryKeysOf(statement *gorm.Statement, sch *schema.Schema) []interface{} {
+	field := sch.PrioritizedPrimaryField
+	if field == nil {
+		return nil
+	}
+
+	var keys []interface{}
+	collect := func(value reflect.Value) {
+		for value.Kind() == reflect.Ptr {
+			if value.IsNil() {
+				return
+			}
+			value = value.Elem()
+		}
+		if value.Kind() != reflect.Struct {
+			return
+		}
+		if key, isZero := field.ValueOf(statement.Context, value); !isZero {
+			keys = append(keys, key)
+		}
+	}
+
+	switch statement.ReflectValue.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < statement.ReflectValue.Len(); i++ {
+			collect(statement.ReflectValue.Index(i))
+		}
+	default:
+		collect(statement.ReflectValue)
+	}
+
+	if len(keys) > 0 {
+		return keys
+	}
+
+	// Create con maps: GORM agrega el ID generado al map (como "@id" si no hay modelo)
+	addMapKey := func(values map[string]interface{}) {
+		for _, name := range []string{field.DBName, field.Name, "@id"} {
+			if key, exists := values[name]; exists && key != nil && !reflect.ValueOf(key).IsZero() {
+				keys = append(keys, key)
+				return
+			}
+		}
+	}
+	switch dest := statement.Dest.(type) {
+	case map[string]interface{}:
+		addMapKey(dest)
+	case *map[string]interface{}:
+		addMapKey(*dest)
+	case []map[string]interface{}:
+		for _, values := range dest {
+			addMapKey(values)
+		}
+	case *[]map[string]interface{}:
+		for _, values := range *dest {
+			addMapKey(values)
+		}
+	}
+	return keys
+}
+
+// matchingKeys retorna las claves primarias de las filas que cumplen las condiciones
+// del statement. Sin condiciones GORM solo permite el cambio con AllowGlobalUpdate,
+// y entonces afecta a toda la tabla.
+func matchingKeys(db *gorm.DB, sch *schema.Schema) ([]interface{}, error) {
+	query := db.Session(&gorm.Session{NewDB: true}).Table(sch.Table)
+	if db.Statement.Schema != nil {
+		// Con modelo se aplican las mismas reglas que al cambio (borrado lógico,
+		// condiciones sobre la clave primaria como Delete(&Model{}, id))
+		query = query.Model(reflect.New(sch.ModelType).Interface())
+		if db.Statement.Unscoped {
+			query = query.Unscoped()
+		}
+	}
+	if where, exists := db.Statement.Clauses["WHERE"]; exists {
+		if conditions, ok := where.Expression.(clause.Where); ok {
+			query = query.Clauses(conditions)
+		}
+	} else if !db.AllowGlobalUpdate {
+		return nil, nil
+	}
+
+	keys := []interface{}{}
+	if err := query.Pluck(sch.PrioritizedPrimaryField.DBName, &keys).Error; err != nil {
+		return nil, fmt.Errorf("error reading rows affected in %s: %v", sch.Table, err)
+	}
+	return keys, nil
+}
+
+// recordIDOf convierte una clave primaria entera al ID del log (0 si no es entera)
+func recordIDOf(key interface{}) uint {
+	value := reflect.ValueOf(key)
+	switch value.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return uint(value.Uint())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if value.Int() > 0 {
+			return uint(value.Int())
+		}
+	}
+	return 0
+}
+
+// captureBatchSize limita las claves por consulta (SQLite limita los parámetros por sentencia)
+const captureBatchSize = 500
+
+// captureRows lee dentro de la transacción las filas con las claves dadas y retorna su
+// imagen indexada por clave primaria. Se consulta la tabla sin el modelo para incluir
+// también las filas con borrado lógico.
+func captureRows(tx *gorm.DB, sch *schema.Schema, keys []interface{}) (map[string]RowData, error) {
+	images := make(map[string]RowData, len(keys))
+	for start := 0; start < len(keys); start += captureBatchSize {
+		end := start + captureBatchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+		if err := captureBatch(tx, sch, keys[start:end], images); err != nil {
+			return nil, err
+		}
+	}
+	return images, nil
+}
+
+// captureBatch agrega a images la imagen de las filas con las claves dadas
+func captureBatch(tx *gorm.DB, sch *schema.Schema, keys []interface{}, images map[string]RowData) error {
+	query := tx.Session(&gorm.Session{NewDB: true}).
+		Table(sch.Table).
+		Where(clause.IN{Column: clause.Column{Name: sch.PrioritizedPrimaryField.DBName}, Values: keys})
+
+	return scanRowImages(query, sch, func(key interface{}, row RowData) {
+		images[fmt.Sprint(key)] = row
+	})
+}
+
+// scanRowImages ejecuta la consulta y llama a visit con la clave primaria y la imagen
+// de cada fila
+func scanRowImages(query *gorm.DB, sch *schema.Schema, visit func(key interface{}, row RowData)) error {
+	primaryKey := sch.PrioritizedPrimaryField.DBName
+
+	rows, err := query.Rows()
+	if err != nil {
+		return fmt.Errorf("error reading rows from %s: %v", sch.Table, err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return fmt.Errorf("error reading columns of %s: %v", sch.Table, err)
+	}
+
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return fmt.Errorf("error scanning row of %s: %v", sch.Table, err)
+		}
+
+		row := make(RowData, len(columns))
+		var key interface{}
+		for i, column := range columns {
+			encoded, err := json.Marshal(values[i])
+			if err != nil {
+				return fmt.Errorf("error encoding column %s.%s: %v", sch.Table, column, err)
+			}
+			row[column] = encoded
+			if column == primaryKey {
+				key = values[i]
+			}
+		}
+		visit(key, row)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error reading rows from %s: %v", sch.Table, err)
+	}
+
+	return nil
+}
+
+// decodeRow convierte la imagen de una fila en los valores a escribir, usando el tipo
+// de cada campo del esquema
+func decodeRow(sch *schema.Schema, data RowData) (map[string]interface{}, error) {
+	values := make(map[string]interface{}, len(data))
+	for column, raw := range data {
+		value, err := decodeColumn(sch.LookUpField(column), raw)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding column %s.%s: %v", sch.Table, column, err)
+		}
+		values[column] = value
+	}
+	return values, nil
+}
+
+// decodeColumn decodifica el valor de una columna según el tipo de su campo
+func decodeColumn(field *schema.Field, raw json.RawMessage) (interface{}, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+
+	if field != nil {
+		switch field.DataType {
+		case schema.Time:
+			var t time.Time
+			err := json.Unmarshal(raw, &t)
+			return t, err
+		case schema.Bytes:
+			var b []byte
+			err := json.Unmarshal(raw, &b)
+			return b, err
+		case schema.Bool:
+			// SQLite guarda los booleanos como enteros
+			value, err := decodeJSONValue(raw)
+			if n, ok := value.(int64); ok {
+				return n != 0, nil
+			}
+			return value, err
+		case schema.Uint:
+			n, err := strconv.ParseUint(string(raw), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid unsigned integer %s", raw)
+			}
+			return n, nil
+		case schema.Float:
+			f, err := strconv.ParseFloat(string(raw), 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %s", raw)
+			}
+			return f, nil
+		}
+	}
+
+	// Entradas de versiones anteriores guardaban las columnas serializadas como
+	// arrays u objetos JSON: se escriben como el texto JSON que guarda el serializer
+	if raw[0] == '[' || raw[0] == '{' {
+		return string(raw), nil
+	}
+
+	return decodeJSONValue(raw)
+}
+
+// decodeJSONValue decodifica un valor JSON escalar conservando la precisión de los enteros
+func decodeJSONValue(raw json.RawMessage) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	if number, ok := value.(json.Number); ok {
+		if n, err := number.Int64(); err == nil {
+			return n, nil
+		}
+		return number.Float64()
+	}
+	return value, nil
+}
+
+// applyRowChange aplica en un seguidor el cambio de una fila replicada
+func (cs *ClusterState) applyRowChange(tx *gorm.DB, change Change) error {
+	sch, err := cs.schemaForTable(change.Table)
+	if err != nil {
+		return err
+	}
+	if sch.PrioritizedPrimaryField == nil {
+		return fmt.Errorf("table %s has no primary key", change.Table)
+	}
+	primaryKey := sch.PrioritizedPrimaryField.DBName
+
+	// DELETE sin imagen: la fila ya no existe en el líder (borrado físico)
+	if len(change.Data) == 0 {
+		if change.Operation != "DELETE" {
+			return fmt.Errorf("%s on %s without row data", change.Operation, change.Table)
+		}
+		result := tx.Exec("DELETE FROM ? WHERE ? = ?",
+			clause.Table{Name: change.Table}, clause.Column{Name: primaryKey}, change.RecordID)
+		if result.Error != nil {
+			return fmt.Errorf("error deleting from %s: %v", change.Table, result.Error)
+		}
+		return nil
+	}
+
+	values, err := decodeRow(sch, change.Data)
+	if err != nil {
+		return err
+	}
+
+	// Entradas de versiones anteriores solo traían las columnas modificadas
+	if _, complete := values[primaryKey]; !complete {
+		result := tx.Table(change.Table).Where(clause.Eq{Column: clause.Column{Name: primaryKey}, Value: change.RecordID}).Updates(values)
+		if result.Error != nil {
+			return fmt.Errorf("error updating %s: %v", change.Table, result.Error)
+		}
+		return nil
+	}
+
+	// La imagen completa reemplaza la fila, exista o no en el seguidor
+	columns := make([]string, 0, len(values))
+	for column := range values {
+		if column != primaryKey {
+			columns = append(columns, column)
+		}
+	}
+	sort.Strings(columns)
+
+	result := tx.Table(change.Table).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: primaryKey}},
+		DoUpdates: clause.AssignmentColumns(columns),
+	}).Create(values)
+	if result.Error != nil {
+		return fmt.Errorf("error writing row to %s: %v", change.Table, result.Error)
+	}
+	return nil
+}
@@ -0,0 +1,264 @@
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/theleywin/Backend-Talent-Nest/src/lib"
+	"github.com/theleywin/Backend-Talent-Nest/src/migrations"
+	"github.com/theleywin/Backend-Talent-Nest/src/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// newSchemaTestDB abre una base de datos temporal con el esquema de las migraciones de SQLite
+func newSchemaTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	files, err := migrations.For("sqlite")
+	if err != nil {
+		t.Fatalf("loading migrations: %v", err)
+	}
+	schemaMigrations, err := LoadMigrations(files)
+	if err != nil {
+		t.Fatalf("loading migrations: %v", err)
+	}
+
+	db := newTestDB(t)
+	for _, migration := range schemaMigrations {
+		if err := db.Exec(migration.Up).Error; err != nil {
+			t.Fatalf("applying migration %d: %v", migration.Version, err)
+		}
+	}
+	return db
+}
+
+func TestApplyRowChangeRoundTripsModels(t *testing.T) {
+	cs := newTestClusterState(t)
+	cs.schemas = make(map[string]*schema.Schema)
+	leader, follower := newSchemaTestDB(t), newSchemaTestDB(t)
+	if err := cs.RegisterModels(leader, lib.Models...); err != nil {
+		t.Fatalf("registering models: %v", err)
+	}
+
+	// Tiempos con nanosegundos y en otra zona horaria que la local
+	at := time.Date(2024, time.March, 9, 14, 30, 15, 123456789, time.FixedZone("UTC-3", -3*60*60))
+	deleted := gorm.DeletedAt{Time: at.Add(time.Hour), Valid: true}
+
+	tests := []struct {
+		name  string
+		model interface{}
+	}{
+		{name: "user", model: &models.User{
+			Model:    gorm.Model{ID: 1, CreatedAt: at, UpdatedAt: at.Add(time.Second)},
+			Name:     "Ada Lovelace",
+			Username: "ada",
+			Email:    "ada@example.com",
+			Password: "$2a$10$hash",
+			HeadLine: "Mathematician ✨",
+			Skills:   []string{"analysis", "engines"},
+			Experience: []map[string]interface{}{
+				{"title": "Analyst", "company": "Engines Ltd", "from": "1842-01-01T00:00:00Z", "current": true},
+			},
+			Education: []map[string]interface{}{{"school": "Home", "from": float64(1830), "to": float64(1835)}},
+		}},
+		{name: "user without JSON columns", model: &models.User{
+			Model:    gorm.Model{ID: 2, CreatedAt: at, UpdatedAt: at},
+			Username: "bob",
+			Email:    "bob@example.com",
+		}},
+		{name: "connection", model: &models.Connection{
+			Model:       gorm.Model{ID: 1, CreatedAt: at, UpdatedAt: at},
+			SenderID:    1,
+			RecipientID: 2,
+			Status:      models.ConnectionStatusAccepted,
+		}},
+		{name: "post without repost", model: &models.Post{
+			Model:    gorm.Model{ID: 1, CreatedAt: at, UpdatedAt: at},
+			AuthorID: 1,
+			Content:  "First post\nwith two lines",
+			Image:    "https://example.com/a.png",
+		}},
+		{name: "repost", model: &models.Post{
+			Model:    gorm.Model{ID: 2, CreatedAt: at, UpdatedAt: at},
+			AuthorID: 2,
+			RepostID: 1,
+		}},
+		{name: "deleted comment", model: &models.Comment{
+			Model:   gorm.Model{ID: 1, CreatedAt: at, UpdatedAt: at, DeletedAt: deleted},
+			PostID:  1,
+			UserID:  2,
+			Content: "Nice",
+		}},
+		{name: "like", model: &models.Like{
+			Model:  gorm.Model{ID: 1, CreatedAt: at, UpdatedAt: at},
+			PostID: 1,
+			UserID: 2,
+		}},
+		{name: "notification without related rows", model: &models.Notification{
+			Model:       gorm.Model{ID: 1, CreatedAt: at, UpdatedAt: at},
+			RecipientID: 2,
+			Type:        "connectionAccepted",
+		}},
+		{name: "read notification", model: &models.Notification{
+			Model:         gorm.Model{ID: 2, CreatedAt: at, UpdatedAt: at},
+			RecipientID:   1,
+			Type:          "like",
+			RelatedUserID: 2,
+			RelatedPostID: 1,
+			Read:          true,
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := leader.Create(tt.model).Error; err != nil {
+				t.Fatalf("creating row on leader: %v", err)
+			}
+
+			statement := &gorm.Statement{DB: leader}
+			if err := statement.Parse(tt.model); err != nil {
+				t.Fatalf("parsing model: %v", err)
+			}
+			sch, err := cs.schemaForTable(statement.Schema.Table)
+			if err != nil {
+				t.Fatalf("model not registered: %v", err)
+			}
+			id := reflect.ValueOf(tt.model).Elem().FieldByName("ID").Interface()
+
+			leaderRows, err := captureRows(leader, sch, []interface{}{id})
+			if err != nil {
+				t.Fatalf("capturing row on leader: %v", err)
+			}
+			row, exists := leaderRows[fmt.Sprint(id)]
+			if !exists {
+				t.Fatalf("row %v not captured", id)
+			}
+
+			// El cambio viaja serializado en el log de replicación
+			encoded, err := json.Marshal(Change{Operation: "INSERT", Table: sch.Table, RecordID: recordIDOf(id), Data: row})
+			if err != nil {
+				t.Fatalf("encoding change: %v", err)
+			}
+			var change Change
+			if err := json.Unmarshal(encoded, &change); err != nil {
+				t.Fatalf("decoding change: %v", err)
+			}
+			if err := cs.applyRowChange(follower, change); err != nil {
+				t.Fatalf("applying change on follower: %v", err)
+			}
+
+			followerRows, err := captureRows(follower, sch, []interface{}{id})
+			if err != nil {
+				t.Fatalf("capturing row on follower: %v", err)
+			}
+			if !reflect.DeepEqual(followerRows[fmt.Sprint(id)], row) {
+				t.Errorf("follower row = %s, want %s", mustJSON(t, followerRows[fmt.Sprint(id)]), mustJSON(t, row))
+			}
+
+			// SQLite guarda el valor tal como se escribió: quote() distingue el tipo y el
+			// formato (un tiempo escrito como texto RFC3339 se leería igual como time.Time)
+			if stored, want := storedRow(t, follower, sch, id), storedRow(t, leader, sch, id); !reflect.DeepEqual(stored, want) {
+				t.Errorf("stored follower row = %v, want %v", stored, want)
+			}
+
+			onLeader := reflect.New(sch.ModelType).Interface()
+			onFollower := reflect.New(sch.ModelType).Interface()
+			if err := leader.Unscoped().First(onLeader, id).Error; err != nil {
+				t.Fatalf("reading row on leader: %v", err)
+			}
+			if err := follower.Unscoped().First(onFollower, id).Error; err != nil {
+				t.Fatalf("reading row on follower: %v", err)
+			}
+			if !reflect.DeepEqual(onFollower, onLeader) {
+				t.Errorf("follower model = %+v, want %+v", onFollower, onLeader)
+			}
+		})
+	}
+}
+
+func TestDecodeColumn(t *testing.T) {
+	field := func(dataType schema.DataType) *schema.Field {
+		return &schema.Field{DataType: dataType}
+	}
+	at := time.Date(2024, time.March, 9, 14, 30, 15, 123456789, time.UTC)
+
+	tests := []struct {
+		name    string
+		field   *schema.Field
+		raw     string
+		want    interface{}
+		wantErr bool
+	}{
+		{name: "null", field: field(schema.Uint), raw: "null", want: nil},
+		{name: "uint", field: field(schema.Uint), raw: "42", want: uint64(42)},
+		{name: "uint not a number", field: field(schema.Uint), raw: `"42"`, wantErr: true},
+		{name: "uint negative", field: field(schema.Uint), raw: "-1", wantErr: true},
+		{name: "uint fraction", field: field(schema.Uint), raw: "1.5", wantErr: true},
+		{name: "float", field: field(schema.Float), raw: "1.5", want: 1.5},
+		{name: "float not a number", field: field(schema.Float), raw: `"abc"`, wantErr: true},
+		{name: "bool from integer", field: field(schema.Bool), raw: "1", want: true},
+		{name: "time", field: field(schema.Time), raw: `"2024-03-09T14:30:15.123456789Z"`, want: at},
+		{name: "bytes", field: field(schema.Bytes), raw: `"aGk="`, want: []byte("hi")},
+		{name: "legacy JSON column", field: field(schema.String), raw: `["a","b"]`, want: `["a","b"]`},
+		{name: "large integer", raw: "9007199254740993", want: int64(9007199254740993)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeColumn(tt.field, json.RawMessage(tt.raw))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("decodeColumn(%s) = %#v, want error", tt.raw, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decodeColumn(%s): %v", tt.raw, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decodeColumn(%s) = %#v, want %#v", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
+
+// storedRow retorna cada columna de la fila como la representa SQLite con quote()
+func storedRow(t *testing.T, db *gorm.DB, sch *schema.Schema, id interface{}) map[string]string {
+	t.Helper()
+
+	columns := make([]string, len(sch.DBNames))
+	for i, column := range sch.DBNames {
+		columns[i] = "quote(`" + column + "`)"
+	}
+	values := make([]string, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+
+	query := "SELECT " + strings.Join(columns, ", ") + " FROM `" + sch.Table + "` WHERE `" + sch.PrioritizedPrimaryField.DBName + "` = ?"
+	if err := db.Raw(query, id).Row().Scan(pointers...); err != nil {
+		t.Fatalf("reading stored row of %s: %v", sch.Table, err)
+	}
+
+	stored := make(map[string]string, len(columns))
+	for i, column := range sch.DBNames {
+		stored[column] = values[i]
+	}
+	return stored
+}
+
+// mustJSON codifica un valor para mostrarlo en un error
+func mustJSON(t *testing.T, value interface{}) string {
+	t.Helper()
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		t.Fatalf("encoding %v: %v", value, err)
+	}
+	return string(encoded)
+}
@@ -0,0 +1,63 @@
+package cluster
+
+import (
+	"log/slog"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// SetSharedDatabase indica si todos los nodos usan la misma base de datos externa
+// (PostgreSQL, MySQL). En ese modo no se replican los datos: los seguidores no se
+// sincronizan con snapshots ni aplican el log, cualquier nodo atiende las escrituras y
+// no hay verificación anti-entropía. La elección de líder se mantiene para que un solo
+// nodo aplique las migraciones del esquema.
+func (cs *ClusterState) SetSharedDatabase(shared bool) {
+	cs.mu.Lock()
+	cs.sharedDatabase = shared
+	cs.mu.Unlock()
+
+	if shared {
+		slog.Info("Shared database: data replication between nodes disabled")
+	}
+}
+
+// SharedDatabase indica si los nodos comparten la base de datos
+func (cs *ClusterState) SharedDatabase() bool {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	return cs.sharedDatabase
+}
+
+// ReplicatedOnly middleware rechaza las peticiones a los endpoints de replicación,
+// sincronización y verificación cuando los nodos comparten la base de datos
+func ReplicatedOnly(clusterState *ClusterState) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if clusterState.SharedDatabase() {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error":   "Not available with a shared database",
+				"message": "The nodes share the database, so data is not replicated between them",
+			})
+		}
+		return c.Next()
+	}
+}
+
+// followSharedSchemaUnsafe adopta la versión del esquema que informa el líder en el
+// heartbeat, que con una base de datos compartida es también la local. El seguidor
+// está listo cuando el esquema incluye las migraciones que conoce su binario: no hay
+// datos que sincronizar, pero el líder puede estar aplicando migraciones (usar solo
+// con lock)
+func (cs *ClusterState) followSharedSchemaUnsafe(schemaVersion int) {
+	cs.setAppliedSchemaVersionUnsafe(schemaVersion)
+
+	ready := schemaVersion >= cs.codeSchemaVersion
+	if ready == cs.IsReady {
+		return
+	}
+	cs.IsReady = ready
+	if ready {
+		slog.Info("Follower ready, database shared with the leader", "schema_version", schemaVersion)
+	} else {
+		slog.Info("Follower waiting for the leader to apply schema migrations", "schema_version", schemaVersion, "known", cs.codeSchemaVersion)
+	}
+}
@@ -0,0 +1,271 @@
+package cluster
+
+import (
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ShutdownTimeout retorna cuánto puede tardar el líder en traspasar el liderazgo al apagarse
+func ShutdownTimeout() time.Duration {
+	return envDuration("CLUSTER_SHUTDOWN_TIMEOUT", 5*time.Second)
+}
+
+// DrainTimeout retorna cuánto se espera a que terminen las peticiones en curso al apagarse.
+// Junto a ShutdownTimeout debe quedar por debajo del stop_grace_period de Swarm (10s).
+func DrainTimeout() time.Duration {
+	return envDuration("CLUSTER_DRAIN_TIMEOUT", 3*time.Second)
+}
+
+// IsShuttingDown indica si el nodo se está apagando
+func (cs *ClusterState) IsShuttingDown() bool {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	return cs.shuttingDown
+}
+
+// HasLeftCluster indica si el nodo ya anunció su salida del cluster
+func (cs *ClusterState) HasLeftCluster() bool {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	return cs.leftCluster
+}
+
+// beginWrite registra una escritura en el líder; retorna false si el líder se está
+// apagando o cediendo el liderazgo y ya no acepta escrituras
+func (cs *ClusterState) beginWrite() bool {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if cs.shuttingDown || cs.transferring {
+		return false
+	}
+	cs.writesInFlight++
+	return true
+}
+
+// endWrite marca como terminada una escritura registrada con beginWrite
+func (cs *ClusterState) endWrite() {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.writesInFlight--
+}
+
+// Shutdown prepara la salida del nodo. Un seguidor solo deja de participar en
+// elecciones; el líder deja de aceptar escrituras, espera las que están en curso,
+// cede el liderazgo al seguidor más actualizado y anuncia su salida.
+func (cs *ClusterState) Shutdown(timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+
+	cs.mu.Lock()
+	cs.shuttingDown = true
+	isLeader := cs.CurrentRole == Leader
+	cs.mu.Unlock()
+
+	if !isLeader {
+		slog.Info("Follower shutting down, draining requests")
+		return
+	}
+
+	slog.Info("Leader shutting down: rejecting new writes and handing off leadership")
+
+	if !cs.waitForWrites(deadline) {
+		slog.Warn("In-flight writes did not finish before the shutdown timeout")
+	}
+
+	if _, ok := cs.handOffTo(cs.handOffCandidates(), deadline); !ok {
+		// Dejar de enviar heartbeats: el anuncio de salida hace que los seguidores
+		// elijan un nuevo líder sin esperar el timeout de elección
+		slog.Warn("Could not hand off leadership, followers will elect a new leader")
+		cs.stepDown(cs.GetCurrentTerm())
+	}
+
+	cs.announceLeave()
+}
+
+// waitForWrites espera a que terminen las escrituras en curso en el líder
+func (cs *ClusterState) waitForWrites(deadline time.Time) bool {
+	for {
+		cs.mu.RLock()
+		pending := cs.writesInFlight
+		cs.mu.RUnlock()
+
+		if pending == 0 {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// handOffTo pide a los candidatos, en orden, que inicien una elección en cuanto tengan
+// todas las entradas del log, y espera a que uno gane. Retorna el ID del nuevo líder.
+func (cs *ClusterState) handOffTo(candidates []Node, deadline time.Time) (string, bool) {
+	db := cs.getDB()
+	if db == nil {
+		return "", false
+	}
+
+	// Enviar ya las entradas pendientes en lugar de esperar al siguiente ciclo
+	cs.NotifyReplicators()
+
+	cs.mu.RLock()
+	request := TimeoutNowRequest{
+		Term:      cs.CurrentTerm,
+		LeaderID:  cs.CurrentNodeID,
+		LastIndex: LastLogIndex(db),
+	}
+	cs.mu.RUnlock()
+
+	for _, candidate := range candidates {
+		if time.Now().After(deadline) {
+			return "", false
+		}
+
+		var response TimeoutNowResponse
+		if _, err := postJSON(candidate.Address+"/cluster/timeout-now", request, &response); err != nil {
+			slog.Warn("Failed to hand off leadership", "node_id", candidate.ID, "error", err)
+			continue
+		}
+		if response.Term > request.Term {
+			cs.stepDown(response.Term)
+			return cs.waitForNewLeader(deadline)
+		}
+		if !response.Success {
+			slog.Info("Node cannot take over leadership", "node_id", candidate.ID, "last_index", response.LastIndex, "leader_index", request.LastIndex)
+			continue
+		}
+
+		slog.Info("Handing off leadership", "node_id", candidate.ID, "last_index", request.LastIndex)
+		if leaderID, ok := cs.waitForNewLeader(deadline); ok {
+			return leaderID, true
+		}
+		slog.Warn("Node did not take over leadership", "node_id", candidate.ID)
+	}
+
+	return "", false
+}
+
+// handOffCandidates retorna los seguidores que pueden ser líderes ordenados por la
+// última entrada que confirmaron, de mayor a menor
+func (cs *ClusterState) handOffCandidates() []Node {
+	cs.mu.RLock()
+	candidates := make([]Node, 0, len(cs.Nodes))
+	for _, node := range cs.peersUnsafe() {
+		if eligible, _ := cs.leadershipEligibilityUnsafe(node); eligible {
+			candidates = append(candidates, *node)
+		}
+	}
+	cs.mu.RUnlock()
+
+	cs.ackMu.Lock()
+	match := make(map[string]uint64, len(cs.matchIndex))
+	for id, index := range cs.matchIndex {
+		match[id] = index
+	}
+	cs.ackMu.Unlock()
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if match[candidates[i].ID] != match[candidates[j].ID] {
+			return match[candidates[i].ID] > match[candidates[j].ID]
+		}
+		return candidates[i].ID < candidates[j].ID
+	})
+	return candidates
+}
+
+// waitForNewLeader espera a que otro nodo sea el líder (este nodo deja de serlo al
+// recibir la solicitud de voto del candidato con un término mayor) y retorna su ID
+func (cs *ClusterState) waitForNewLeader(deadline time.Time) (string, bool) {
+	for time.Now().Before(deadline) {
+		cs.mu.RLock()
+		leaderID := cs.LeaderID
+		handedOff := cs.CurrentRole != Leader && leaderID != "" && leaderID != cs.CurrentNodeID
+		cs.mu.RUnlock()
+
+		if handedOff {
+			return leaderID, true
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return "", false
+}
+
+// HandleTimeoutNow procesa la cesión del liderazgo: si el mensaje viene del líder
+// actual y el nodo tiene todas sus entradas, inicia una elección de inmediato
+func (cs *ClusterState) HandleTimeoutNow(request TimeoutNowRequest) TimeoutNowResponse {
+	cs.mu.RLock()
+	term := cs.CurrentTerm
+	eligible, _ := cs.selfEligibilityUnsafe()
+	valid := request.Term == term && request.LeaderID == cs.LeaderID &&
+		cs.CurrentRole == Follower && eligible
+	cs.mu.RUnlock()
+
+	db := cs.getDB()
+	if !valid || db == nil {
+		return TimeoutNowResponse{Term: term, Success: false}
+	}
+
+	// El líder ya envió las entradas pendientes; darles tiempo a llegar
+	if !cs.WaitForApplied(request.LastIndex, heartbeatInterval()) {
+		return TimeoutNowResponse{Term: term, Success: false, LastIndex: LastLogIndex(db)}
+	}
+
+	lastLogIndex, lastLogTerm, err := lastLogEntry(db)
+	if err != nil {
+		slog.Warn("Cannot take over leadership", "error", err)
+		return TimeoutNowResponse{Term: term, Success: false}
+	}
+
+	slog.Info("Leader is handing off leadership to this node, starting election", "leader_id", request.LeaderID)
+	go cs.runElection(lastLogIndex, lastLogTerm, true)
+
+	return TimeoutNowResponse{Term: term, Success: true, LastIndex: lastLogIndex}
+}
+
+// announceLeave avisa al resto de nodos de que este nodo sale del cluster, para que lo
+// den por caído sin esperar a que el gossip lo detecte
+func (cs *ClusterState) announceLeave() {
+	cs.mu.Lock()
+	cs.leftCluster = true
+	notice := LeaveNotice{
+		NodeID:   cs.CurrentNodeID,
+		Term:     cs.CurrentTerm,
+		LeaderID: cs.LeaderID,
+	}
+	peers := cs.peersUnsafe()
+	cs.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, peer := range peers {
+		wg.Add(1)
+		go func(node *Node) {
+			defer wg.Done()
+			if _, err := postJSON(node.Address+"/cluster/leave", notice, nil); err != nil {
+				slog.Warn("Failed to announce leave", "node_id", node.ID, "error", err)
+			}
+		}(peer)
+	}
+	wg.Wait()
+
+	slog.Info("Announced leave", "nodes", len(peers), "leader_id", notice.LeaderID)
+}
+
+// HandleLeave marca como caído al nodo que anunció su salida
+func (cs *ClusterState) HandleLeave(notice LeaveNotice) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	node, exists := cs.Nodes[notice.NodeID]
+	if !exists || node.ID == cs.CurrentNodeID {
+		return
+	}
+
+	slog.Info("Node is leaving the cluster", "node_id", notice.NodeID, "term", notice.Term, "leader_id", notice.LeaderID)
+	if node.State != MemberDead {
+		cs.setStateUnsafe(node, MemberDead)
+	}
+}
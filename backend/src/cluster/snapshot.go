@@ -0,0 +1,344 @@
+package cluster
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// snapshotIDPattern valida los IDs de snapshot recibidos por HTTP
+var snapshotIDPattern = regexp.MustCompile(`^[0-9a-f]{16}$`)
+
+// snapshotClient descarga el manifiesto y las partes del snapshot (el timeout aplica a cada parte)
+var snapshotClient = newClusterClient(60 * time.Second)
+
+// snapshotDir retorna el directorio donde el líder guarda los snapshots
+func snapshotDir() string {
+	return filepath.Join(clusterDataDir(), "snapshots")
+}
+
+// snapshotChunkSize retorna el tamaño de cada parte del snapshot en bytes
+func snapshotChunkSize() int64 {
+	return int64(envInt("CLUSTER_SNAPSHOT_CHUNK_SIZE", 4*1024*1024))
+}
+
+// createSnapshot copia la base de datos con VACUUM INTO, que lee dentro de una
+// transacción y produce un archivo consistente sin bloquear las escrituras
+func createSnapshot(db *gorm.DB) (SnapshotManifest, error) {
+	dir := snapshotDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return SnapshotManifest{}, fmt.Errorf("error creating snapshot directory: %v", err)
+	}
+	removeOldSnapshots(dir, 10*time.Minute)
+
+	idBytes := make([]byte, 8)
+	if _, err := rand.Read(idBytes); err != nil {
+		return SnapshotManifest{}, fmt.Errorf("error generating snapshot id: %v", err)
+	}
+	snapshotID := hex.EncodeToString(idBytes)
+	path := filepath.Join(dir, snapshotID+".db")
+
+	if err := db.Exec("VACUUM INTO ?", path).Error; err != nil {
+		os.Remove(path)
+		return SnapshotManifest{}, fmt.Errorf("error creating snapshot: %v", err)
+	}
+
+	manifest, err := buildManifest(snapshotID, path)
+	if err != nil {
+		os.Remove(path)
+		return SnapshotManifest{}, err
+	}
+
+	return manifest, nil
+}
+
+// buildManifest calcula el hash del archivo completo y de cada parte
+func buildManifest(snapshotID, path string) (SnapshotManifest, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return SnapshotManifest{}, fmt.Errorf("error opening snapshot: %v", err)
+	}
+	defer file.Close()
+
+	manifest := SnapshotManifest{
+		SnapshotID: snapshotID,
+		ChunkSize:  snapshotChunkSize(),
+	}
+
+	fileHash := sha256.New()
+	for index := 0; ; index++ {
+		chunkHash := sha256.New()
+		written, err := io.CopyN(io.MultiWriter(fileHash, chunkHash), file, manifest.ChunkSize)
+		if written > 0 {
+			manifest.Chunks = append(manifest.Chunks, SnapshotChunk{
+				Index:  index,
+				Offset: manifest.Size,
+				Size:   written,
+				SHA256: hex.EncodeToString(chunkHash.Sum(nil)),
+			})
+			manifest.Size += written
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return SnapshotManifest{}, fmt.Errorf("error reading snapshot: %v", err)
+		}
+	}
+	manifest.SHA256 = hex.EncodeToString(fileHash.Sum(nil))
+
+	// La última entrada del log incluida en el snapshot indica desde dónde continuar
+	snapshotDB, err := openReadOnly(path)
+	if err != nil {
+		return SnapshotManifest{}, err
+	}
+	manifest.LastIndex = LastLogIndex(snapshotDB)
+	if sqlDB, err := snapshotDB.DB(); err == nil {
+		sqlDB.Close()
+	}
+
+	return manifest, nil
+}
+
+// removeOldSnapshots borra los snapshots creados hace más de maxAge
+func removeOldSnapshots(dir string, maxAge time.Duration) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < maxAge {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, entry.Name())); err == nil {
+			slog.Debug("Removed old snapshot", "file", entry.Name())
+		}
+	}
+}
+
+// snapshotChunkReader lee una parte de un archivo de snapshot y cierra el archivo al terminar
+type snapshotChunkReader struct {
+	*io.SectionReader
+	file *os.File
+}
+
+// Close cierra el archivo del snapshot
+func (r *snapshotChunkReader) Close() error {
+	return r.file.Close()
+}
+
+// OpenSnapshotChunk abre la parte indicada de un snapshot para enviarla en streaming
+// y retorna su tamaño en bytes
+func OpenSnapshotChunk(snapshotID string, index int) (io.ReadCloser, int64, error) {
+	if !snapshotIDPattern.MatchString(snapshotID) {
+		return nil, 0, fmt.Errorf("invalid snapshot id")
+	}
+
+	file, err := os.Open(filepath.Join(snapshotDir(), snapshotID+".db"))
+	if err != nil {
+		return nil, 0, fmt.Errorf("snapshot not found: %v", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, fmt.Errorf("error reading snapshot: %v", err)
+	}
+
+	chunkSize := snapshotChunkSize()
+	offset := int64(index) * chunkSize
+	if index < 0 || offset >= info.Size() {
+		file.Close()
+		return nil, 0, fmt.Errorf("chunk %d out of range", index)
+	}
+	size := min(chunkSize, info.Size()-offset)
+
+	return &snapshotChunkReader{
+		SectionReader: io.NewSectionReader(file, offset, size),
+		file:          file,
+	}, size, nil
+}
+
+// downloadSnapshot descarga todas las partes en un archivo temporal verificando los hashes
+func downloadSnapshot(leaderAddress string, manifest SnapshotManifest, path string) error {
+	if !snapshotIDPattern.MatchString(manifest.SnapshotID) {
+		return fmt.Errorf("invalid snapshot id %q", manifest.SnapshotID)
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("error creating snapshot file: %v", err)
+	}
+	defer file.Close()
+
+	fileHash := sha256.New()
+	for _, chunk := range manifest.Chunks {
+		var data []byte
+		var err error
+
+		// Reintentar cada parte por separado: un fallo no obliga a empezar de nuevo
+		for attempt := 1; attempt <= 3; attempt++ {
+			data, err = downloadChunk(leaderAddress, manifest.SnapshotID, chunk)
+			if err == nil {
+				break
+			}
+			slog.Warn("Error downloading snapshot chunk", "chunk", chunk.Index, "attempt", attempt, "error", err)
+			time.Sleep(time.Duration(attempt) * time.Second)
+		}
+		if err != nil {
+			return err
+		}
+
+		fileHash.Write(data)
+		if _, err := file.Write(data); err != nil {
+			return fmt.Errorf("error writing snapshot chunk %d: %v", chunk.Index, err)
+		}
+	}
+
+	if checksum := hex.EncodeToString(fileHash.Sum(nil)); checksum != manifest.SHA256 {
+		return fmt.Errorf("snapshot checksum mismatch: expected %s, got %s", manifest.SHA256, checksum)
+	}
+
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("error syncing snapshot file: %v", err)
+	}
+
+	return nil
+}
+
+// downloadChunk descarga y verifica una parte del snapshot
+func downloadChunk(leaderAddress, snapshotID string, chunk SnapshotChunk) ([]byte, error) {
+	url := fmt.Sprintf("%s/cluster/sync/%s/chunks/%d", leaderAddress, snapshotID, chunk.Index)
+
+	resp, err := snapshotClient.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("error requesting chunk: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("chunk request failed with status: %d", resp.StatusCode)
+	}
+
+	// Nunca leer más de lo anunciado en el manifiesto
+	data, err := io.ReadAll(io.LimitReader(resp.Body, chunk.Size+1))
+	if err != nil {
+		return nil, fmt.Errorf("error reading chunk: %v", err)
+	}
+	if int64(len(data)) != chunk.Size {
+		return nil, fmt.Errorf("chunk size mismatch: expected %d, got %d", chunk.Size, len(data))
+	}
+
+	sum := sha256.Sum256(data)
+	if checksum := hex.EncodeToString(sum[:]); checksum != chunk.SHA256 {
+		return nil, fmt.Errorf("chunk checksum mismatch: expected %s, got %s", chunk.SHA256, checksum)
+	}
+
+	return data, nil
+}
+
+// installSnapshot verifica el snapshot descargado, cierra la conexión actual, reemplaza
+// el archivo de la base de datos con un rename atómico y vuelve a abrir la conexión
+func (cs *ClusterState) installSnapshot(snapshotPath string) error {
+	if err := checkSnapshotIntegrity(snapshotPath); err != nil {
+		return err
+	}
+
+	if cs.ReopenDatabase == nil || cs.DrainDatabase == nil {
+		return fmt.Errorf("database reopen is not configured")
+	}
+
+	// Ninguna petición puede seguir usando la conexión que se va a cerrar. Se drena
+	// antes de tomar applyMu: una petición de replicación en curso lo espera.
+	resume := cs.DrainDatabase()
+	defer resume()
+
+	// Ningún mensaje de replicación puede aplicarse mientras se cambia el archivo
+	cs.applyMu.Lock()
+	defer cs.applyMu.Unlock()
+
+	if sqlDB, err := cs.getDB().DB(); err == nil {
+		if err := sqlDB.Close(); err != nil {
+			slog.Warn("Error closing database before swap", "error", err)
+		}
+	}
+
+	// Un journal de la base anterior se aplicaría sobre el archivo nuevo y lo corrompería
+	dbPath := databasePath()
+	for _, suffix := range []string{"-journal", "-wal", "-shm"} {
+		if err := os.Remove(dbPath + suffix); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("error removing %s: %v", dbPath+suffix, err)
+		}
+	}
+
+	if err := os.Rename(snapshotPath, dbPath); err != nil {
+		return fmt.Errorf("error replacing database file: %v", err)
+	}
+
+	// Asegurar que el rename queda persistido en el directorio
+	if dir, err := os.Open(filepath.Dir(dbPath)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+
+	db, err := cs.ReopenDatabase()
+	if err != nil {
+		return fmt.Errorf("error reopening database: %v", err)
+	}
+
+	cs.mu.Lock()
+	cs.db = db
+	cs.mu.Unlock()
+
+	// El snapshot trae el esquema del líder con sus migraciones aplicadas
+	cs.refreshSchemaVersion(db)
+	cs.notifyApplied()
+	return nil
+}
+
+// checkSnapshotIntegrity ejecuta PRAGMA quick_check sobre el snapshot descargado
+func checkSnapshotIntegrity(path string) error {
+	db, err := openReadOnly(path)
+	if err != nil {
+		return err
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		defer sqlDB.Close()
+	}
+
+	var results []string
+	if err := db.Raw("PRAGMA quick_check").Scan(&results).Error; err != nil {
+		return fmt.Errorf("error checking snapshot integrity: %v", err)
+	}
+	if len(results) != 1 || results[0] != "ok" {
+		return fmt.Errorf("snapshot integrity check failed: %s", strings.Join(results, "; "))
+	}
+
+	return nil
+}
+
+// openReadOnly abre un archivo SQLite en modo solo lectura
+func openReadOnly(path string) (*gorm.DB, error) {
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=ro", path)), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error opening snapshot: %v", err)
+	}
+	return db, nil
+}
@@ -0,0 +1,307 @@
+package cluster
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SQLStatement es una sentencia SQL escrita a mano (db.Exec) que se replica tal cual.
+// Las funciones no deterministas de SQLite (CURRENT_TIMESTAMP, random()) se evalúan
+// de nuevo en cada seguidor, así que las escrituras deben pasar esos valores como parámetros.
+type SQLStatement struct {
+	SQL  string   `json:"sql"`
+	Vars []SQLArg `json:"vars,omitempty"`
+}
+
+// SQLArg es un parámetro de una sentencia con su tipo, para reconstruir el mismo valor
+// en el seguidor (JSON no distingue enteros de reales ni tiempos de strings)
+type SQLArg struct {
+	Type  string          `json:"type"` // null, int, uint, float, bool, string, bytes, time
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// isReplicatedSQL indica si una sentencia modifica datos y debe replicarse. Las
+// sentencias de esquema y de mantenimiento (VACUUM, PRAGMA) son locales a cada nodo,
+// igual que las escrituras en las tablas del propio mecanismo de replicación.
+func isReplicatedSQL(sql string) bool {
+	operation, table := sqlTarget(sql)
+	return operation != "" && !isInternalTable(table)
+}
+
+// sqlWriteKeywords son las operaciones que modifican datos
+var sqlWriteKeywords = map[string]bool{"INSERT": true, "UPDATE": true, "DELETE": true, "REPLACE": true}
+
+// sqlTargetModifiers son las palabras que pueden ir entre la operación y la tabla
+// (INSERT OR IGNORE INTO, DELETE FROM, UPDATE ONLY, INSERT LOW_PRIORITY ...)
+var sqlTargetModifiers = map[string]bool{
+	"INTO": true, "FROM": true, "ONLY": true, "OR": true, "ROLLBACK": true, "ABORT": true,
+	"REPLACE": true, "FAIL": true, "IGNORE": true, "LOW_PRIORITY": true, "DELAYED": true,
+	"HIGH_PRIORITY": true, "QUICK": true,
+}
+
+// sqlTarget retorna la operación (INSERT, UPDATE, DELETE o REPLACE) y la tabla, en
+// minúsculas y sin el esquema, que modifica la sentencia. Las expresiones comunes
+// (WITH ... AS (...)) que preceden a la operación se saltan. operation es "" si la
+// sentencia no modifica datos y table es "" si no se pudo leer el nombre.
+func sqlTarget(sql string) (operation, table string) {
+	tokens := tokenizeSQL(sql)
+	keyword := func(i int) string {
+		if i >= len(tokens) || tokens[i].kind != sqlWord {
+			return ""
+		}
+		return strings.ToUpper(tokens[i].text)
+	}
+
+	pos := 0
+	if keyword(pos) == "WITH" {
+		// La operación es la primera palabra clave fuera de los paréntesis de las expresiones
+		depth := 0
+		for pos++; pos < len(tokens); pos++ {
+			if tokens[pos].kind == sqlSymbol {
+				switch tokens[pos].text {
+				case "(":
+					depth++
+				case ")":
+					depth--
+				}
+				continue
+			}
+			if word := keyword(pos); depth == 0 && (sqlWriteKeywords[word] || word == "SELECT" || word == "VALUES") {
+				break
+			}
+		}
+	}
+
+	operation = keyword(pos)
+	if !sqlWriteKeywords[operation] {
+		return "", ""
+	}
+
+	pos++
+	for sqlTargetModifiers[keyword(pos)] {
+		pos++
+	}
+
+	// Nombre con esquema opcional (main.users, "public"."users"): interesa la tabla
+	for pos < len(tokens) && (tokens[pos].kind == sqlWord || tokens[pos].kind == sqlIdentifier) {
+		table = tokens[pos].text
+		if pos+1 >= len(tokens) || tokens[pos+1].text != "." {
+			break
+		}
+		pos += 2
+	}
+
+	return operation, strings.ToLower(table)
+}
+
+// sqlTokenKind es el tipo de un token de una sentencia SQL
+type sqlTokenKind int
+
+const (
+	sqlWord       sqlTokenKind = iota // Palabra clave o identificador sin comillas
+	sqlIdentifier                     // Identificador entre comillas ("t", `t`, [t])
+	sqlLiteral                        // Literal de texto ('...'), sin su contenido
+	sqlSymbol                         // Cualquier otro carácter
+)
+
+// sqlToken es un token de una sentencia SQL
+type sqlToken struct {
+	kind sqlTokenKind
+	text string
+}
+
+// tokenizeSQL divide una sentencia en tokens, sin espacios ni comentarios
+func tokenizeSQL(sql string) []sqlToken {
+	var tokens []sqlToken
+	for i := 0; i < len(sql); {
+		ch := sql[i]
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r':
+			i++
+		case strings.HasPrefix(sql[i:], "--"):
+			end := strings.IndexByte(sql[i:], '\n')
+			if end < 0 {
+				return tokens
+			}
+			i += end + 1
+		case strings.HasPrefix(sql[i:], "/*"):
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				return tokens
+			}
+			i += end + 4
+		case ch == '\'':
+			_, i = scanQuoted(sql, i, '\'')
+			tokens = append(tokens, sqlToken{kind: sqlLiteral, text: "''"})
+		case ch == '"' || ch == '`' || ch == '[':
+			closing := ch
+			if ch == '[' {
+				closing = ']'
+			}
+			var text string
+			text, i = scanQuoted(sql, i, closing)
+			tokens = append(tokens, sqlToken{kind: sqlIdentifier, text: text})
+		case isSQLWordByte(ch):
+			start := i
+			for i < len(sql) && isSQLWordByte(sql[i]) {
+				i++
+			}
+			tokens = append(tokens, sqlToken{kind: sqlWord, text: sql[start:i]})
+		default:
+			tokens = append(tokens, sqlToken{kind: sqlSymbol, text: string(ch)})
+			i++
+		}
+	}
+	return tokens
+}
+
+// scanQuoted lee el texto entre comillas que empieza en start (una comilla de cierre
+// duplicada es parte del texto) y retorna el texto y la posición siguiente al cierre
+func scanQuoted(sql string, start int, closing byte) (string, int) {
+	var text strings.Builder
+	for i := start + 1; i < len(sql); i++ {
+		if sql[i] != closing {
+			text.WriteByte(sql[i])
+			continue
+		}
+		if i+1 < len(sql) && sql[i+1] == closing {
+			text.WriteByte(closing)
+			i++
+			continue
+		}
+		return text.String(), i + 1
+	}
+	return text.String(), len(sql)
+}
+
+// isSQLWordByte indica si el carácter puede formar parte de una palabra o identificador sin comillas
+func isSQLWordByte(ch byte) bool {
+	return ch == '_' || ch == '$' || ch >= '0' && ch <= '9' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= 0x80
+}
+
+// newSQLStatement codifica una sentencia ejecutada y sus parámetros
+func newSQLStatement(sql string, vars []interface{}) (SQLStatement, error) {
+	statement := SQLStatement{SQL: sql, Vars: make([]SQLArg, 0, len(vars))}
+	for i, value := range vars {
+		arg, err := encodeSQLArg(value)
+		if err != nil {
+			return SQLStatement{}, fmt.Errorf("error encoding parameter %d: %v", i+1, err)
+		}
+		statement.Vars = append(statement.Vars, arg)
+	}
+	return statement, nil
+}
+
+// encodeSQLArg codifica un parámetro según el valor que recibiría el driver
+func encodeSQLArg(value interface{}) (SQLArg, error) {
+	if valuer, ok := value.(driver.Valuer); ok {
+		v, err := valuer.Value()
+		if err != nil {
+			return SQLArg{}, err
+		}
+		value = v
+	}
+
+	var kind string
+	switch v := value.(type) {
+	case nil:
+		return SQLArg{Type: "null"}, nil
+	case time.Time:
+		kind = "time"
+	case []byte:
+		kind = "bytes"
+	default:
+		rv := reflect.ValueOf(v)
+		switch rv.Kind() {
+		case reflect.Ptr:
+			if rv.IsNil() {
+				return SQLArg{Type: "null"}, nil
+			}
+			return encodeSQLArg(rv.Elem().Interface())
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			kind, value = "int", rv.Int()
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			kind, value = "uint", rv.Uint()
+		case reflect.Float32, reflect.Float64:
+			kind, value = "float", rv.Float()
+		case reflect.Bool:
+			kind, value = "bool", rv.Bool()
+		case reflect.String:
+			kind, value = "string", rv.String()
+		default:
+			return SQLArg{}, fmt.Errorf("unsupported parameter type %T", v)
+		}
+	}
+
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return SQLArg{}, err
+	}
+	return SQLArg{Type: kind, Value: encoded}, nil
+}
+
+// decodeSQLArg reconstruye el valor de un parámetro
+func decodeSQLArg(arg SQLArg) (interface{}, error) {
+	var err error
+	switch arg.Type {
+	case "null":
+		return nil, nil
+	case "int":
+		var v int64
+		err = json.Unmarshal(arg.Value, &v)
+		return v, err
+	case "uint":
+		var v uint64
+		err = json.Unmarshal(arg.Value, &v)
+		return v, err
+	case "float":
+		var v float64
+		err = json.Unmarshal(arg.Value, &v)
+		return v, err
+	case "bool":
+		var v bool
+		err = json.Unmarshal(arg.Value, &v)
+		return v, err
+	case "string":
+		var v string
+		err = json.Unmarshal(arg.Value, &v)
+		return v, err
+	case "bytes":
+		var v []byte
+		err = json.Unmarshal(arg.Value, &v)
+		return v, err
+	case "time":
+		var v time.Time
+		err = json.Unmarshal(arg.Value, &v)
+		return v, err
+	}
+	return nil, fmt.Errorf("unknown parameter type %q", arg.Type)
+}
+
+// applyStatement ejecuta en un seguidor una sentencia replicada. Se envía directamente
+// a la conexión para que GORM no vuelva a interpretar los placeholders.
+func applyStatement(tx *gorm.DB, statement *SQLStatement) error {
+	if statement == nil {
+		return fmt.Errorf("EXEC entry without statement")
+	}
+
+	vars := make([]interface{}, 0, len(statement.Vars))
+	for i, arg := range statement.Vars {
+		value, err := decodeSQLArg(arg)
+		if err != nil {
+			return fmt.Errorf("error decoding parameter %d: %v", i+1, err)
+		}
+		vars = append(vars, value)
+	}
+
+	if _, err := tx.Statement.ConnPool.ExecContext(tx.Statement.Context, statement.SQL, vars...); err != nil {
+		return fmt.Errorf("error executing replicated statement: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package cluster
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestSQLTarget(t *testing.T) {
+	tests := []struct {
+		name       string
+		sql        string
+		operation  string
+		table      string
+		replicated bool
+	}{
+		{name: "insert", sql: "INSERT INTO users (name) VALUES (?)", operation: "INSERT", table: "users", replicated: true},
+		{name: "lowercase update", sql: "update Posts set content = ? where id = ?", operation: "UPDATE", table: "posts", replicated: true},
+		{name: "delete", sql: "DELETE FROM likes WHERE post_id = ?", operation: "DELETE", table: "likes", replicated: true},
+		{name: "replace", sql: "REPLACE INTO likes (id) VALUES (1)", operation: "REPLACE", table: "likes", replicated: true},
+		{name: "insert or replace", sql: "INSERT OR REPLACE INTO users (id) VALUES (1)", operation: "INSERT", table: "users", replicated: true},
+		{name: "insert or ignore", sql: "insert or ignore into likes (id) values (1)", operation: "INSERT", table: "likes", replicated: true},
+		{name: "update or rollback", sql: "UPDATE OR ROLLBACK users SET name = ?", operation: "UPDATE", table: "users", replicated: true},
+		{name: "select", sql: "SELECT * FROM users"},
+		{name: "create table", sql: "CREATE TABLE t (id integer)"},
+		{name: "pragma", sql: "PRAGMA foreign_keys = ON"},
+		{name: "vacuum", sql: "VACUUM"},
+		{name: "empty", sql: "   "},
+
+		// Expresiones comunes delante de la operación
+		{name: "with insert", sql: "WITH recent AS (SELECT id FROM posts WHERE created_at > ?) INSERT INTO likes (post_id) SELECT id FROM recent", operation: "INSERT", table: "likes", replicated: true},
+		{name: "with recursive delete", sql: "WITH RECURSIVE thread(id) AS (SELECT ? UNION ALL SELECT p.id FROM posts p JOIN thread t ON p.repost_id = t.id) DELETE FROM posts WHERE id IN thread", operation: "DELETE", table: "posts", replicated: true},
+		{name: "with nested parentheses", sql: "WITH a AS (SELECT (1 + (2)) AS n), b AS (SELECT n FROM a) UPDATE users SET name = (SELECT n FROM b)", operation: "UPDATE", table: "users", replicated: true},
+		{name: "with select", sql: "WITH a AS (DELETE FROM users RETURNING id) SELECT * FROM a"},
+		{name: "with values", sql: "WITH a(n) AS (VALUES (1)) VALUES (2)"},
+		{name: "with writing to the log", sql: "WITH old AS (SELECT log_index FROM replication_log) DELETE FROM replication_log WHERE log_index IN old", operation: "DELETE", table: "replication_log"},
+
+		// Nombres con comillas y con esquema
+		{name: "double quoted", sql: `INSERT INTO "users" (name) VALUES (?)`, operation: "INSERT", table: "users", replicated: true},
+		{name: "brackets", sql: "DELETE FROM [users] WHERE id = 1", operation: "DELETE", table: "users", replicated: true},
+		{name: "backticks", sql: "UPDATE `users` SET name = ?", operation: "UPDATE", table: "users", replicated: true},
+		{name: "schema qualified", sql: "DELETE FROM main.users", operation: "DELETE", table: "users", replicated: true},
+		{name: "quoted schema qualified log", sql: `DELETE FROM "main"."replication_log" WHERE log_index < ?`, operation: "DELETE", table: "replication_log"},
+		{name: "spaced schema qualified log", sql: "UPDATE main . `replication_log` SET term = 1", operation: "UPDATE", table: "replication_log"},
+		{name: "quoted name with spaces", sql: `INSERT INTO "my ""odd"" table" VALUES (1)`, operation: "INSERT", table: `my "odd" table`, replicated: true},
+		{name: "schema migrations", sql: "INSERT INTO schema_migrations (version) VALUES (2)", operation: "INSERT", table: schemaMigrationsTable},
+
+		// Comentarios delante de la operación
+		{name: "line comment", sql: "-- remove old likes\nDELETE FROM likes", operation: "DELETE", table: "likes", replicated: true},
+		{name: "block comment", sql: "/* INSERT INTO replication_log */ UPDATE users SET name = ?", operation: "UPDATE", table: "users", replicated: true},
+		{name: "comment between modifier and table", sql: "DELETE FROM /* main. */ replication_log", operation: "DELETE", table: "replication_log"},
+		{name: "commented out write", sql: "-- DELETE FROM users\nSELECT 1"},
+
+		// Comentarios y textos sin terminar
+		{name: "unterminated block comment", sql: "/* DELETE FROM users"},
+		{name: "unterminated line comment", sql: "-- DELETE FROM users"},
+		{name: "trailing unterminated comment", sql: "DELETE FROM users /* cleanup", operation: "DELETE", table: "users", replicated: true},
+		{name: "unterminated string", sql: "INSERT INTO users (name) VALUES ('O''Brien", operation: "INSERT", table: "users", replicated: true},
+		{name: "write inside string", sql: "SELECT 'DELETE FROM users'"},
+		{name: "unterminated identifier", sql: `DELETE FROM "users`, operation: "DELETE", table: "users", replicated: true},
+		{name: "missing table", sql: "DELETE FROM", operation: "DELETE", replicated: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			operation, table := sqlTarget(tt.sql)
+			if operation != tt.operation || table != tt.table {
+				t.Errorf("sqlTarget(%q) = (%q, %q), want (%q, %q)", tt.sql, operation, table, tt.operation, tt.table)
+			}
+			if got := isReplicatedSQL(tt.sql); got != tt.replicated {
+				t.Errorf("isReplicatedSQL(%q) = %v, want %v", tt.sql, got, tt.replicated)
+			}
+		})
+	}
+}
+
+// testValuer es un parámetro que el driver convierte con driver.Valuer
+type testValuer struct{ value string }
+
+func (v testValuer) Value() (driver.Value, error) {
+	return v.value, nil
+}
+
+func TestSQLArgRoundTrip(t *testing.T) {
+	at := time.Date(2024, time.March, 9, 14, 30, 15, 123456789, time.FixedZone("UTC-3", -3*60*60))
+	count := 7
+	var missing *string
+
+	tests := []struct {
+		name  string
+		value interface{}
+		want  interface{}
+	}{
+		{name: "nil", value: nil, want: nil},
+		{name: "int", value: -42, want: int64(-42)},
+		{name: "large int", value: int64(9007199254740993), want: int64(9007199254740993)},
+		{name: "uint", value: uint(42), want: uint64(42)},
+		{name: "max uint64", value: uint64(18446744073709551615), want: uint64(18446744073709551615)},
+		{name: "float", value: float32(1.5), want: 1.5},
+		{name: "bool", value: true, want: true},
+		{name: "string", value: "O'Brien ✨", want: "O'Brien ✨"},
+		{name: "bytes", value: []byte{0, 1, 0xff}, want: []byte{0, 1, 0xff}},
+		{name: "empty bytes", value: []byte{}, want: []byte{}},
+		{name: "time", value: at, want: at},
+		{name: "pointer", value: &count, want: int64(7)},
+		{name: "nil pointer", value: missing, want: nil},
+		{name: "pointer to time", value: &at, want: at},
+		{name: "valuer", value: testValuer{value: "hello"}, want: "hello"},
+		{name: "null valuer", value: sql.NullString{}, want: nil},
+		{name: "valid null valuer", value: sql.NullInt64{Int64: 5, Valid: true}, want: int64(5)},
+		{name: "soft delete", value: gorm.DeletedAt{Time: at, Valid: true}, want: at},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			arg, err := encodeSQLArg(tt.value)
+			if err != nil {
+				t.Fatalf("encodeSQLArg(%#v): %v", tt.value, err)
+			}
+
+			// El parámetro viaja serializado en el log de replicación
+			encoded, err := json.Marshal(arg)
+			if err != nil {
+				t.Fatalf("encoding parameter: %v", err)
+			}
+			var decodedArg SQLArg
+			if err := json.Unmarshal(encoded, &decodedArg); err != nil {
+				t.Fatalf("decoding parameter: %v", err)
+			}
+
+			got, err := decodeSQLArg(decodedArg)
+			if err != nil {
+				t.Fatalf("decodeSQLArg(%s): %v", encoded, err)
+			}
+			if wantTime, ok := tt.want.(time.Time); ok {
+				gotTime, ok := got.(time.Time)
+				if !ok || !gotTime.Equal(wantTime) {
+					t.Errorf("round trip of %#v = %#v, want %v", tt.value, got, wantTime)
+				}
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("round trip of %#v = %#v, want %#v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncodeSQLArgRejectsUnsupportedTypes(t *testing.T) {
+	for _, value := range []interface{}{[]string{"a"}, map[string]int{"a": 1}, struct{}{}} {
+		if arg, err := encodeSQLArg(value); err == nil {
+			t.Errorf("encodeSQLArg(%#v) = %+v, want error", value, arg)
+		}
+	}
+}
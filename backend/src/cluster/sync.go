@@ -0,0 +1,225 @@
+package cluster
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ProvideSyncData decide cómo debe sincronizarse el seguidor (solo líder). Si el log
+// del líder contiene la última entrada del seguidor con el mismo término, basta con
+// enviarle las entradas siguientes; si no, se crea un snapshot consistente y se
+// retorna su manifiesto para que lo descargue por partes.
+func (cs *ClusterState) ProvideSyncData(request SyncRequest) (SyncResponse, error) {
+	if !cs.IsLeader() {
+		return SyncResponse{}, fmt.Errorf("only leader can provide sync data")
+	}
+
+	db := cs.getDB()
+	response := SyncResponse{
+		LeaderID:  cs.GetCurrentNodeID(),
+		Term:      cs.GetCurrentTerm(),
+		Timestamp: time.Now(),
+	}
+
+	lastIndex, reason, err := canSyncFromLog(db, request)
+	if err != nil {
+		return SyncResponse{}, err
+	}
+
+	if reason == "" {
+		response.Mode = SyncModeLog
+		response.FromIndex = request.LastIndex + 1
+		response.ToIndex = lastIndex
+
+		slog.Info("Follower behind, sending log entries", "node_id", request.NodeID,
+			"behind", lastIndex-request.LastIndex, "from", response.FromIndex, "to", response.ToIndex)
+		return response, nil
+	}
+
+	manifest, err := createSnapshot(db)
+	if err != nil {
+		return SyncResponse{}, err
+	}
+
+	slog.Info("Full snapshot required, providing snapshot", "node_id", request.NodeID, "reason", reason,
+		"snapshot_id", manifest.SnapshotID, "bytes", manifest.Size, "chunks", len(manifest.Chunks), "last_index", manifest.LastIndex)
+
+	response.Mode = SyncModeSnapshot
+	response.Snapshot = &manifest
+	response.Reason = reason
+	return response, nil
+}
+
+// canSyncFromLog retorna la última entrada del log del líder y, si el seguidor no
+// puede continuar desde su posición, el motivo por el que necesita un snapshot
+func canSyncFromLog(db *gorm.DB, request SyncRequest) (uint64, string, error) {
+	lastIndex, _, err := lastLogEntry(db)
+	if err != nil {
+		return 0, "", err
+	}
+
+	// Sin log no se sabe qué datos tiene el seguidor
+	if request.LastIndex == 0 {
+		return lastIndex, "follower has no replication log", nil
+	}
+
+	if request.LastIndex > lastIndex {
+		return lastIndex, fmt.Sprintf("follower log is ahead of leader (%d > %d)", request.LastIndex, lastIndex), nil
+	}
+
+	// Las entradas siguientes a la del seguidor ya se borraron del log
+	if compacted, err := logCompacted(db, request.LastIndex); err != nil {
+		return 0, "", err
+	} else if compacted {
+		return lastIndex, fmt.Sprintf("entry %d was compacted from the leader log", request.LastIndex), nil
+	}
+
+	// Misma entrada con el mismo término implica el mismo log hasta ese punto
+	leaderTerm, err := logTermAt(db, request.LastIndex)
+	if err != nil {
+		return 0, "", err
+	}
+	if leaderTerm != request.LastTerm {
+		return lastIndex, fmt.Sprintf("entry %d has term %d on follower, %d on leader", request.LastIndex, request.LastTerm, leaderTerm), nil
+	}
+
+	return lastIndex, "", nil
+}
+
+// CheckLogFrom verifica que el log del líder tenga todavía las entradas desde from y
+// la anterior, con cuyo término el seguidor comprueba que continúa el mismo log
+func CheckLogFrom(db *gorm.DB, from uint64) error {
+	compacted, err := logCompacted(db, from-1)
+	if err != nil {
+		return err
+	}
+	if compacted {
+		return fmt.Errorf("%w: entry %d is no longer in the log", ErrLogCompacted, from-1)
+	}
+	return nil
+}
+
+// RequestSync envía al líder la posición del log local y, según la respuesta, aplica
+// las entradas que faltan o descarga un snapshot completo. Al terminar marca el nodo como listo.
+func (cs *ClusterState) RequestSync(leaderAddress string) error {
+	if leaderAddress == "" {
+		return fmt.Errorf("no leader available for sync")
+	}
+
+	lastIndex, lastTerm, err := lastLogEntry(cs.getDB())
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Requesting sync from leader", "leader_address", leaderAddress, "last_index", lastIndex, "last_term", lastTerm)
+	start := time.Now()
+
+	request := SyncRequest{
+		NodeID:    cs.GetCurrentNodeID(),
+		LastIndex: lastIndex,
+		LastTerm:  lastTerm,
+		Timestamp: time.Now(),
+	}
+
+	jsonData, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("error marshaling sync request: %v", err)
+	}
+
+	resp, err := snapshotClient.Post(leaderAddress+"/cluster/sync", "application/json", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("error requesting sync: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("sync request failed with status: %d", resp.StatusCode)
+	}
+
+	var syncResponse SyncResponse
+	if err := json.NewDecoder(resp.Body).Decode(&syncResponse); err != nil {
+		return fmt.Errorf("error decoding sync response: %v", err)
+	}
+
+	// Rechazar datos de un líder de un término anterior
+	if currentTerm := cs.GetCurrentTerm(); syncResponse.Term < currentTerm {
+		return fmt.Errorf("%w: sync data from term %d, current term %d", ErrStaleTerm, syncResponse.Term, currentTerm)
+	}
+
+	switch syncResponse.Mode {
+	case SyncModeLog:
+		err = cs.syncFromLog(syncResponse)
+	case SyncModeSnapshot:
+		if syncResponse.Snapshot == nil {
+			return fmt.Errorf("sync response without snapshot manifest")
+		}
+		slog.Info("Leader requires full snapshot", "reason", syncResponse.Reason)
+		err = cs.syncFromSnapshot(leaderAddress, *syncResponse.Snapshot)
+	default:
+		return fmt.Errorf("unknown sync mode %q", syncResponse.Mode)
+	}
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	syncDuration.WithLabelValues(string(syncResponse.Mode), result).Observe(time.Since(start).Seconds())
+	if err != nil {
+		return err
+	}
+
+	// Marcar el nodo como listo
+	cs.mu.Lock()
+	cs.IsReady = true
+	cs.mu.Unlock()
+
+	return nil
+}
+
+// syncFromLog aplica las entradas del log que el seguidor no tiene
+func (cs *ClusterState) syncFromLog(response SyncResponse) error {
+	cs.applyMu.Lock()
+	defer cs.applyMu.Unlock()
+
+	db := cs.getDB()
+	if response.FromIndex <= response.ToIndex {
+		if err := cs.catchUpUnsafe(db, response.FromIndex); err != nil {
+			return err
+		}
+	}
+
+	lastIndex := LastLogIndex(db)
+	if lastIndex < response.ToIndex {
+		return fmt.Errorf("%w: caught up to entry %d, leader announced %d", ErrLogGap, lastIndex, response.ToIndex)
+	}
+
+	slog.Info("Resumed from replication log", "from", response.FromIndex, "to", response.ToIndex, "last_index", lastIndex)
+	return nil
+}
+
+// syncFromSnapshot descarga un snapshot del líder por partes, verifica cada parte y el
+// archivo completo con SHA-256 y reemplaza la base de datos local de forma atómica
+func (cs *ClusterState) syncFromSnapshot(leaderAddress string, manifest SnapshotManifest) error {
+	tempPath := databasePath() + ".sync"
+	if err := downloadSnapshot(leaderAddress, manifest, tempPath); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+
+	slog.Info("Received snapshot from leader", "snapshot_id", manifest.SnapshotID, "bytes", manifest.Size, "last_index", manifest.LastIndex)
+	syncBytes.WithLabelValues(string(SyncModeSnapshot)).Add(float64(manifest.Size))
+
+	if err := cs.installSnapshot(tempPath); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+
+	slog.Info("Synced database from leader", "bytes", manifest.Size)
+	return nil
+}
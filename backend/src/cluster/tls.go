@@ -0,0 +1,120 @@
+package cluster
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// clusterTransport es el transporte de los mensajes entre nodos. Con TLS configurado
+// presenta el certificado del nodo y solo acepta nodos firmados por la CA del cluster.
+var clusterTransport = http.DefaultTransport.(*http.Transport).Clone()
+
+// serverTLSConfig es la configuración del listener TLS (nil si TLS no está configurado)
+var serverTLSConfig *tls.Config
+
+// tlsEnabled indica si los nodos se comunican por TLS (CLUSTER_TLS_CERT definido)
+func tlsEnabled() bool {
+	return os.Getenv("CLUSTER_TLS_CERT") != ""
+}
+
+// tlsPort retorna el puerto del listener TLS entre nodos (CLUSTER_TLS_PORT, 3443 por defecto)
+func tlsPort() int {
+	return envInt("CLUSTER_TLS_PORT", 3443)
+}
+
+// nodeScheme retorna el esquema de las direcciones de los nodos
+func nodeScheme() string {
+	if tlsEnabled() {
+		return "https"
+	}
+	return "http"
+}
+
+// nodePort retorna el puerto por el que los demás nodos contactan a este
+func nodePort() int {
+	if tlsEnabled() {
+		return tlsPort()
+	}
+	return listenPort()
+}
+
+// configureTLS carga el certificado del nodo y la CA del cluster de CLUSTER_TLS_CERT,
+// CLUSTER_TLS_KEY y CLUSTER_TLS_CA. Los nodos se autentican entre sí (mTLS): el servidor
+// exige un certificado de cliente firmado por la CA y el cliente verifica el del servidor.
+// Sin CLUSTER_TLS_CERT el tráfico entre nodos viaja sin cifrar (solo firmado con HMAC).
+func configureTLS() error {
+	if !tlsEnabled() {
+		slog.Warn("CLUSTER_TLS_CERT not set, traffic between nodes is signed but not encrypted")
+		return nil
+	}
+
+	certFile, keyFile, caFile := os.Getenv("CLUSTER_TLS_CERT"), os.Getenv("CLUSTER_TLS_KEY"), os.Getenv("CLUSTER_TLS_CA")
+	if keyFile == "" || caFile == "" {
+		return errors.New("CLUSTER_TLS_KEY and CLUSTER_TLS_CA must be set with CLUSTER_TLS_CERT")
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return fmt.Errorf("error loading node certificate: %v", err)
+	}
+
+	caPEM, err := os.ReadFile(caFile)
+	if err != nil {
+		return fmt.Errorf("error reading cluster CA: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return fmt.Errorf("no certificates found in %s", caFile)
+	}
+
+	serverTLSConfig = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	// Las direcciones de los nodos suelen ser IPs: CLUSTER_TLS_SERVER_NAME permite usar
+	// un certificado con un nombre común a todos los nodos
+	clientConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+		ServerName:   os.Getenv("CLUSTER_TLS_SERVER_NAME"),
+		MinVersion:   tls.VersionTLS12,
+	}
+	clusterTransport.TLSClientConfig = clientConfig
+	proxyTransport.TLSClientConfig = clientConfig.Clone()
+
+	slog.Info("Traffic between nodes is encrypted with mutual TLS", "port", tlsPort())
+	return nil
+}
+
+// ServeTLS atiende con la misma aplicación el listener TLS por el que se comunican
+// los nodos. Debe llamarse después de que la aplicación empiece a escuchar (OnListen)
+// y retorna cuando el servidor se apaga; sin TLS configurado retorna enseguida.
+func ServeTLS(app *fiber.App) error {
+	if serverTLSConfig == nil {
+		return nil
+	}
+
+	ln, err := tls.Listen("tcp", net.JoinHostPort("", strconv.Itoa(tlsPort())), serverTLSConfig)
+	if err != nil {
+		return fmt.Errorf("error listening for cluster TLS: %v", err)
+	}
+	return app.Server().Serve(ln)
+}
+
+// requiresTLS indica si una petición a un endpoint del cluster debe rechazarse por
+// no llegar por el listener TLS
+func requiresTLS(c *fiber.Ctx) bool {
+	return serverTLSConfig != nil && !c.Context().IsTLS()
+}
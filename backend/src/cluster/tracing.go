@@ -0,0 +1,91 @@
+package cluster
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/theleywin/Backend-Talent-Nest/src/logging"
+	"github.com/theleywin/Backend-Talent-Nest/src/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.43.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracing middleware crea un span por petición HTTP, hijo del contexto de traza W3C que
+// envía el cliente u otro nodo, y lo deja en el contexto de la petición para que las
+// consultas, los reenvíos y la replicación formen parte de la misma traza. Los
+// mensajes entre nodos que no llegan dentro de una traza (heartbeats, gossip) y los
+// endpoints de salud y métricas no se trazan.
+func Tracing(clusterState *ClusterState) fiber.Handler {
+	tracer := tracing.Tracer()
+	return func(c *fiber.Ctx) error {
+		path := c.Path()
+		if isHealthEndpoint(path) {
+			return c.Next()
+		}
+
+		ctx := tracing.Extract(c.UserContext(), requestHeaderCarrier{c})
+		if isClusterEndpoint(path) && !trace.SpanContextFromContext(ctx).IsValid() {
+			return c.Next()
+		}
+
+		// Fiber reutiliza el buffer del método: copiarlo antes de guardarlo en el span
+		method := strings.Clone(c.Method())
+		route := clusterState.routePattern(method, path)
+
+		attributes := []attribute.KeyValue{
+			semconv.HTTPRequestMethodKey.String(method),
+			semconv.HTTPRoute(route),
+			semconv.URLPath(strings.Clone(path)),
+		}
+		if requestID := logging.RequestID(ctx); requestID != "" {
+			attributes = append(attributes, attribute.String("request.id", requestID))
+		}
+
+		ctx, span := tracer.Start(ctx, method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(attributes...),
+		)
+		defer span.End()
+		c.SetUserContext(ctx)
+
+		// Aplicar el error handler aquí para registrar el status que recibe el cliente
+		if err := c.Next(); err != nil {
+			span.RecordError(err)
+			if err := c.App().Config().ErrorHandler(c, err); err != nil {
+				span.SetStatus(codes.Error, err.Error())
+				return err
+			}
+		}
+
+		status := c.Response().StatusCode()
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if status >= fiber.StatusInternalServerError {
+			span.SetStatus(codes.Error, "")
+		}
+		return nil
+	}
+}
+
+// requestHeaderCarrier lee el contexto de traza de los headers de una petición de Fiber
+type requestHeaderCarrier struct {
+	c *fiber.Ctx
+}
+
+func (carrier requestHeaderCarrier) Get(key string) string {
+	// Copiar el valor: el contexto extraído vive más que el buffer de la petición
+	return strings.Clone(carrier.c.Get(key))
+}
+
+func (carrier requestHeaderCarrier) Set(key, value string) {
+	carrier.c.Request().Header.Set(key, value)
+}
+
+func (carrier requestHeaderCarrier) Keys() []string {
+	var keys []string
+	carrier.c.Request().Header.VisitAll(func(key, _ []byte) {
+		keys = append(keys, string(key))
+	})
+	return keys
+}
@@ -0,0 +1,105 @@
+package cluster
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/theleywin/Backend-Talent-Nest/src/logging"
+	"gorm.io/gorm"
+)
+
+// replicatedPool envuelve la conexión de GORM para que cada transacción acumule los
+// cambios capturados por los hooks y los escriba en el log como una sola entrada al
+// confirmarse. Si la transacción se revierte, sus cambios se descartan con ella.
+type replicatedPool struct {
+	gorm.ConnPool
+	db *gorm.DB
+	cs *ClusterState
+}
+
+// BeginTx inicia una transacción que acumula sus cambios replicados
+func (p *replicatedPool) BeginTx(ctx context.Context, opts *sql.TxOptions) (gorm.ConnPool, error) {
+	beginner, ok := p.ConnPool.(gorm.TxBeginner)
+	if !ok {
+		return nil, gorm.ErrInvalidTransaction
+	}
+
+	tx, err := beginner.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &replicatedTx{Tx: tx, pool: p, ctx: ctx}, nil
+}
+
+// GetDBConn retorna la conexión original (usada por db.DB())
+func (p *replicatedPool) GetDBConn() (*sql.DB, error) {
+	if sqlDB, ok := p.ConnPool.(*sql.DB); ok {
+		return sqlDB, nil
+	}
+	return nil, gorm.ErrInvalidDB
+}
+
+// replicatedTx es una transacción con los cambios pendientes de registrar en el log
+type replicatedTx struct {
+	*sql.Tx
+	pool       *replicatedPool
+	ctx        context.Context // Contexto de la transacción (lleva el ID de la petición)
+	changes    []Change
+	savepoints map[string]int // Cantidad de cambios al crear cada punto de guardado
+}
+
+// GetDBConn retorna la conexión original (usada por db.DB())
+func (t *replicatedTx) GetDBConn() (*sql.DB, error) {
+	return t.pool.GetDBConn()
+}
+
+// Commit escribe los cambios acumulados en el log dentro de la transacción y la
+// confirma: el log recibe una entrada por transacción, con todos sus cambios o ninguno
+func (t *replicatedTx) Commit() error {
+	if len(t.changes) == 0 {
+		return t.Tx.Commit()
+	}
+
+	// Con Context GORM copia el statement: sin él se cambiaría la conexión de la DB compartida
+	session := t.pool.db.Session(&gorm.Session{NewDB: true, SkipDefaultTransaction: true, Context: t.ctx})
+	session.Statement.ConnPool = t.Tx
+
+	index, err := t.pool.cs.AppendToLog(session, t.changes)
+	if err != nil {
+		t.Tx.Rollback()
+		return err
+	}
+
+	if err := t.Tx.Commit(); err != nil {
+		return err
+	}
+
+	recordWrite(t.ctx, index)
+	logging.FromContext(t.ctx).Info("Logged transaction", "changes", len(t.changes), "index", index)
+	t.changes = nil
+	t.pool.cs.NotifyReplicators()
+	return nil
+}
+
+// Rollback revierte la transacción y descarta sus cambios
+func (t *replicatedTx) Rollback() error {
+	t.changes = nil
+	return t.Tx.Rollback()
+}
+
+// trackSavepoint sigue los puntos de guardado que GORM usa para transacciones anidadas
+func (t *replicatedTx) trackSavepoint(statement string) {
+	fields := strings.Fields(statement)
+	switch {
+	case len(fields) == 2 && strings.EqualFold(fields[0], "SAVEPOINT"):
+		if t.savepoints == nil {
+			t.savepoints = make(map[string]int)
+		}
+		t.savepoints[fields[1]] = len(t.changes)
+	case len(fields) == 4 && strings.EqualFold(fields[0], "ROLLBACK") && strings.EqualFold(fields[2], "SAVEPOINT"):
+		if count, exists := t.savepoints[fields[3]]; exists && count <= len(t.changes) {
+			t.changes = t.changes[:count]
+		}
+	}
+}
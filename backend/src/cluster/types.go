@@ -1,64 +1,448 @@
 package cluster
 
 import (
+	"errors"
+	"log/slog"
 	"sync"
 	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
 )
 
 type NodeRole string
 
 const (
-	Leader   NodeRole = "leader"
-	Follower NodeRole = "follower"
+	Leader    NodeRole = "leader"
+	Follower  NodeRole = "follower"
+	Candidate NodeRole = "candidate"
+)
+
+// ErrStaleTerm indica que un mensaje pertenece a un término anterior al actual
+var ErrStaleTerm = errors.New("stale term")
+
+// ErrLogGap indica que el seguidor no tiene las entradas anteriores a un mensaje
+var ErrLogGap = errors.New("replication log gap")
+
+// ErrLogDiverged indica que el log del seguidor no coincide con el del líder
+var ErrLogDiverged = errors.New("replication log diverged")
+
+// ErrLogCompacted indica que el líder ya no tiene en el log las entradas que le faltan
+// al seguidor, que debe sincronizarse con un snapshot
+var ErrLogCompacted = errors.New("replication log compacted")
+
+// ErrNotLeader indica que la operación solo puede ejecutarla el líder
+var ErrNotLeader = errors.New("this node is not the leader")
+
+// MemberState es el estado de un nodo según el detector de fallos por gossip
+type MemberState string
+
+const (
+	MemberAlive   MemberState = "alive"   // Responde a los pings
+	MemberSuspect MemberState = "suspect" // No respondió; se confirma como caído tras un timeout
+	MemberDead    MemberState = "dead"    // Caído; no recibe tráfico pero sigue siendo miembro
 )
 
 type Node struct {
-	ID        int
-	Address   string
-	Role      NodeRole
-	LastSeen  time.Time
-	IsHealthy bool
+	ID            string // ID persistente del nodo (UUID)
+	Address       string
+	Role          NodeRole
+	LastSeen      time.Time   // Última vez que se recibió un mensaje directo del nodo
+	State         MemberState // Estado según el gossip
+	Incarnation   uint64      // Versión del estado anunciada por el propio nodo
+	StateChanged  time.Time   // Momento del último cambio de estado
+	Maintenance   bool        // En mantenimiento: no puede ser líder ni recibe escrituras
+	PublicAddress string      // Dirección con la que los clientes llegan al nodo (CLUSTER_PUBLIC_ADDRESS)
+	SchemaVersion int         // Última migración del esquema que conoce el binario del nodo
+}
+
+// IsHealthy indica si el nodo participa en el cluster (no está confirmado como caído)
+func (n *Node) IsHealthy() bool {
+	return n.State != MemberDead
 }
 
 type ClusterState struct {
 	mu            sync.RWMutex
-	CurrentNodeID int
+	CurrentNodeID string
 	CurrentRole   NodeRole
-	LeaderID      int
+	LeaderID      string
 	LeaderAddress string
-	Nodes         map[int]*Node
+	Nodes         map[string]*Node
 	ServiceName   string
-	IsReady       bool // Indica si el nodo está listo para aceptar requests
+	Discoverer    Discoverer // Método de descubrimiento de nodos (CLUSTER_DISCOVERY)
+
+	unidentifiedPeers []string // Direcciones descubiertas cuyo nodo aún no informó su ID
+
+	// Estado del gossip de membresía (SWIM)
+	incarnation uint64                   // Versión del estado propio; sube al desmentir una sospecha
+	gossipQueue map[string]*gossipUpdate // Cambios pendientes de difundir en los pings
+	probeOrder  []string                 // Orden aleatorio de los nodos a sondear
+	IsReady     bool                     // Indica si el nodo está listo para aceptar requests
+
+	CurrentTerm uint64 // Término actual (persistido en disco)
+	VotedFor    string // Nodo al que se votó en el término actual ("" = ninguno)
+	clusterSize int    // Nodos con voto (CLUSTER_SIZE, persistido): define el quórum
+
+	lastHeartbeat   time.Time     // Último contacto recibido del líder actual
+	leaderLastIndex uint64        // Última entrada del log del líder, informada en los heartbeats
+	timerReset      time.Time     // Último reinicio del temporizador de elección
+	lastQuorumAck   time.Time     // Última vez que el líder confirmó contacto con la mayoría
+	electionTimeout time.Duration // Timeout aleatorio de elección para este nodo
+
+	syncing         bool      // Hay una sincronización con el líder en curso
+	lastSyncAttempt time.Time // Último intento de sincronización con el líder
+
+	shuttingDown   bool // El nodo se está apagando: no acepta escrituras ni inicia elecciones
+	leftCluster    bool // El nodo ya anunció su salida del cluster
+	transferring   bool // El líder está cediendo el liderazgo: no acepta escrituras
+	maintenance    bool // Modo mantenimiento (persistido): no puede ser líder ni recibe escrituras
+	writesInFlight int  // Escrituras en curso en el líder
+
+	WriteConcern  WriteConcern // Confirmaciones requeridas antes de responder a una escritura
+	WriteMode     WriteMode    // Qué hace un seguidor con las escrituras que recibe
+	PublicAddress string       // Dirección pública de este nodo, anunciada por gossip y heartbeats
+
+	// Todos los nodos usan la misma base de datos externa (SetSharedDatabase): los datos
+	// no se replican entre nodos
+	sharedDatabase bool
+
+	// Migraciones del esquema (SetMigrations)
+	migrations           []Migration // Migraciones que conoce el binario, por versión
+	codeSchemaVersion    int         // Última migración que conoce el binario
+	appliedSchemaVersion int         // Última migración aplicada en la base de datos local
+	migrationError       string      // Último error al aplicar las migraciones como líder
+
+	// ReopenDatabase vuelve a abrir la conexión tras reemplazar el archivo de la base de
+	// datos con un snapshot del líder; retorna la nueva conexión
+	ReopenDatabase func() (*gorm.DB, error)
+
+	// DrainDatabase espera a que terminen las peticiones que usan la conexión actual y
+	// rechaza las nuevas hasta llamar a resume, para poder cerrarla y reemplazar el archivo
+	DrainDatabase func() (resume func())
+
+	db             *gorm.DB                       // Base de datos local (log de replicación)
+	schemas        map[string]*schema.Schema      // Modelos replicados por nombre de tabla
+	routes         routeTable                     // Clase de cada ruta del API (ClassifyRoutes)
+	declaredRoutes routeTable                     // Rutas registradas con Router, pendientes de ClassifyRoutes
+	applyMu        sync.Mutex                     // Serializa la aplicación de entradas en seguidores
+	replicators    map[string]*followerReplicator // Replicadores por seguidor (solo líder)
+
+	ackMu      sync.Mutex        // Protege matchIndex y ackCh
+	matchIndex map[string]uint64 // Última entrada confirmada por cada seguidor
+	ackCh      chan struct{}     // Se cierra cada vez que un seguidor confirma entradas
+
+	appliedMu sync.Mutex    // Protege appliedCh
+	appliedCh chan struct{} // Se cierra cada vez que el seguidor aplica entradas replicadas
+
+	verifyMu sync.Mutex // Evita dos verificaciones anti-entropía simultáneas
 }
 
 // ReplicationMessage representa un mensaje de replicación del líder a los seguidores
 type ReplicationMessage struct {
-	Operation string                 `json:"operation"` // INSERT, UPDATE, DELETE
-	Table     string                 `json:"table"`     // Nombre de la tabla
-	Data      map[string]interface{} `json:"data"`      // Datos a replicar
-	LeaderID  int                    `json:"leader_id"`
-	Timestamp time.Time              `json:"timestamp"`
-	RecordID  uint                   `json:"record_id,omitempty"` // ID del registro afectado
+	Operation   string        `json:"operation"`           // BATCH (o INSERT, UPDATE, DELETE, EXEC en entradas antiguas)
+	Table       string        `json:"table"`               // Nombre de la tabla
+	Data        RowData       `json:"data"`                // Imagen de la fila tras el cambio
+	Statement   *SQLStatement `json:"statement,omitempty"` // Sentencia SQL replicada (EXEC)
+	Changes     []Change      `json:"changes,omitempty"`   // Cambios de una transacción (BATCH)
+	LeaderID    string        `json:"leader_id"`
+	Term        uint64        `json:"term"` // Término del líder que envía el mensaje
+	Timestamp   time.Time     `json:"timestamp"`
+	RecordID    uint          `json:"record_id,omitempty"`    // ID del registro afectado
+	Index       uint64        `json:"index"`                  // Posición de la entrada en el log
+	EntryTerm   uint64        `json:"entry_term"`             // Término en que se creó la entrada
+	PrevTerm    uint64        `json:"prev_term"`              // Término de la entrada Index-1
+	RequestID   string        `json:"request_id,omitempty"`   // Petición que originó la escritura (X-Request-ID)
+	TraceParent string        `json:"trace_parent,omitempty"` // Contexto de traza W3C de la escritura
+}
+
+// Change es un cambio dentro de una transacción: la imagen de una fila, una sentencia
+// SQL o una migración del esquema
+type Change struct {
+	Operation string        `json:"operation"` // INSERT, UPDATE, DELETE, EXEC, MIGRATE
+	Table     string        `json:"table,omitempty"`
+	RecordID  uint          `json:"record_id,omitempty"`
+	Data      RowData       `json:"data,omitempty"`
+	Statement *SQLStatement `json:"statement,omitempty"`
+	Migration *SchemaChange `json:"migration,omitempty"`
 }
 
-// SyncRequest representa una solicitud de sincronización completa
+// changes retorna los cambios del mensaje; las entradas antiguas traen un único cambio
+func (message ReplicationMessage) changes() []Change {
+	if message.Operation == "BATCH" {
+		return message.Changes
+	}
+	return []Change{{
+		Operation: message.Operation,
+		Table:     message.Table,
+		RecordID:  message.RecordID,
+		Data:      message.Data,
+		Statement: message.Statement,
+	}}
+}
+
+// SyncMode indica cómo debe sincronizarse un seguidor con el líder
+type SyncMode string
+
+const (
+	SyncModeLog      SyncMode = "log"      // Aplicar las entradas del log que faltan
+	SyncModeSnapshot SyncMode = "snapshot" // Descargar un snapshot completo
+)
+
+// SyncRequest representa una solicitud de sincronización. Incluye la última entrada
+// del log aplicada por el seguidor para que el líder decida si basta con el log.
 type SyncRequest struct {
-	NodeID    int       `json:"node_id"`
+	NodeID    string    `json:"node_id"`
+	LastIndex uint64    `json:"last_index"`
+	LastTerm  uint64    `json:"last_term"`
 	Timestamp time.Time `json:"timestamp"`
 }
 
-// SyncResponse contiene la base de datos completa en formato base64
+// SyncResponse indica si el seguidor debe pedir las entradas FromIndex..ToIndex del
+// log o descargar por partes el snapshot descrito en Snapshot
 type SyncResponse struct {
-	Database  string    `json:"database"` // Base64 del archivo SQLite
-	LeaderID  int       `json:"leader_id"`
-	Timestamp time.Time `json:"timestamp"`
+	Mode      SyncMode          `json:"mode"`
+	FromIndex uint64            `json:"from_index,omitempty"`
+	ToIndex   uint64            `json:"to_index,omitempty"`
+	Snapshot  *SnapshotManifest `json:"snapshot,omitempty"`
+	Reason    string            `json:"reason,omitempty"`
+	LeaderID  string            `json:"leader_id"`
+	Term      uint64            `json:"term"`
+	Timestamp time.Time         `json:"timestamp"`
+}
+
+// SnapshotManifest describe un snapshot consistente de la base de datos del líder
+type SnapshotManifest struct {
+	SnapshotID string          `json:"snapshot_id"`
+	Size       int64           `json:"size"`
+	SHA256     string          `json:"sha256"` // Hash del archivo completo
+	ChunkSize  int64           `json:"chunk_size"`
+	Chunks     []SnapshotChunk `json:"chunks"`
+	LastIndex  uint64          `json:"last_index"` // Última entrada del log incluida
+}
+
+// SnapshotChunk es una parte del snapshot con su propio hash
+type SnapshotChunk struct {
+	Index  int    `json:"index"`
+	Offset int64  `json:"offset"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// RangeChecksum es el hash de las filas de una tabla con clave primaria en [Start, End)
+type RangeChecksum struct {
+	Start uint64 `json:"start"`
+	End   uint64 `json:"end"`
+	Count int    `json:"count"`
+	Hash  string `json:"hash"`
+}
+
+// TableChecksums resume el contenido de una tabla: un hash por rango de claves y el
+// hash de todos los rangos
+type TableChecksums struct {
+	Table  string          `json:"table"`
+	Count  int             `json:"count"`
+	Hash   string          `json:"hash"`
+	Ranges []RangeChecksum `json:"ranges"`
+}
+
+// ChecksumResponse son los hashes de las tablas de un nodo en una posición del log
+type ChecksumResponse struct {
+	NodeID    string           `json:"node_id"`
+	LastIndex uint64           `json:"last_index"` // Última entrada aplicada al calcular los hashes
+	RangeSize uint64           `json:"range_size"` // Claves por rango
+	Tables    []TableChecksums `json:"tables"`
+}
+
+// RowRange son las filas del líder con clave primaria en [Start, End)
+type RowRange struct {
+	Table     string    `json:"table"`
+	Start     uint64    `json:"start"`
+	End       uint64    `json:"end"`
+	LastIndex uint64    `json:"last_index"`
+	Rows      []RowData `json:"rows"`
+}
+
+// DivergentRange es un rango de claves cuyo contenido difiere del líder
+type DivergentRange struct {
+	Table       string `json:"table"`
+	Start       uint64 `json:"start"`
+	End         uint64 `json:"end"`
+	LeaderCount int    `json:"leader_count"`
+	LocalCount  int    `json:"local_count"`
+}
+
+// VerifyReport es el resultado de comparar un seguidor con el líder
+type VerifyReport struct {
+	NodeID       string           `json:"node_id"`
+	LeaderID     string           `json:"leader_id"`
+	Index        uint64           `json:"index"` // Posición del log comparada
+	Consistent   bool             `json:"consistent"`
+	Diverged     []DivergentRange `json:"diverged,omitempty"`
+	RepairedRows int              `json:"repaired_rows"`
+	Error        string           `json:"error,omitempty"`
+	CheckedAt    time.Time        `json:"checked_at"`
+}
+
+// VoteRequest es la solicitud de voto que envía un candidato
+type VoteRequest struct {
+	Term             uint64 `json:"term"`
+	CandidateID      string `json:"candidate_id"`
+	CandidateAddress string `json:"candidate_address"`
+	LastLogIndex     uint64 `json:"last_log_index"`
+	LastLogTerm      uint64 `json:"last_log_term"`
+	SchemaVersion    int    `json:"schema_version"` // Última migración que conoce el candidato
+
+	// LeadershipTransfer indica que el líder actual cedió el liderazgo al candidato, así
+	// que los votantes no deben ignorarlo aunque hayan oído al líder hace poco
+	LeadershipTransfer bool `json:"leadership_transfer,omitempty"`
+}
+
+// VoteResponse es la respuesta de un nodo a una solicitud de voto
+type VoteResponse struct {
+	Term        uint64 `json:"term"`
+	VoteGranted bool   `json:"vote_granted"`
+}
+
+// TimeoutNowRequest es el mensaje con el que el líder cede el liderazgo a un seguidor:
+// el seguidor inicia una elección en cuanto haya aplicado hasta LastIndex
+type TimeoutNowRequest struct {
+	Term      uint64 `json:"term"`
+	LeaderID  string `json:"leader_id"`
+	LastIndex uint64 `json:"last_index"` // Última entrada del log del líder
+}
+
+// TimeoutNowResponse indica si el seguidor inició la elección
+type TimeoutNowResponse struct {
+	Term      uint64 `json:"term"`
+	Success   bool   `json:"success"`
+	LastIndex uint64 `json:"last_index"`
+}
+
+// LeaveNotice anuncia que un nodo sale del cluster y quién queda como líder
+type LeaveNotice struct {
+	NodeID   string `json:"node_id"`
+	Term     uint64 `json:"term"`
+	LeaderID string `json:"leader_id,omitempty"`
+}
+
+// MemberUpdate es un cambio de estado de un nodo que se difunde junto a los pings
+type MemberUpdate struct {
+	NodeID        string      `json:"node_id"`
+	Address       string      `json:"address"`
+	State         MemberState `json:"state"`
+	Incarnation   uint64      `json:"incarnation"`
+	Maintenance   bool        `json:"maintenance,omitempty"`
+	PublicAddress string      `json:"public_address,omitempty"`
+	SchemaVersion int         `json:"schema_version,omitempty"`
+}
+
+// GossipPing es el sondeo directo a un nodo
+type GossipPing struct {
+	FromID            string         `json:"from_id"`
+	FromAddress       string         `json:"from_address"`
+	FromPublicAddress string         `json:"from_public_address,omitempty"`
+	FromSchemaVersion int            `json:"from_schema_version,omitempty"`
+	Incarnation       uint64         `json:"incarnation"`
+	Updates           []MemberUpdate `json:"updates,omitempty"`
+}
+
+// GossipAck es la respuesta a un ping
+type GossipAck struct {
+	NodeID      string         `json:"node_id"`
+	Incarnation uint64         `json:"incarnation"`
+	Updates     []MemberUpdate `json:"updates,omitempty"`
+}
+
+// GossipPingRequest pide a un nodo que sondee a otro en nombre del emisor
+type GossipPingRequest struct {
+	FromID        string         `json:"from_id"`
+	TargetID      string         `json:"target_id"`
+	TargetAddress string         `json:"target_address"`
+	Updates       []MemberUpdate `json:"updates,omitempty"`
+}
+
+// GossipPingRequestResponse indica si el nodo sondeado de forma indirecta respondió
+type GossipPingRequestResponse struct {
+	Acked   bool           `json:"acked"`
+	Updates []MemberUpdate `json:"updates,omitempty"`
+}
+
+// HeartbeatMessage es enviado periódicamente por el líder para mantener su liderazgo
+type HeartbeatMessage struct {
+	Term                uint64 `json:"term"`
+	LeaderID            string `json:"leader_id"`
+	LeaderAddress       string `json:"leader_address"`
+	LeaderPublicAddress string `json:"leader_public_address,omitempty"` // Para las redirecciones de escrituras
+	LastIndex           uint64 `json:"last_index,omitempty"`            // Última entrada del log del líder
+	SchemaVersion       int    `json:"schema_version,omitempty"`        // Última migración aplicada en la base de datos del líder
+}
+
+// HeartbeatResponse es la respuesta de un seguidor a un heartbeat
+type HeartbeatResponse struct {
+	Term    uint64 `json:"term"`
+	Success bool   `json:"success"`
 }
 
 func NewClusterState(serviceName string) *ClusterState {
-	return &ClusterState{
-		Nodes:       make(map[int]*Node),
+	cs := &ClusterState{
+		Nodes:       make(map[string]*Node),
 		CurrentRole: Follower,
 		ServiceName: serviceName,
 		IsReady:     false,
+		timerReset:  time.Now(),
+		replicators: make(map[string]*followerReplicator),
+		matchIndex:  make(map[string]uint64),
+		schemas:     make(map[string]*schema.Schema),
+		gossipQueue: make(map[string]*gossipUpdate),
+		ackCh:       make(chan struct{}),
+		appliedCh:   make(chan struct{}),
 	}
+	// Identidad del nodo: se conserva entre reinicios y cambios de IP
+	nodeID, err := loadOrCreateNodeID()
+	if err != nil {
+		panic("Failed to load node id: " + err.Error())
+	}
+	cs.CurrentNodeID = nodeID
+
+	cs.WriteConcern = writeConcernFromEnv()
+	cs.WriteMode = writeModeFromEnv()
+	cs.PublicAddress = publicAddressFromEnv()
+	if err := checkAuthConfig(); err != nil {
+		panic("Invalid cluster authentication: " + err.Error())
+	}
+	if err := configureTLS(); err != nil {
+		panic("Invalid cluster TLS configuration: " + err.Error())
+	}
+	cs.Discoverer = discovererFromEnv(serviceName)
+	cs.electionTimeout = randomElectionTimeout()
+
+	// Recuperar el término y el voto persistidos. Un archivo ilegible no se puede tratar
+	// como vacío: el nodo volvería al término 0 y podría votar dos veces en un término
+	state, err := loadPersistentState()
+	if err != nil {
+		panic("Failed to load persisted cluster state: " + err.Error())
+	}
+	cs.CurrentTerm = state.CurrentTerm
+	cs.VotedFor = state.VotedFor
+	cs.maintenance = state.Maintenance
+	if cs.maintenance {
+		slog.Info("Node starts in maintenance mode")
+	}
+
+	// Número de nodos con voto: no depende de los nodos vistos por el gossip
+	size, err := resolveClusterSize(state.ClusterSize)
+	if err != nil {
+		panic("Invalid cluster size: " + err.Error())
+	}
+	cs.clusterSize = size
+	if size != state.ClusterSize {
+		if state.ClusterSize != 0 {
+			slog.Warn("Cluster size changed by CLUSTER_SIZE", "previous_size", state.ClusterSize, "cluster_size", size)
+		}
+		if err := cs.persistStateUnsafe(); err != nil {
+			panic("Failed to persist cluster size: " + err.Error())
+		}
+	}
+
+	return cs
 }
@@ -0,0 +1,174 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// WriteConcern define cuántos seguidores deben confirmar una escritura antes de responder
+type WriteConcern string
+
+const (
+	WriteConcernAsync    WriteConcern = "async"    // Responder sin esperar a los seguidores
+	WriteConcernOne      WriteConcern = "one"      // Esperar a un seguidor
+	WriteConcernMajority WriteConcern = "majority" // Esperar a la mayoría del cluster
+)
+
+// ErrWriteConcernTimeout indica que los seguidores no confirmaron la escritura a tiempo
+var ErrWriteConcernTimeout = errors.New("write concern timeout")
+
+// writeConcernFromEnv lee el modo de escritura de CLUSTER_WRITE_CONCERN (async por defecto)
+func writeConcernFromEnv() WriteConcern {
+	value := WriteConcern(strings.ToLower(os.Getenv("CLUSTER_WRITE_CONCERN")))
+	switch value {
+	case "":
+		return WriteConcernAsync
+	case WriteConcernAsync, WriteConcernOne, WriteConcernMajority:
+		return value
+	default:
+		slog.Warn("Invalid CLUSTER_WRITE_CONCERN, using default", "value", value, "default", WriteConcernAsync)
+		return WriteConcernAsync
+	}
+}
+
+// writeConcernTimeout retorna cuánto espera una escritura las confirmaciones
+func writeConcernTimeout() time.Duration {
+	return envDuration("CLUSTER_WRITE_TIMEOUT", 5*time.Second)
+}
+
+// writeTrackerKey es la clave del contexto con las escrituras de la petición
+type writeTrackerKey struct{}
+
+// writeTracker guarda la última entrada del log que escribió una petición. Otras
+// peticiones escriben en el log al mismo tiempo: el final del log no indica si esta
+// escribió algo ni qué entrada deben confirmar los seguidores.
+type writeTracker struct {
+	index atomic.Uint64
+}
+
+// trackWrites retorna una copia de ctx que registra las entradas que escriben en el
+// log las transacciones que la usan
+func trackWrites(ctx context.Context) (context.Context, *writeTracker) {
+	tracker := &writeTracker{}
+	return context.WithValue(ctx, writeTrackerKey{}, tracker), tracker
+}
+
+// recordWrite registra en la petición de ctx que escribió la entrada index del log
+func recordWrite(ctx context.Context, index uint64) {
+	if ctx == nil {
+		return
+	}
+	tracker, ok := ctx.Value(writeTrackerKey{}).(*writeTracker)
+	if !ok {
+		return
+	}
+	for {
+		last := tracker.index.Load()
+		if index <= last || tracker.index.CompareAndSwap(last, index) {
+			return
+		}
+	}
+}
+
+// lastWrite retorna la última entrada del log que escribió la petición (0 si ninguna)
+func (w *writeTracker) lastWrite() uint64 {
+	return w.index.Load()
+}
+
+// GetWriteConcern retorna el modo de escritura configurado
+func (cs *ClusterState) GetWriteConcern() WriteConcern {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	return cs.WriteConcern
+}
+
+// requiredAcksUnsafe retorna cuántos seguidores deben confirmar (usar solo con lock)
+func (cs *ClusterState) requiredAcksUnsafe() int {
+	switch cs.WriteConcern {
+	case WriteConcernOne:
+		return 1
+	case WriteConcernMajority:
+		// El líder cuenta como una de las confirmaciones de la mayoría
+		return cs.quorumSizeUnsafe() - 1
+	default:
+		return 0
+	}
+}
+
+// recordAck registra que un seguidor tiene aplicadas las entradas hasta index
+func (cs *ClusterState) recordAck(nodeID string, index uint64) {
+	cs.ackMu.Lock()
+	defer cs.ackMu.Unlock()
+
+	if index <= cs.matchIndex[nodeID] {
+		return
+	}
+	cs.matchIndex[nodeID] = index
+	cs.broadcastAcksUnsafe()
+}
+
+// forgetAcks descarta las confirmaciones de un seguidor (nodeID "" = todos)
+func (cs *ClusterState) forgetAcks(nodeID string) {
+	cs.ackMu.Lock()
+	defer cs.ackMu.Unlock()
+
+	if nodeID == "" {
+		cs.matchIndex = make(map[string]uint64)
+	} else {
+		delete(cs.matchIndex, nodeID)
+	}
+	cs.broadcastAcksUnsafe()
+}
+
+// broadcastAcksUnsafe despierta a las escrituras que esperan confirmaciones (usar con ackMu)
+func (cs *ClusterState) broadcastAcksUnsafe() {
+	close(cs.ackCh)
+	cs.ackCh = make(chan struct{})
+}
+
+// WaitForReplication bloquea hasta que los seguidores exigidos por el write concern
+// hayan aplicado la entrada index, o hasta que se agote el timeout
+func (cs *ClusterState) WaitForReplication(index uint64, timeout time.Duration) error {
+	cs.mu.RLock()
+	required := cs.requiredAcksUnsafe()
+	cs.mu.RUnlock()
+
+	if required == 0 || index == 0 {
+		return nil
+	}
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	for {
+		if !cs.IsLeader() {
+			return fmt.Errorf("%w: leadership lost while waiting for entry %d", ErrWriteConcernTimeout, index)
+		}
+
+		cs.ackMu.Lock()
+		acks := 0
+		for _, match := range cs.matchIndex {
+			if match >= index {
+				acks++
+			}
+		}
+		changed := cs.ackCh
+		cs.ackMu.Unlock()
+
+		if acks >= required {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-deadline.C:
+			return fmt.Errorf("%w: %d/%d follower acks for entry %d after %v", ErrWriteConcernTimeout, acks, required, index, timeout)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package cluster
+
+import (
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// WriteMode define qué hace un seguidor con las escrituras que recibe
+type WriteMode string
+
+const (
+	WriteModeForward  WriteMode = "forward"  // Reenviar la escritura al líder y devolver su respuesta
+	WriteModeRedirect WriteMode = "redirect" // Responder 307 con la dirección pública del líder
+	WriteModeHint     WriteMode = "hint"     // Responder 421 con la dirección pública del líder en el cuerpo
+)
+
+// LeaderHeader informa a los clientes la dirección pública del líder
+const LeaderHeader = "X-Cluster-Leader"
+
+// writeModeFromEnv lee el modo de escritura en seguidores de CLUSTER_WRITE_MODE (forward por defecto)
+func writeModeFromEnv() WriteMode {
+	value := WriteMode(strings.ToLower(os.Getenv("CLUSTER_WRITE_MODE")))
+	switch value {
+	case "":
+		return WriteModeForward
+	case WriteModeForward, WriteModeRedirect, WriteModeHint:
+		return value
+	default:
+		slog.Warn("Invalid CLUSTER_WRITE_MODE, using default", "value", value, "default", WriteModeForward)
+		return WriteModeForward
+	}
+}
+
+// publicAddressFromEnv lee la dirección con la que los clientes llegan a este nodo
+// (CLUSTER_PUBLIC_ADDRESS, por ejemplo https://node1.example.com). Es distinta de
+// Node.Address, que solo usan los nodos entre sí.
+func publicAddressFromEnv() string {
+	return strings.TrimRight(strings.TrimSpace(os.Getenv("CLUSTER_PUBLIC_ADDRESS")), "/")
+}
+
+// GetWriteMode retorna el modo de escritura en seguidores configurado
+func (cs *ClusterState) GetWriteMode() WriteMode {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	return cs.WriteMode
+}
+
+// LeaderPublicAddress retorna el ID y la dirección pública del líder actual
+// (dirección vacía si no se conoce)
+func (cs *ClusterState) LeaderPublicAddress() (string, string) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	return cs.LeaderID, cs.publicAddressOfUnsafe(cs.LeaderID)
+}
+
+// publicAddressOfUnsafe retorna la dirección pública de un nodo (usar solo con lock)
+func (cs *ClusterState) publicAddressOfUnsafe(nodeID string) string {
+	if nodeID == cs.CurrentNodeID {
+		return cs.PublicAddress
+	}
+	if node, exists := cs.Nodes[nodeID]; exists {
+		return node.PublicAddress
+	}
+	return ""
+}
+
+// routeToLeader atiende en un seguidor una escritura según el modo configurado: la
+// reenvía al líder o le indica al cliente a dónde enviarla. Si el líder no anunció una
+// dirección pública, la escritura se reenvía.
+func routeToLeader(c *fiber.Ctx, clusterState *ClusterState) error {
+	mode := clusterState.GetWriteMode()
+	if mode == WriteModeForward {
+		return forwardToLeader(c, clusterState)
+	}
+
+	leaderID, publicAddress := clusterState.LeaderPublicAddress()
+	if publicAddress == "" {
+		return forwardToLeader(c, clusterState)
+	}
+
+	leaderURL := publicAddress + c.OriginalURL()
+	c.Set(LeaderHeader, publicAddress)
+
+	if mode == WriteModeRedirect {
+		// 307 conserva el método y el cuerpo al repetir la petición
+		c.Location(leaderURL)
+		return c.Status(fiber.StatusTemporaryRedirect).JSON(fiber.Map{
+			"error":      "Not the leader",
+			"leader_url": leaderURL,
+		})
+	}
+
+	return c.Status(fiber.StatusMisdirectedRequest).JSON(fiber.Map{
+		"error":      "Not the leader",
+		"message":    "Writes must be sent to the leader",
+		"leader_id":  leaderID,
+		"leader_url": leaderURL,
+	})
+}
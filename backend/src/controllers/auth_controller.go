@@ -1,11 +1,11 @@
 package controllers
 
 import (
-	"log"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/theleywin/Backend-Talent-Nest/src/lib"
+	"github.com/theleywin/Backend-Talent-Nest/src/logging"
 	"github.com/theleywin/Backend-Talent-Nest/src/models"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
@@ -40,13 +40,13 @@ func Signup(c *fiber.Ctx) error {
 	}
 
 	var existingUser models.User
-	if err := lib.DB.Where("email = ?", userData.Email).First(&existingUser).Error; err == nil {
+	if err := lib.RequestDB(c).Where("email = ?", userData.Email).First(&existingUser).Error; err == nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"message": "El email ya existe",
 		})
 	}
 
-	if err := lib.DB.Where("username = ?", userData.Username).First(&existingUser).Error; err == nil {
+	if err := lib.RequestDB(c).Where("username = ?", userData.Username).First(&existingUser).Error; err == nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"message": "El username ya existe",
 		})
@@ -54,7 +54,7 @@ func Signup(c *fiber.Ctx) error {
 
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(userData.Password), 11)
 	if err != nil {
-		log.Printf("Error al encriptar contraseña: %v", err)
+		logging.FromContext(c.UserContext()).Error("Error al encriptar contraseña", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"message": "Error interno del servidor",
 		})
@@ -68,8 +68,8 @@ func Signup(c *fiber.Ctx) error {
 		Password: string(hashedPassword),
 	}
 
-	if err := lib.DB.Create(&newUser).Error; err != nil {
-		log.Printf("Error al crear usuario: %v", err)
+	if err := lib.RequestDB(c).Create(&newUser).Error; err != nil {
+		logging.FromContext(c.UserContext()).Error("Error al crear usuario", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"message": "Error al crear usuario",
 		})
@@ -77,7 +77,7 @@ func Signup(c *fiber.Ctx) error {
 
 	token, err := lib.GenerateJWT(newUser.ID)
 	if err != nil {
-		log.Printf("Error al generar token: %v", err)
+		logging.FromContext(c.UserContext()).Error("Error al generar token", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"message": "Error al generar token",
 		})
@@ -110,7 +110,7 @@ func Login(c *fiber.Ctx) error {
 	}
 
 	var user models.User
-	err := lib.DB.Where("username = ?", loginData.Username).First(&user).Error
+	err := lib.RequestDB(c).Where("username = ?", loginData.Username).First(&user).Error
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -118,7 +118,7 @@ func Login(c *fiber.Ctx) error {
 			})
 		}
 
-		log.Printf("Error al buscar usuario: %v", err)
+		logging.FromContext(c.UserContext()).Error("Error al buscar usuario", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"message": "Error del servidor",
 		})
@@ -133,7 +133,7 @@ func Login(c *fiber.Ctx) error {
 
 	token, err := lib.GenerateJWT(user.ID)
 	if err != nil {
-		log.Printf("Error al generar token: %v", err)
+		logging.FromContext(c.UserContext()).Error("Error al generar token", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"message": "Error del servidor",
 		})
@@ -1,11 +1,11 @@
 package controllers
 
 import (
-	"fmt"
 	"strconv"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/theleywin/Backend-Talent-Nest/src/lib"
+	"github.com/theleywin/Backend-Talent-Nest/src/logging"
 	"github.com/theleywin/Backend-Talent-Nest/src/models"
 	"gorm.io/gorm"
 )
@@ -33,7 +33,7 @@ func SendConnectionRequest(c *fiber.Ctx) error {
 
 	// Validar que no estén ya conectados
 	var existingConnection models.Connection
-	err = lib.DB.Where("(sender_id = ? AND recipient_id = ?) OR (sender_id = ? AND recipient_id = ?)",
+	err = lib.RequestDB(c).Where("(sender_id = ? AND recipient_id = ?) OR (sender_id = ? AND recipient_id = ?)",
 		user.ID, uint(targetUserID), uint(targetUserID), user.ID).
 		Where("status = ?", models.ConnectionStatusAccepted).
 		First(&existingConnection).Error
@@ -46,7 +46,7 @@ func SendConnectionRequest(c *fiber.Ctx) error {
 
 	// Verificar si ya existe una solicitud pendiente
 	var pendingRequest models.Connection
-	err = lib.DB.Where("sender_id = ? AND recipient_id = ? AND status = ?",
+	err = lib.RequestDB(c).Where("sender_id = ? AND recipient_id = ? AND status = ?",
 		user.ID, uint(targetUserID), models.ConnectionStatusPending).
 		First(&pendingRequest).Error
 
@@ -55,7 +55,7 @@ func SendConnectionRequest(c *fiber.Ctx) error {
 			"message": "A connection request already exists",
 		})
 	} else if err != gorm.ErrRecordNotFound {
-		fmt.Printf("Error checking existing connection request: %v\n", err)
+		logging.FromContext(c.UserContext()).Error("Error checking existing connection request", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"message": "Server error",
 		})
@@ -69,8 +69,8 @@ func SendConnectionRequest(c *fiber.Ctx) error {
 	}
 
 	// Guardar en la base de datos
-	if err := lib.DB.Create(&newRequest).Error; err != nil {
-		fmt.Printf("Error creating connection request: %v\n", err)
+	if err := lib.RequestDB(c).Create(&newRequest).Error; err != nil {
+		logging.FromContext(c.UserContext()).Error("Error creating connection request", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"message": "Failed to send connection request",
 		})
@@ -97,14 +97,14 @@ func AcceptConnectionRequest(c *fiber.Ctx) error {
 
 	// Buscar la solicitud de conexión
 	var request models.Connection
-	err = lib.DB.First(&request, uint(requestID)).Error
+	err = lib.RequestDB(c).First(&request, uint(requestID)).Error
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 				"message": "Connection request not found",
 			})
 		}
-		fmt.Printf("Error finding connection request: %v\n", err)
+		logging.FromContext(c.UserContext()).Error("Error finding connection request", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"message": "Server error",
 		})
@@ -126,8 +126,8 @@ func AcceptConnectionRequest(c *fiber.Ctx) error {
 
 	// Actualizar el estado de la solicitud a "accepted"
 	request.Status = models.ConnectionStatusAccepted
-	if err := lib.DB.Save(&request).Error; err != nil {
-		fmt.Printf("Error updating connection request: %v\n", err)
+	if err := lib.RequestDB(c).Save(&request).Error; err != nil {
+		logging.FromContext(c.UserContext()).Error("Error updating connection request", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"message": "Failed to accept connection request",
 		})
@@ -141,9 +141,9 @@ func AcceptConnectionRequest(c *fiber.Ctx) error {
 		Read:          false,
 	}
 
-	if err := lib.DB.Create(&notification).Error; err != nil {
+	if err := lib.RequestDB(c).Create(&notification).Error; err != nil {
 		// Log del error pero continuar (la notificación no es crítica)
-		fmt.Printf("Error creating notification: %v\n", err)
+		logging.FromContext(c.UserContext()).Error("Error creating notification", "error", err)
 	}
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
@@ -167,14 +167,14 @@ func RejectConnectionRequest(c *fiber.Ctx) error {
 
 	// Buscar la solicitud de conexión
 	var request models.Connection
-	err = lib.DB.First(&request, uint(requestID)).Error
+	err = lib.RequestDB(c).First(&request, uint(requestID)).Error
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 				"message": "Connection request not found",
 			})
 		}
-		fmt.Printf("Error finding connection request: %v\n", err)
+		logging.FromContext(c.UserContext()).Error("Error finding connection request", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"message": "Server error",
 		})
@@ -196,8 +196,8 @@ func RejectConnectionRequest(c *fiber.Ctx) error {
 
 	// Actualizar el estado de la solicitud a "rejected"
 	request.Status = models.ConnectionStatusRejected
-	if err := lib.DB.Save(&request).Error; err != nil {
-		fmt.Printf("Error rejecting connection request: %v\n", err)
+	if err := lib.RequestDB(c).Save(&request).Error; err != nil {
+		logging.FromContext(c.UserContext()).Error("Error rejecting connection request", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"message": "Failed to reject connection request",
 		})
@@ -215,13 +215,13 @@ func GetConnectionRequests(c *fiber.Ctx) error {
 
 	// Buscar solicitudes pendientes con Preload del Sender
 	var connections []models.Connection
-	err := lib.DB.Preload("Sender").
+	err := lib.RequestDB(c).Preload("Sender").
 		Where("recipient_id = ? AND status = ?", user.ID, models.ConnectionStatusPending).
 		Order("created_at DESC").
 		Find(&connections).Error
 
 	if err != nil {
-		fmt.Printf("Error finding connection requests: %v\n", err)
+		logging.FromContext(c.UserContext()).Error("Error finding connection requests", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"message": "Server error",
 		})
@@ -267,13 +267,13 @@ func GetUserConnections(c *fiber.Ctx) error {
 
 	// Buscar todas las conexiones aceptadas donde el usuario es sender o recipient
 	var connections []models.Connection
-	err := lib.DB.Preload("Sender").Preload("Recipient").
+	err := lib.RequestDB(c).Preload("Sender").Preload("Recipient").
 		Where("(sender_id = ? OR recipient_id = ?) AND status = ?",
 			user.ID, user.ID, models.ConnectionStatusAccepted).
 		Find(&connections).Error
 
 	if err != nil {
-		fmt.Printf("Error finding connections: %v\n", err)
+		logging.FromContext(c.UserContext()).Error("Error finding connections", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"message": "Server error",
 		})
@@ -329,7 +329,7 @@ func RemoveConnection(c *fiber.Ctx) error {
 
 	// Buscar la conexión entre los dos usuarios
 	var connection models.Connection
-	err = lib.DB.Where("(sender_id = ? AND recipient_id = ?) OR (sender_id = ? AND recipient_id = ?)",
+	err = lib.RequestDB(c).Where("(sender_id = ? AND recipient_id = ?) OR (sender_id = ? AND recipient_id = ?)",
 		user.ID, uint(targetUserID), uint(targetUserID), user.ID).
 		Where("status = ?", models.ConnectionStatusAccepted).
 		First(&connection).Error
@@ -340,15 +340,15 @@ func RemoveConnection(c *fiber.Ctx) error {
 				"message": "Connection does not exist",
 			})
 		}
-		fmt.Printf("Error finding connection: %v\n", err)
+		logging.FromContext(c.UserContext()).Error("Error finding connection", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"message": "Server error",
 		})
 	}
 
 	// Eliminar la conexión
-	if err := lib.DB.Delete(&connection).Error; err != nil {
-		fmt.Printf("Error removing connection: %v\n", err)
+	if err := lib.RequestDB(c).Delete(&connection).Error; err != nil {
+		logging.FromContext(c.UserContext()).Error("Error removing connection", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"message": "Failed to remove connection",
 		})
@@ -382,7 +382,7 @@ func GetConnectionStatus(c *fiber.Ctx) error {
 
 	// Verificar si ya están conectados
 	var connectedConnection models.Connection
-	err = lib.DB.Where("(sender_id = ? AND recipient_id = ?) OR (sender_id = ? AND recipient_id = ?)",
+	err = lib.RequestDB(c).Where("(sender_id = ? AND recipient_id = ?) OR (sender_id = ? AND recipient_id = ?)",
 		user.ID, uint(targetUserID), uint(targetUserID), user.ID).
 		Where("status = ?", models.ConnectionStatusAccepted).
 		First(&connectedConnection).Error
@@ -395,7 +395,7 @@ func GetConnectionStatus(c *fiber.Ctx) error {
 
 	// Verificar si existe una solicitud pendiente
 	var pendingRequest models.Connection
-	err = lib.DB.Where("(sender_id = ? AND recipient_id = ?) OR (sender_id = ? AND recipient_id = ?)",
+	err = lib.RequestDB(c).Where("(sender_id = ? AND recipient_id = ?) OR (sender_id = ? AND recipient_id = ?)",
 		user.ID, uint(targetUserID), uint(targetUserID), user.ID).
 		Where("status = ?", models.ConnectionStatusPending).
 		First(&pendingRequest).Error
@@ -414,7 +414,7 @@ func GetConnectionStatus(c *fiber.Ctx) error {
 		}
 	} else if err != gorm.ErrRecordNotFound {
 		// Error en la consulta
-		fmt.Printf("Error checking pending connection request: %v\n", err)
+		logging.FromContext(c.UserContext()).Error("Error checking pending connection request", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"message": "Server error",
 		})
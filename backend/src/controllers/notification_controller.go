@@ -1,11 +1,11 @@
 package controllers
 
 import (
-	"fmt"
 	"strconv"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/theleywin/Backend-Talent-Nest/src/lib"
+	"github.com/theleywin/Backend-Talent-Nest/src/logging"
 	"github.com/theleywin/Backend-Talent-Nest/src/models"
 	"gorm.io/gorm"
 )
@@ -17,7 +17,7 @@ func GetUserNotifications(c *fiber.Ctx) error {
 
 	// Obtener notificaciones del usuario ordenadas por fecha con relaciones precargadas
 	var notifications []models.Notification
-	err := lib.DB.Preload("RelatedUser", func(db *gorm.DB) *gorm.DB {
+	err := lib.RequestDB(c).Preload("RelatedUser", func(db *gorm.DB) *gorm.DB {
 		return db.Select("id", "name", "username", "profile_picture")
 	}).Preload("RelatedPost", func(db *gorm.DB) *gorm.DB {
 		return db.Select("id", "content", "image")
@@ -26,7 +26,7 @@ func GetUserNotifications(c *fiber.Ctx) error {
 		Find(&notifications).Error
 
 	if err != nil {
-		fmt.Printf("Error finding notifications: %v\n", err)
+		logging.FromContext(c.UserContext()).Error("Error finding notifications", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"message": "Internal server error",
 		})
@@ -98,7 +98,7 @@ func MarkNotificationAsRead(c *fiber.Ctx) error {
 
 	// Buscar y actualizar la notificación
 	var notification models.Notification
-	err = lib.DB.Where("id = ? AND recipient_id = ?", uint(notificationID), user.ID).
+	err = lib.RequestDB(c).Where("id = ? AND recipient_id = ?", uint(notificationID), user.ID).
 		First(&notification).Error
 
 	if err != nil {
@@ -107,7 +107,7 @@ func MarkNotificationAsRead(c *fiber.Ctx) error {
 				"message": "Notification not found or you don't have permission to update it",
 			})
 		}
-		fmt.Printf("Error in MarkNotificationAsRead: %v\n", err)
+		logging.FromContext(c.UserContext()).Error("Error in MarkNotificationAsRead", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"message": "Internal server error",
 		})
@@ -115,8 +115,8 @@ func MarkNotificationAsRead(c *fiber.Ctx) error {
 
 	// Actualizar el campo read
 	notification.Read = true
-	if err := lib.DB.Save(&notification).Error; err != nil {
-		fmt.Printf("Error updating notification: %v\n", err)
+	if err := lib.RequestDB(c).Save(&notification).Error; err != nil {
+		logging.FromContext(c.UserContext()).Error("Error updating notification", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"message": "Internal server error",
 		})
@@ -141,7 +141,7 @@ func DeleteNotification(c *fiber.Ctx) error {
 
 	// Buscar la notificación primero para verificar que existe y pertenece al usuario
 	var notification models.Notification
-	err = lib.DB.Where("id = ? AND recipient_id = ?", uint(notificationID), user.ID).
+	err = lib.RequestDB(c).Where("id = ? AND recipient_id = ?", uint(notificationID), user.ID).
 		First(&notification).Error
 
 	if err != nil {
@@ -150,15 +150,15 @@ func DeleteNotification(c *fiber.Ctx) error {
 				"message": "Notification not found or you don't have permission to delete it",
 			})
 		}
-		fmt.Printf("Error in DeleteNotification: %v\n", err)
+		logging.FromContext(c.UserContext()).Error("Error in DeleteNotification", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"message": "Server error",
 		})
 	}
 
 	// Eliminar la notificación
-	if err := lib.DB.Delete(&notification).Error; err != nil {
-		fmt.Printf("Error deleting notification: %v\n", err)
+	if err := lib.RequestDB(c).Delete(&notification).Error; err != nil {
+		logging.FromContext(c.UserContext()).Error("Error deleting notification", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"message": "Server error",
 		})
@@ -1,11 +1,11 @@
 package controllers
 
 import (
-	"fmt"
 	"strconv"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/theleywin/Backend-Talent-Nest/src/lib"
+	"github.com/theleywin/Backend-Talent-Nest/src/logging"
 	"github.com/theleywin/Backend-Talent-Nest/src/models"
 	"gorm.io/gorm"
 )
@@ -17,7 +17,7 @@ func GetFeedPosts(c *fiber.Ctx) error {
 
 	// Obtener IDs de las conexiones aceptadas
 	var connections []models.Connection
-	err := lib.DB.Where("(sender_id = ? OR recipient_id = ?) AND status = ?",
+	err := lib.RequestDB(c).Where("(sender_id = ? OR recipient_id = ?) AND status = ?",
 		user.ID, user.ID, models.ConnectionStatusAccepted).
 		Find(&connections).Error
 
@@ -39,7 +39,7 @@ func GetFeedPosts(c *fiber.Ctx) error {
 
 	// Buscar posts de usuarios conectados con Preload de relaciones
 	var posts []models.Post
-	err = lib.DB.Preload("Author").
+	err = lib.RequestDB(c).Preload("Author").
 		Preload("Likes").
 		Preload("Comments.User").
 		Preload("Repost.Author").
@@ -109,7 +109,7 @@ func CreatePost(c *fiber.Ctx) error {
 	if req.Repost != nil && *req.Repost > 0 {
 		// Verificar que el post a repostear existe
 		var existingPost models.Post
-		err := lib.DB.First(&existingPost, *req.Repost).Error
+		err := lib.RequestDB(c).First(&existingPost, *req.Repost).Error
 		if err != nil {
 			if err == gorm.ErrRecordNotFound {
 				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -133,14 +133,14 @@ func CreatePost(c *fiber.Ctx) error {
 	}
 
 	// Guardar en la base de datos
-	if err := lib.DB.Create(&newPost).Error; err != nil {
+	if err := lib.RequestDB(c).Create(&newPost).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"message": "Failed to create post",
 		})
 	}
 
 	// Cargar las relaciones para la respuesta
-	lib.DB.Preload("Author").Preload("Repost.Author").First(&newPost, newPost.ID)
+	lib.RequestDB(c).Preload("Author").Preload("Repost.Author").First(&newPost, newPost.ID)
 
 	return c.Status(fiber.StatusCreated).JSON(convertToPostDto(newPost))
 }
@@ -161,7 +161,7 @@ func DeletePost(c *fiber.Ctx) error {
 
 	// Buscar el post primero
 	var post models.Post
-	err = lib.DB.First(&post, uint(postID)).Error
+	err = lib.RequestDB(c).First(&post, uint(postID)).Error
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -185,13 +185,13 @@ func DeletePost(c *fiber.Ctx) error {
 		//TODO
 		// err := deleteImageFromCloudinary(post.Image)
 		// if err != nil {
-		//     println("Error deleting image from Cloudinary:", err.Error())
+		//     logging.FromContext(c.UserContext()).Warn("Error deleting image from Cloudinary", "error", err)
 		// }
 	}
 
 	// Eliminar comentarios y likes asociados (GORM lo hace automáticamente con OnDelete:CASCADE)
 	// Eliminar el post de la base de datos
-	if err := lib.DB.Delete(&post).Error; err != nil {
+	if err := lib.RequestDB(c).Delete(&post).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"message": "Failed to delete post",
 		})
@@ -215,7 +215,7 @@ func GetPostByID(c *fiber.Ctx) error {
 
 	// Buscar el post por ID con todas las relaciones
 	var post models.Post
-	err = lib.DB.Preload("Author").
+	err = lib.RequestDB(c).Preload("Author").
 		Preload("Likes").
 		Preload("Comments.User").
 		Preload("Repost.Author").
@@ -270,7 +270,7 @@ func CreateComment(c *fiber.Ctx) error {
 
 	// Verificar que el post existe
 	var post models.Post
-	err = lib.DB.First(&post, uint(postID)).Error
+	err = lib.RequestDB(c).First(&post, uint(postID)).Error
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -289,30 +289,40 @@ func CreateComment(c *fiber.Ctx) error {
 		Content: req.Content,
 	}
 
-	if err := lib.DB.Create(&newComment).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"message": "Failed to add comment",
-		})
-	}
-
-	// Crear notificación si el comentarista no es el autor del post
-	if post.AuthorID != user.ID {
-		postIDUint := uint(postID)
-		newNotification := models.Notification{
-			RecipientID:   post.AuthorID,
-			Type:          "comment",
-			RelatedUserID: user.ID,
-			RelatedPostID: postIDUint,
-			Read:          false,
+	// El comentario y su notificación se guardan (y se replican) en una sola transacción
+	err = lib.RequestDB(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&newComment).Error; err != nil {
+			return err
 		}
 
-		if err := lib.DB.Create(&newNotification).Error; err != nil {
-			fmt.Printf("Error creating notification: %v\n", err)
+		// Crear notificación si el comentarista no es el autor del post
+		if post.AuthorID != user.ID {
+			postIDUint := uint(postID)
+			newNotification := models.Notification{
+				RecipientID:   post.AuthorID,
+				Type:          "comment",
+				RelatedUserID: user.ID,
+				RelatedPostID: postIDUint,
+				Read:          false,
+			}
+
+			// El comentario y su notificación son atómicos: si la notificación falla se
+			// deshace el comentario y la petición responde 500
+			if err := tx.Create(&newNotification).Error; err != nil {
+				logging.FromContext(c.UserContext()).Error("Error creating notification", "error", err)
+				return err
+			}
 		}
+		return nil
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to add comment",
+		})
 	}
 
 	// Recargar el post con todas las relaciones
-	err = lib.DB.Preload("Author").
+	err = lib.RequestDB(c).Preload("Author").
 		Preload("Likes").
 		Preload("Comments.User").
 		Preload("Repost.Author").
@@ -343,7 +353,7 @@ func LikePost(c *fiber.Ctx) error {
 
 	// Buscar el post
 	var post models.Post
-	err = lib.DB.Preload("Likes").First(&post, uint(postID)).Error
+	err = lib.RequestDB(c).Preload("Likes").First(&post, uint(postID)).Error
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -355,57 +365,68 @@ func LikePost(c *fiber.Ctx) error {
 		})
 	}
 
-	// Verificar si el usuario ya dio like al post
-	var existingLike models.Like
-	err = lib.DB.Where("post_id = ? AND user_id = ?", uint(postID), user.ID).First(&existingLike).Error
+	// El like (o unlike) y su notificación se guardan (y se replican) en una sola transacción
+	failureMessage := "Error updating like status"
+	err = lib.RequestDB(c).Transaction(func(tx *gorm.DB) error {
+		// Verificar si el usuario ya dio like al post
+		var existingLike models.Like
+		err := tx.Where("post_id = ? AND user_id = ?", uint(postID), user.ID).First(&existingLike).Error
 
-	var shouldCreateNotification bool
+		var shouldCreateNotification bool
 
-	if err == nil {
-		// Ya existe el like, eliminarlo (unlike)
-		if err := lib.DB.Delete(&existingLike).Error; err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"message": "Failed to unlike post",
-			})
-		}
-		shouldCreateNotification = false
-	} else if err == gorm.ErrRecordNotFound {
-		// No existe el like, crearlo
-		newLike := models.Like{
-			PostID: uint(postID),
-			UserID: user.ID,
-		}
-		if err := lib.DB.Create(&newLike).Error; err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"message": "Failed to like post",
-			})
+		if err == nil {
+			// Ya existe el like, eliminarlo (unlike)
+			if err := tx.Delete(&existingLike).Error; err != nil {
+				failureMessage = "Failed to unlike post"
+				return err
+			}
+			shouldCreateNotification = false
+		} else if err == gorm.ErrRecordNotFound {
+			// No existe el like, crearlo
+			newLike := models.Like{
+				PostID: uint(postID),
+				UserID: user.ID,
+			}
+			if err := tx.Create(&newLike).Error; err != nil {
+				failureMessage = "Failed to like post"
+				return err
+			}
+			// Crear notificación solo si el usuario no es el autor del post
+			shouldCreateNotification = (post.AuthorID != user.ID)
+		} else {
+			failureMessage = "Error checking like status"
+			return err
 		}
-		// Crear notificación solo si el usuario no es el autor del post
-		shouldCreateNotification = (post.AuthorID != user.ID)
-	} else {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"message": "Error checking like status",
-		})
-	}
 
-	// Crear notificación si es necesario
-	if shouldCreateNotification {
-		postIDUint := uint(postID)
-		newNotification := models.Notification{
-			RecipientID:   post.AuthorID,
-			Type:          "like",
-			RelatedUserID: user.ID,
-			RelatedPostID: postIDUint,
-			Read:          false,
-		}
+		// Crear notificación si es necesario
+		if shouldCreateNotification {
+			postIDUint := uint(postID)
+			newNotification := models.Notification{
+				RecipientID:   post.AuthorID,
+				Type:          "like",
+				RelatedUserID: user.ID,
+				RelatedPostID: postIDUint,
+				Read:          false,
+			}
 
-		if err := lib.DB.Create(&newNotification).Error; err != nil {
-			fmt.Printf("Error creating notification: %v\n", err)
+			// El like y su notificación son atómicos: si la notificación falla se deshace
+			// el like y la petición responde 500
+			if err := tx.Create(&newNotification).Error; err != nil {
+				logging.FromContext(c.UserContext()).Error("Error creating notification", "error", err)
+				failureMessage = "Failed to like post"
+				return err
+			}
 		}
+		return nil
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": failureMessage,
+		})
 	}
 
 	// Recargar el post con todas las relaciones
-	err = lib.DB.Preload("Author").
+	err = lib.RequestDB(c).Preload("Author").
 		Preload("Likes").
 		Preload("Comments.User").
 		Preload("Repost.Author").
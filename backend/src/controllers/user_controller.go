@@ -1,12 +1,11 @@
 package controllers
 
 import (
-	"fmt"
-	"log"
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/theleywin/Backend-Talent-Nest/src/lib"
+	"github.com/theleywin/Backend-Talent-Nest/src/logging"
 	"github.com/theleywin/Backend-Talent-Nest/src/models"
 	"gorm.io/gorm"
 )
@@ -17,12 +16,12 @@ func GetSuggestedConnections(c *fiber.Ctx) error {
 
 	// Obtener IDs de usuarios ya conectados
 	var connections []models.Connection
-	err := lib.DB.Where("(sender_id = ? OR recipient_id = ?) AND status = ?",
+	err := lib.RequestDB(c).Where("(sender_id = ? OR recipient_id = ?) AND status = ?",
 		user.ID, user.ID, models.ConnectionStatusAccepted).
 		Find(&connections).Error
 
 	if err != nil {
-		log.Printf("Error al buscar conexiones: %v", err)
+		logging.FromContext(c.UserContext()).Error("Error al buscar conexiones", "error", err)
 		return c.Status(500).JSON(fiber.Map{
 			"message": "Error interno del servidor",
 		})
@@ -40,13 +39,13 @@ func GetSuggestedConnections(c *fiber.Ctx) error {
 
 	// Buscar usuarios sugeridos
 	var suggestedUsers []models.User
-	err = lib.DB.Select("id", "name", "username", "profile_picture", "head_line").
+	err = lib.RequestDB(c).Select("id", "name", "username", "profile_picture", "head_line").
 		Where("id NOT IN ?", excludeIDs).
 		Limit(3).
 		Find(&suggestedUsers).Error
 
 	if err != nil {
-		log.Printf("Error en la consulta: %v", err)
+		logging.FromContext(c.UserContext()).Error("Error en la consulta", "error", err)
 		return c.Status(500).JSON(fiber.Map{
 			"message": "Error al buscar usuarios sugeridos",
 		})
@@ -79,7 +78,7 @@ func GetPublicProfile(c *fiber.Ctx) error {
 	}
 
 	var user models.User
-	err := lib.DB.Select("id", "name", "username", "email", "profile_picture", "cover_picture",
+	err := lib.RequestDB(c).Select("id", "name", "username", "email", "profile_picture", "cover_picture",
 		"head_line", "about", "location", "skills", "experience", "education",
 		"created_at", "updated_at").
 		Where("username = ?", username).
@@ -92,14 +91,14 @@ func GetPublicProfile(c *fiber.Ctx) error {
 			})
 		}
 
-		log.Printf("Error en GetPublicProfile controller: %v", err)
+		logging.FromContext(c.UserContext()).Error("Error en GetPublicProfile controller", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"message": "Error del servidor",
 		})
 	}
 
 	// Poblar conexiones
-	user.Connections = user.GetConnections(lib.DB)
+	user.Connections = user.GetConnections(lib.RequestDB(c))
 
 	return c.JSON(user)
 }
@@ -117,7 +116,7 @@ func UpdateProfile(c *fiber.Ctx) error {
 
 	// Cargar el usuario actual de la base de datos
 	var currentUser models.User
-	if err := lib.DB.First(&currentUser, user.ID).Error; err != nil {
+	if err := lib.RequestDB(c).First(&currentUser, user.ID).Error; err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"error": "Usuario no encontrado",
 		})
@@ -208,21 +207,21 @@ func UpdateProfile(c *fiber.Ctx) error {
 	// }
 
 	// Guardar los cambios
-	if err := lib.DB.Save(&currentUser).Error; err != nil {
+	if err := lib.RequestDB(c).Save(&currentUser).Error; err != nil {
 		if strings.Contains(err.Error(), "UNIQUE constraint failed") && strings.Contains(err.Error(), "username") {
 			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
 				"error": "El nombre de usuario ya está en uso",
 			})
 		}
 
-		fmt.Printf("Error al actualizar el usuario: %v\n", err)
+		logging.FromContext(c.UserContext()).Error("Error al actualizar el usuario", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Error al actualizar el usuario",
 		})
 	}
 
 	// Poblar conexiones
-	currentUser.Connections = currentUser.GetConnections(lib.DB)
+	currentUser.Connections = currentUser.GetConnections(lib.RequestDB(c))
 
 	// Limpiar password antes de devolver
 	currentUser.Password = ""
@@ -237,17 +236,17 @@ func SearchUsers(c *fiber.Ctx) error {
 		return c.JSON([]models.UserDto{})
 	}
 
-	// Búsqueda case-insensitive en SQLite usando LIKE
-	searchPattern := "%" + query + "%"
+	// Búsqueda case-insensitive con LIKE (en PostgreSQL LIKE distingue mayúsculas)
+	searchPattern := "%" + strings.ToLower(query) + "%"
 
 	var users []models.User
-	err := lib.DB.Select("id", "name", "username", "profile_picture", "head_line").
-		Where("name LIKE ? OR username LIKE ?", searchPattern, searchPattern).
+	err := lib.RequestDB(c).Select("id", "name", "username", "profile_picture", "head_line").
+		Where("LOWER(name) LIKE ? OR LOWER(username) LIKE ?", searchPattern, searchPattern).
 		Limit(10).
 		Find(&users).Error
 
 	if err != nil {
-		log.Printf("Error searching users: %v", err)
+		logging.FromContext(c.UserContext()).Error("Error searching users", "error", err)
 		return c.Status(500).JSON(fiber.Map{
 			"message": "Error al buscar usuarios",
 		})
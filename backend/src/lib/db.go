@@ -1,27 +1,225 @@
 package lib
 
 import (
-	"log"
+	"fmt"
+	"log/slog"
 	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
 
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/gofiber/fiber/v2"
+	"github.com/theleywin/Backend-Talent-Nest/src/tracing"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
-var DB *gorm.DB
+// current holds the database handle. A follower replaces it after installing a snapshot
+// from the leader, so it is only read through DB, RequestDB or AcquireDB.
+var current atomic.Pointer[gorm.DB]
 
-// ConnectDB initializes the SQLite connection and sets the global DB variable
-func ConnectDB() {
+// Leases on the current handle. DrainDB waits until every lease is released before the
+// database is replaced and rejects new leases until it is reopened.
+var (
+	leaseMu   sync.Mutex
+	leaseDone = sync.NewCond(&leaseMu)
+	leases    int
+	draining  bool
+)
+
+// dbLocalsKey stores in the request locals the handle leased for the request
+const dbLocalsKey = "db"
+
+// Database drivers accepted in DB_DRIVER
+const (
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+	DriverMySQL    = "mysql"
+)
+
+// DatabaseDriver returns the driver selected with DB_DRIVER (sqlite by default)
+func DatabaseDriver() string {
+	driver := strings.ToLower(strings.TrimSpace(os.Getenv("DB_DRIVER")))
+	if driver == "" {
+		return DriverSQLite
+	}
+	return driver
+}
+
+// SharedDatabase reports whether the nodes connect to an external database server.
+// Every node then sees the same data, so the cluster does not replicate it.
+func SharedDatabase() bool {
+	return DatabaseDriver() != DriverSQLite
+}
+
+// DatabasePath returns the SQLite file path from DB_PATH or the default location
+func DatabasePath() string {
 	var dbPath string = os.Getenv("DB_PATH")
 	if dbPath == "" {
 		dbPath = "./talentnest.db"
 	}
+	return dbPath
+}
 
-	var err error
-	DB, err = gorm.Open(sqlite.Open(dbPath), &gorm.Config{})
+// ConnectDB initializes the connection to the database selected with DB_DRIVER
+func ConnectDB() {
+	db, err := openDB()
 	if err != nil {
 		panic("Failed to connect to database: " + err.Error())
 	}
+	current.Store(db)
+
+	if SharedDatabase() {
+		slog.Info("Connected to database", "driver", DatabaseDriver())
+		return
+	}
+	slog.Info("Connected to SQLite", "path", DatabasePath())
+}
+
+// DB returns the current database handle. Code that runs inside a request should use
+// RequestDB instead, which keeps the handle from being replaced until the request ends.
+func DB() *gorm.DB {
+	return current.Load()
+}
+
+// AcquireDB leases the current database handle until release is called. It reports
+// false while the database is being replaced.
+func AcquireDB() (db *gorm.DB, release func(), ok bool) {
+	leaseMu.Lock()
+	defer leaseMu.Unlock()
+
+	if draining {
+		return nil, nil, false
+	}
+	leases++
+
+	var once sync.Once
+	release = func() {
+		once.Do(func() {
+			leaseMu.Lock()
+			leases--
+			if leases == 0 {
+				leaseDone.Broadcast()
+			}
+			leaseMu.Unlock()
+		})
+	}
+	return current.Load(), release, true
+}
+
+// LeaseDB leases the current database handle for the request, so every call to
+// RequestDB in the request returns the same handle
+func LeaseDB(c *fiber.Ctx) (release func(), ok bool) {
+	db, release, ok := AcquireDB()
+	if !ok {
+		return nil, false
+	}
+	c.Locals(dbLocalsKey, db)
+	return release, true
+}
+
+// DrainDB rejects new leases and waits for the current ones to be released. The
+// database can then be closed and replaced; resume accepts leases again.
+func DrainDB() (resume func()) {
+	leaseMu.Lock()
+	draining = true
+	for leases > 0 {
+		leaseDone.Wait()
+	}
+	leaseMu.Unlock()
+
+	return func() {
+		leaseMu.Lock()
+		draining = false
+		leaseMu.Unlock()
+	}
+}
+
+// dialector returns the GORM dialector of DB_DRIVER: SQLite opens the file at DB_PATH,
+// PostgreSQL and MySQL connect to the server described by DB_DSN
+func dialector() (gorm.Dialector, error) {
+	driver := DatabaseDriver()
+	if driver == DriverSQLite {
+		return sqlite.Open(DatabasePath()), nil
+	}
+
+	dsn := os.Getenv("DB_DSN")
+	if dsn == "" {
+		return nil, fmt.Errorf("DB_DSN is required with DB_DRIVER=%s", driver)
+	}
+
+	switch driver {
+	case DriverPostgres:
+		return postgres.Open(dsn), nil
+	case DriverMySQL:
+		// Leer las fechas como time.Time y aceptar migraciones con varias sentencias
+		config, err := mysqldriver.ParseDSN(dsn)
+		if err != nil {
+			return nil, fmt.Errorf("invalid DB_DSN: %v", err)
+		}
+		config.ParseTime = true
+		config.MultiStatements = true
+		return mysql.Open(config.FormatDSN()), nil
+	default:
+		return nil, fmt.Errorf("unknown DB_DRIVER %q (use sqlite, postgres or mysql)", driver)
+	}
+}
+
+// openDB opens the database with the tracing plugin, so every query becomes a span of
+// the request that ran it
+func openDB() (*gorm.DB, error) {
+	dialector, err := dialector()
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := gorm.Open(dialector, &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Use(tracing.GormPlugin{}); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// RequestDB returns the database handle leased for the request (the current one if
+// the request holds no lease) bound to the request context, so the writes of the
+// request carry its request ID into the replication log and its queries are traced as
+// part of the request
+func RequestDB(c *fiber.Ctx) *gorm.DB {
+	db, ok := c.Locals(dbLocalsKey).(*gorm.DB)
+	if !ok {
+		db = DB()
+	}
+	return db.WithContext(c.UserContext())
+}
+
+// CloseDB closes the connection pool of the current DB
+func CloseDB() error {
+	sqlDB, err := DB().DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
+// ReconnectDB opens a new connection to the database file, prepares it with setup and
+// makes it the current DB. It is used after the file has been replaced with a snapshot
+// from the leader, while the database is drained (DrainDB).
+func ReconnectDB(setup func(db *gorm.DB) error) (*gorm.DB, error) {
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	if err := setup(db); err != nil {
+		return nil, err
+	}
 
-	log.Println("Connected to SQLite!")
+	current.Store(db)
+	slog.Info("Reconnected to SQLite", "path", DatabasePath())
+	return db, nil
 }
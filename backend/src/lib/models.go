@@ -0,0 +1,17 @@
+package lib
+
+import (
+	"github.com/theleywin/Backend-Talent-Nest/src/models"
+)
+
+// Models lists every model stored in the database. Their tables are created by the
+// versioned migrations in src/migrations (a model change needs a new migration), and
+// they are registered with the cluster so followers can decode replicated rows.
+var Models = []interface{}{
+	&models.User{},
+	&models.Connection{},
+	&models.Post{},
+	&models.Comment{},
+	&models.Like{},
+	&models.Notification{},
+}
@@ -61,7 +61,7 @@ func VerifyJWT(tokenString string) (jwt.MapClaims, error) {
 // Searches for a user by ID and excludes the password from the result
 func FindUserByID(userID uint) (*models.User, error) {
 	var user models.User
-	err := DB.Select("id", "name", "username", "email", "profile_picture", "cover_picture", "headline", "about", "location").
+	err := DB().Select("id", "name", "username", "email", "profile_picture", "cover_picture", "headline", "about", "location").
 		First(&user, userID).Error
 
 	if err != nil {
@@ -0,0 +1,68 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// RequestIDHeader carries the request ID between clients and nodes
+const RequestIDHeader = "X-Request-ID"
+
+// requestIDKey is the context key of the request ID
+type requestIDKey struct{}
+
+// Setup configures the default slog logger from LOG_LEVEL (debug, info, warn, error;
+// info by default) and LOG_FORMAT (text or json; text by default). Messages written
+// with the standard log package go through the same logger at info level.
+func Setup() {
+	options := &slog.HandlerOptions{Level: parseLevel(os.Getenv("LOG_LEVEL"))}
+
+	var handler slog.Handler
+	switch strings.ToLower(os.Getenv("LOG_FORMAT")) {
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, options)
+	default:
+		handler = slog.NewTextHandler(os.Stderr, options)
+	}
+
+	slog.SetDefault(slog.New(handler))
+}
+
+// parseLevel converts a LOG_LEVEL value into a slog level (info if it is not valid)
+func parseLevel(value string) slog.Level {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(strings.TrimSpace(value))); err != nil {
+		return slog.LevelInfo
+	}
+	return level
+}
+
+// WithRequestID returns a copy of ctx that carries the request ID
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestID returns the request ID carried by ctx ("" if there is none)
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// FromContext returns the default logger with the request ID of ctx attached
+func FromContext(ctx context.Context) *slog.Logger {
+	return With(RequestID(ctx))
+}
+
+// With returns the default logger with the given request ID attached (the default
+// logger itself if the ID is empty)
+func With(requestID string) *slog.Logger {
+	if requestID == "" {
+		return slog.Default()
+	}
+	return slog.Default().With("request_id", requestID)
+}
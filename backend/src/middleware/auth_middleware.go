@@ -45,7 +45,7 @@ func ProtectRoute(c *fiber.Ctx) error {
 	userID := uint(userIDFloat)
 
 	var user models.User
-	err = lib.DB.First(&user, userID).Error
+	err = lib.RequestDB(c).First(&user, userID).Error
 	if err != nil {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"message": "Usuario no encontrado",
@@ -53,7 +53,7 @@ func ProtectRoute(c *fiber.Ctx) error {
 	}
 
 	// Poblar conexiones
-	user.Connections = user.GetConnections(lib.DB)
+	user.Connections = user.GetConnections(lib.RequestDB(c))
 
 	user.Password = ""
 
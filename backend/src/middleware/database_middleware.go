@@ -0,0 +1,23 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/theleywin/Backend-Talent-Nest/src/lib"
+)
+
+// DatabaseLease keeps the database handle used by the request from being closed until
+// the request finishes. While a follower replaces its database with a snapshot from the
+// leader, new requests are rejected with 503 and Retry-After.
+func DatabaseLease(c *fiber.Ctx) error {
+	release, ok := lib.LeaseDB(c)
+	if !ok {
+		c.Set(fiber.HeaderRetryAfter, "1")
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error":   "Database unavailable",
+			"message": "The node is installing a snapshot from the leader, retry shortly",
+		})
+	}
+	defer release()
+
+	return c.Next()
+}
@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/theleywin/Backend-Talent-Nest/src/logging"
+)
+
+// maxRequestIDLength limits the request IDs accepted from clients
+const maxRequestIDLength = 128
+
+// RequestID is a middleware that reuses the X-Request-ID header of the request or
+// generates a new ID, returns it in the response and stores it in the user context
+// so logs, forwarded requests and replicated writes carry it
+func RequestID(c *fiber.Ctx) error {
+	// Copiar el header: Fiber reutiliza su buffer al terminar la petición
+	requestID := strings.Clone(c.Get(logging.RequestIDHeader))
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		requestID = uuid.NewString()
+	}
+
+	c.Set(logging.RequestIDHeader, requestID)
+	c.SetUserContext(logging.WithRequestID(c.UserContext(), requestID))
+
+	return c.Next()
+}
@@ -0,0 +1,26 @@
+// Package migrations holds the numbered migrations of the database schema, one
+// directory per database driver (sqlite, postgres, mysql). Each version has a
+// NNNN_name.up.sql file and, to be able to revert it, a NNNN_name.down.sql file.
+// Every directory has the same versions with the same names: a schema change is
+// written once per driver. Migrations are never edited once released: a schema
+// change is a new version.
+package migrations
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+)
+
+// Files are the SQL files of every migration
+//
+//go:embed sqlite/*.sql postgres/*.sql mysql/*.sql
+var Files embed.FS
+
+// For returns the migrations written for the given database driver
+func For(driver string) (fs.FS, error) {
+	if _, err := fs.Stat(Files, driver); err != nil {
+		return nil, fmt.Errorf("no schema migrations for database driver %q", driver)
+	}
+	return fs.Sub(Files, driver)
+}
@@ -0,0 +1,15 @@
+-- Initial schema, the MySQL version of sqlite/0001_initial_schema.up.sql. MySQL has
+-- no CREATE INDEX IF NOT EXISTS, so the indexes are declared with their tables, and
+-- the indexed text columns are varchar(191) to fit the index key limit of utf8mb4.
+
+CREATE TABLE IF NOT EXISTS `users` (`id` bigint unsigned AUTO_INCREMENT,`created_at` datetime(3) NULL,`updated_at` datetime(3) NULL,`deleted_at` datetime(3) NULL,`name` longtext,`username` varchar(191),`email` varchar(191),`password` longtext,`profile_picture` longtext,`cover_picture` longtext,`head_line` longtext,`about` longtext,`location` longtext,`skills` longtext,`experience` longtext,`education` longtext,PRIMARY KEY (`id`),UNIQUE INDEX `idx_users_email` (`email`),UNIQUE INDEX `idx_users_username` (`username`),INDEX `idx_users_deleted_at` (`deleted_at`));
+
+CREATE TABLE IF NOT EXISTS `connections` (`id` bigint unsigned AUTO_INCREMENT,`created_at` datetime(3) NULL,`updated_at` datetime(3) NULL,`deleted_at` datetime(3) NULL,`sender_id` bigint unsigned,`recipient_id` bigint unsigned,`status` longtext,PRIMARY KEY (`id`),INDEX `idx_connections_recipient_id` (`recipient_id`),INDEX `idx_connections_sender_id` (`sender_id`),INDEX `idx_connections_deleted_at` (`deleted_at`),CONSTRAINT `fk_connections_sender` FOREIGN KEY (`sender_id`) REFERENCES `users`(`id`),CONSTRAINT `fk_connections_recipient` FOREIGN KEY (`recipient_id`) REFERENCES `users`(`id`));
+
+CREATE TABLE IF NOT EXISTS `posts` (`id` bigint unsigned AUTO_INCREMENT,`created_at` datetime(3) NULL,`updated_at` datetime(3) NULL,`deleted_at` datetime(3) NULL,`author_id` bigint unsigned,`content` text,`image` longtext,`repost_id` bigint unsigned DEFAULT null,PRIMARY KEY (`id`),INDEX `idx_posts_author_id` (`author_id`),INDEX `idx_posts_deleted_at` (`deleted_at`),CONSTRAINT `fk_posts_author` FOREIGN KEY (`author_id`) REFERENCES `users`(`id`),CONSTRAINT `fk_posts_repost` FOREIGN KEY (`repost_id`) REFERENCES `posts`(`id`));
+
+CREATE TABLE IF NOT EXISTS `comments` (`id` bigint unsigned AUTO_INCREMENT,`created_at` datetime(3) NULL,`updated_at` datetime(3) NULL,`deleted_at` datetime(3) NULL,`post_id` bigint unsigned,`user_id` bigint unsigned,`content` text,PRIMARY KEY (`id`),INDEX `idx_comments_user_id` (`user_id`),INDEX `idx_comments_post_id` (`post_id`),INDEX `idx_comments_deleted_at` (`deleted_at`),CONSTRAINT `fk_comments_user` FOREIGN KEY (`user_id`) REFERENCES `users`(`id`),CONSTRAINT `fk_posts_comments` FOREIGN KEY (`post_id`) REFERENCES `posts`(`id`));
+
+CREATE TABLE IF NOT EXISTS `likes` (`id` bigint unsigned AUTO_INCREMENT,`created_at` datetime(3) NULL,`updated_at` datetime(3) NULL,`deleted_at` datetime(3) NULL,`post_id` bigint unsigned,`user_id` bigint unsigned,PRIMARY KEY (`id`),INDEX `idx_likes_user_id` (`user_id`),INDEX `idx_likes_post_id` (`post_id`),INDEX `idx_likes_deleted_at` (`deleted_at`),CONSTRAINT `fk_likes_user` FOREIGN KEY (`user_id`) REFERENCES `users`(`id`),CONSTRAINT `fk_posts_likes` FOREIGN KEY (`post_id`) REFERENCES `posts`(`id`));
+
+CREATE TABLE IF NOT EXISTS `notifications` (`id` bigint unsigned AUTO_INCREMENT,`created_at` datetime(3) NULL,`updated_at` datetime(3) NULL,`deleted_at` datetime(3) NULL,`recipient_id` bigint unsigned,`type` varchar(50),`related_user_id` bigint unsigned DEFAULT null,`related_post_id` bigint unsigned DEFAULT null,`read` boolean DEFAULT false,PRIMARY KEY (`id`),INDEX `idx_notifications_recipient_id` (`recipient_id`),INDEX `idx_notifications_deleted_at` (`deleted_at`),CONSTRAINT `fk_notifications_recipient` FOREIGN KEY (`recipient_id`) REFERENCES `users`(`id`),CONSTRAINT `fk_notifications_related_user` FOREIGN KEY (`related_user_id`) REFERENCES `users`(`id`),CONSTRAINT `fk_notifications_related_post` FOREIGN KEY (`related_post_id`) REFERENCES `posts`(`id`));
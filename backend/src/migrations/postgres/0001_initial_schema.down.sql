@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS "notifications";
+DROP TABLE IF EXISTS "likes";
+DROP TABLE IF EXISTS "comments";
+DROP TABLE IF EXISTS "posts";
+DROP TABLE IF EXISTS "connections";
+DROP TABLE IF EXISTS "users";
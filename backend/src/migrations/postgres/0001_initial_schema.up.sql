@@ -0,0 +1,29 @@
+-- Initial schema, the PostgreSQL version of sqlite/0001_initial_schema.up.sql.
+
+CREATE TABLE IF NOT EXISTS "users" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"name" text,"username" text,"email" text,"password" text,"profile_picture" text,"cover_picture" text,"head_line" text,"about" text,"location" text,"skills" text,"experience" text,"education" text,PRIMARY KEY ("id"));
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_users_email" ON "users" ("email");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_users_username" ON "users" ("username");
+CREATE INDEX IF NOT EXISTS "idx_users_deleted_at" ON "users" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "connections" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"sender_id" bigint,"recipient_id" bigint,"status" text,PRIMARY KEY ("id"),CONSTRAINT "fk_connections_sender" FOREIGN KEY ("sender_id") REFERENCES "users"("id"),CONSTRAINT "fk_connections_recipient" FOREIGN KEY ("recipient_id") REFERENCES "users"("id"));
+CREATE INDEX IF NOT EXISTS "idx_connections_recipient_id" ON "connections" ("recipient_id");
+CREATE INDEX IF NOT EXISTS "idx_connections_sender_id" ON "connections" ("sender_id");
+CREATE INDEX IF NOT EXISTS "idx_connections_deleted_at" ON "connections" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "posts" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"author_id" bigint,"content" text,"image" text,"repost_id" bigint DEFAULT null,PRIMARY KEY ("id"),CONSTRAINT "fk_posts_author" FOREIGN KEY ("author_id") REFERENCES "users"("id"),CONSTRAINT "fk_posts_repost" FOREIGN KEY ("repost_id") REFERENCES "posts"("id"));
+CREATE INDEX IF NOT EXISTS "idx_posts_author_id" ON "posts" ("author_id");
+CREATE INDEX IF NOT EXISTS "idx_posts_deleted_at" ON "posts" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "comments" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"post_id" bigint,"user_id" bigint,"content" text,PRIMARY KEY ("id"),CONSTRAINT "fk_comments_user" FOREIGN KEY ("user_id") REFERENCES "users"("id"),CONSTRAINT "fk_posts_comments" FOREIGN KEY ("post_id") REFERENCES "posts"("id"));
+CREATE INDEX IF NOT EXISTS "idx_comments_user_id" ON "comments" ("user_id");
+CREATE INDEX IF NOT EXISTS "idx_comments_post_id" ON "comments" ("post_id");
+CREATE INDEX IF NOT EXISTS "idx_comments_deleted_at" ON "comments" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "likes" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"post_id" bigint,"user_id" bigint,PRIMARY KEY ("id"),CONSTRAINT "fk_likes_user" FOREIGN KEY ("user_id") REFERENCES "users"("id"),CONSTRAINT "fk_posts_likes" FOREIGN KEY ("post_id") REFERENCES "posts"("id"));
+CREATE INDEX IF NOT EXISTS "idx_likes_user_id" ON "likes" ("user_id");
+CREATE INDEX IF NOT EXISTS "idx_likes_post_id" ON "likes" ("post_id");
+CREATE INDEX IF NOT EXISTS "idx_likes_deleted_at" ON "likes" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "notifications" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"recipient_id" bigint,"type" varchar(50),"related_user_id" bigint DEFAULT null,"related_post_id" bigint DEFAULT null,"read" boolean DEFAULT false,PRIMARY KEY ("id"),CONSTRAINT "fk_notifications_recipient" FOREIGN KEY ("recipient_id") REFERENCES "users"("id"),CONSTRAINT "fk_notifications_related_user" FOREIGN KEY ("related_user_id") REFERENCES "users"("id"),CONSTRAINT "fk_notifications_related_post" FOREIGN KEY ("related_post_id") REFERENCES "posts"("id"));
+CREATE INDEX IF NOT EXISTS "idx_notifications_recipient_id" ON "notifications" ("recipient_id");
+CREATE INDEX IF NOT EXISTS "idx_notifications_deleted_at" ON "notifications" ("deleted_at");
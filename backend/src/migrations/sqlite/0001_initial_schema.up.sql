@@ -0,0 +1,30 @@
+-- Initial schema. IF NOT EXISTS adopts the databases created with AutoMigrate before
+-- versioned migrations existed without changing them.
+
+CREATE TABLE IF NOT EXISTS `users` (`id` integer PRIMARY KEY AUTOINCREMENT,`created_at` datetime,`updated_at` datetime,`deleted_at` datetime,`name` text,`username` text,`email` text,`password` text,`profile_picture` text,`cover_picture` text,`head_line` text,`about` text,`location` text,`skills` text,`experience` text,`education` text);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_users_email` ON `users`(`email`);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_users_username` ON `users`(`username`);
+CREATE INDEX IF NOT EXISTS `idx_users_deleted_at` ON `users`(`deleted_at`);
+
+CREATE TABLE IF NOT EXISTS `connections` (`id` integer PRIMARY KEY AUTOINCREMENT,`created_at` datetime,`updated_at` datetime,`deleted_at` datetime,`sender_id` integer,`recipient_id` integer,`status` text,CONSTRAINT `fk_connections_sender` FOREIGN KEY (`sender_id`) REFERENCES `users`(`id`),CONSTRAINT `fk_connections_recipient` FOREIGN KEY (`recipient_id`) REFERENCES `users`(`id`));
+CREATE INDEX IF NOT EXISTS `idx_connections_recipient_id` ON `connections`(`recipient_id`);
+CREATE INDEX IF NOT EXISTS `idx_connections_sender_id` ON `connections`(`sender_id`);
+CREATE INDEX IF NOT EXISTS `idx_connections_deleted_at` ON `connections`(`deleted_at`);
+
+CREATE TABLE IF NOT EXISTS `posts` (`id` integer PRIMARY KEY AUTOINCREMENT,`created_at` datetime,`updated_at` datetime,`deleted_at` datetime,`author_id` integer,`content` text,`image` text,`repost_id` integer DEFAULT null,CONSTRAINT `fk_posts_author` FOREIGN KEY (`author_id`) REFERENCES `users`(`id`),CONSTRAINT `fk_posts_repost` FOREIGN KEY (`repost_id`) REFERENCES `posts`(`id`));
+CREATE INDEX IF NOT EXISTS `idx_posts_author_id` ON `posts`(`author_id`);
+CREATE INDEX IF NOT EXISTS `idx_posts_deleted_at` ON `posts`(`deleted_at`);
+
+CREATE TABLE IF NOT EXISTS `comments` (`id` integer PRIMARY KEY AUTOINCREMENT,`created_at` datetime,`updated_at` datetime,`deleted_at` datetime,`post_id` integer,`user_id` integer,`content` text,CONSTRAINT `fk_comments_user` FOREIGN KEY (`user_id`) REFERENCES `users`(`id`),CONSTRAINT `fk_posts_comments` FOREIGN KEY (`post_id`) REFERENCES `posts`(`id`));
+CREATE INDEX IF NOT EXISTS `idx_comments_user_id` ON `comments`(`user_id`);
+CREATE INDEX IF NOT EXISTS `idx_comments_post_id` ON `comments`(`post_id`);
+CREATE INDEX IF NOT EXISTS `idx_comments_deleted_at` ON `comments`(`deleted_at`);
+
+CREATE TABLE IF NOT EXISTS `likes` (`id` integer PRIMARY KEY AUTOINCREMENT,`created_at` datetime,`updated_at` datetime,`deleted_at` datetime,`post_id` integer,`user_id` integer,CONSTRAINT `fk_likes_user` FOREIGN KEY (`user_id`) REFERENCES `users`(`id`),CONSTRAINT `fk_posts_likes` FOREIGN KEY (`post_id`) REFERENCES `posts`(`id`));
+CREATE INDEX IF NOT EXISTS `idx_likes_user_id` ON `likes`(`user_id`);
+CREATE INDEX IF NOT EXISTS `idx_likes_post_id` ON `likes`(`post_id`);
+CREATE INDEX IF NOT EXISTS `idx_likes_deleted_at` ON `likes`(`deleted_at`);
+
+CREATE TABLE IF NOT EXISTS `notifications` (`id` integer PRIMARY KEY AUTOINCREMENT,`created_at` datetime,`updated_at` datetime,`deleted_at` datetime,`recipient_id` integer,`type` varchar(50),`related_user_id` integer DEFAULT null,`related_post_id` integer DEFAULT null,`read` numeric DEFAULT false,CONSTRAINT `fk_notifications_recipient` FOREIGN KEY (`recipient_id`) REFERENCES `users`(`id`),CONSTRAINT `fk_notifications_related_user` FOREIGN KEY (`related_user_id`) REFERENCES `users`(`id`),CONSTRAINT `fk_notifications_related_post` FOREIGN KEY (`related_post_id`) REFERENCES `posts`(`id`));
+CREATE INDEX IF NOT EXISTS `idx_notifications_recipient_id` ON `notifications`(`recipient_id`);
+CREATE INDEX IF NOT EXISTS `idx_notifications_deleted_at` ON `notifications`(`deleted_at`);
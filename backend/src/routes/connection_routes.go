@@ -1,20 +1,20 @@
 package routes
 
 import (
-	"github.com/gofiber/fiber/v2"
+	"github.com/theleywin/Backend-Talent-Nest/src/cluster"
 	"github.com/theleywin/Backend-Talent-Nest/src/controllers"
 	"github.com/theleywin/Backend-Talent-Nest/src/middleware"
 )
 
 // ConnectionRoutes sets up connection-related routes for sending, accepting, rejecting requests, listing requests, getting connections, removing connections, and checking connection status
-func ConnectionRoutes(app *fiber.App) {
-	connection := app.Group("/api/v1/connections", middleware.ProtectRoute)
+func ConnectionRoutes(router *cluster.Router) {
+	connection := router.Group("/api/v1/connections", middleware.ProtectRoute)
 
-	connection.Post("/request/:userId", controllers.SendConnectionRequest)
-	connection.Put("/accept/:requestId", controllers.AcceptConnectionRequest)
-	connection.Put("/reject/:requestId", controllers.RejectConnectionRequest)
-	connection.Get("/requests", controllers.GetConnectionRequests)
-	connection.Get("/", controllers.GetUserConnections)
-	connection.Delete("/:userId", controllers.RemoveConnection)
-	connection.Get("/status/:userId", controllers.GetConnectionStatus)
+	connection.Post("/request/:userId", cluster.RouteLeaderOnly, controllers.SendConnectionRequest)
+	connection.Put("/accept/:requestId", cluster.RouteLeaderOnly, controllers.AcceptConnectionRequest)
+	connection.Put("/reject/:requestId", cluster.RouteLeaderOnly, controllers.RejectConnectionRequest)
+	connection.Get("/requests", cluster.RouteReadOnly, controllers.GetConnectionRequests)
+	connection.Get("/", cluster.RouteReadOnly, controllers.GetUserConnections)
+	connection.Delete("/:userId", cluster.RouteLeaderOnly, controllers.RemoveConnection)
+	connection.Get("/status/:userId", cluster.RouteReadOnly, controllers.GetConnectionStatus)
 }
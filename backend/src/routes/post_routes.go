@@ -1,19 +1,19 @@
 package routes
 
 import (
-	"github.com/gofiber/fiber/v2"
+	"github.com/theleywin/Backend-Talent-Nest/src/cluster"
 	"github.com/theleywin/Backend-Talent-Nest/src/controllers"
 	"github.com/theleywin/Backend-Talent-Nest/src/middleware"
 )
 
 // PostRoutes sets up post-related routes for feed, creation, deletion, details, comments, and likes
-func PostRoutes(app *fiber.App) {
-	post := app.Group("/api/v1/posts", middleware.ProtectRoute)
+func PostRoutes(router *cluster.Router) {
+	post := router.Group("/api/v1/posts", middleware.ProtectRoute)
 
-	post.Get("/", controllers.GetFeedPosts)
-	post.Post("/create", controllers.CreatePost)
-	post.Delete("/delete/:id", controllers.DeletePost)
-	post.Get("/:id", controllers.GetPostByID)
-	post.Post("/:id/comment", controllers.CreateComment)
-	post.Post("/:id/like", controllers.LikePost)
+	post.Get("/", cluster.RouteReadOnly, controllers.GetFeedPosts)
+	post.Post("/create", cluster.RouteLeaderOnly, controllers.CreatePost)
+	post.Delete("/delete/:id", cluster.RouteLeaderOnly, controllers.DeletePost)
+	post.Get("/:id", cluster.RouteReadOnly, controllers.GetPostByID)
+	post.Post("/:id/comment", cluster.RouteLeaderOnly, controllers.CreateComment)
+	post.Post("/:id/like", cluster.RouteLeaderOnly, controllers.LikePost)
 }
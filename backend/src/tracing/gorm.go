@@ -0,0 +1,120 @@
+package tracing
+
+import (
+	"errors"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.43.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+// gormSpanKey is the statement setting that holds the span of the running operation
+const gormSpanKey = "tracing:span"
+
+// GormPlugin creates a span for each GORM create, query, update, delete, row and raw
+// operation, as a child of the span in the statement context (use db.WithContext).
+// The span covers the whole callback chain, including the transaction and the hooks
+// registered by other plugins. Operations outside a trace, like the periodic queries
+// of the cluster, are not traced.
+type GormPlugin struct{}
+
+// Name implements gorm.Plugin
+func (GormPlugin) Name() string {
+	return "tracing"
+}
+
+// Initialize implements gorm.Plugin
+func (GormPlugin) Initialize(db *gorm.DB) error {
+	callbacks := db.Callback()
+	processors := []struct {
+		operation string
+		before    func(name string, fn func(*gorm.DB)) error
+		after     func(name string, fn func(*gorm.DB)) error
+	}{
+		{"create", callbacks.Create().Before("*").Register, callbacks.Create().After("*").Register},
+		{"select", callbacks.Query().Before("*").Register, callbacks.Query().After("*").Register},
+		{"update", callbacks.Update().Before("*").Register, callbacks.Update().After("*").Register},
+		{"delete", callbacks.Delete().Before("*").Register, callbacks.Delete().After("*").Register},
+		{"row", callbacks.Row().Before("*").Register, callbacks.Row().After("*").Register},
+		{"raw", callbacks.Raw().Before("*").Register, callbacks.Raw().After("*").Register},
+	}
+
+	for _, processor := range processors {
+		if err := processor.before("tracing:before_"+processor.operation, startGormSpan(processor.operation)); err != nil {
+			return err
+		}
+		if err := processor.after("tracing:after_"+processor.operation, endGormSpan); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// startGormSpan starts the span of an operation and makes it the parent of the queries
+// run by the rest of the chain
+func startGormSpan(operation string) func(*gorm.DB) {
+	tracer := Tracer()
+	return func(db *gorm.DB) {
+		if db.Statement.Context == nil || !trace.SpanContextFromContext(db.Statement.Context).IsValid() {
+			return
+		}
+
+		attributes := []attribute.KeyValue{dbSystem(db), semconv.DBOperationName(operation)}
+		if db.Statement.Table != "" {
+			attributes = append(attributes, semconv.DBCollectionName(db.Statement.Table))
+		}
+
+		ctx, span := tracer.Start(db.Statement.Context, "gorm."+operation,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(attributes...),
+		)
+		db.Statement.Context = ctx
+		db.InstanceSet(gormSpanKey, span)
+	}
+}
+
+// dbSystem returns the db.system.name attribute of the database behind the dialector
+func dbSystem(db *gorm.DB) attribute.KeyValue {
+	switch db.Dialector.Name() {
+	case "postgres":
+		return semconv.DBSystemNamePostgreSQL
+	case "mysql":
+		return semconv.DBSystemNameMySQL
+	default:
+		return semconv.DBSystemNameSQLite
+	}
+}
+
+// endGormSpan records the SQL, the affected rows and the error of the operation and
+// ends its span
+func endGormSpan(db *gorm.DB) {
+	value, ok := db.InstanceGet(gormSpanKey)
+	if !ok {
+		return
+	}
+	span, ok := value.(trace.Span)
+	if !ok {
+		return
+	}
+	defer span.End()
+
+	if !span.IsRecording() {
+		return
+	}
+
+	// La tabla suele conocerse recién después de procesar el modelo
+	if db.Statement.Table != "" {
+		span.SetAttributes(semconv.DBCollectionName(db.Statement.Table))
+	}
+	if sql := db.Statement.SQL.String(); sql != "" {
+		span.SetAttributes(semconv.DBQueryText(sql))
+	}
+	span.SetAttributes(attribute.Int64("db.rows_affected", db.Statement.RowsAffected))
+
+	if err := db.Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
@@ -0,0 +1,160 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.43.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName identifies the spans created by this application
+const instrumentationName = "github.com/theleywin/Backend-Talent-Nest"
+
+// defaultServiceName is the service name when OTEL_SERVICE_NAME is not set
+const defaultServiceName = "talentnest"
+
+// traceParentHeader is the W3C header that carries the trace context
+const traceParentHeader = "traceparent"
+
+// propagator reads and writes the W3C trace context and baggage headers
+var propagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+// Setup configures the global tracer provider from OTEL_TRACES_EXPORTER:
+//   - none (default): spans are not recorded, but the trace context is still propagated
+//   - otlp: OTLP over HTTP, configured with the standard OTEL_EXPORTER_OTLP_* variables
+//   - stdout: one JSON document per span on stdout
+//   - file: like stdout, appended to OTEL_TRACES_FILE (traces.json by default)
+//
+// Sampling follows OTEL_TRACES_SAMPLER and OTEL_TRACES_SAMPLER_ARG. The returned function
+// flushes the pending spans and closes the exporter.
+func Setup(ctx context.Context, instanceID string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagator)
+
+	exporter, closeOutput, err := newExporter(ctx, strings.ToLower(strings.TrimSpace(os.Getenv("OTEL_TRACES_EXPORTER"))))
+	if err != nil || exporter == nil {
+		return func(context.Context) error { return nil }, err
+	}
+
+	// Los atributos del entorno (OTEL_SERVICE_NAME, OTEL_RESOURCE_ATTRIBUTES) tienen prioridad
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName(defaultServiceName), semconv.ServiceInstanceID(instanceID)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		closeOutput()
+		return nil, fmt.Errorf("error creating trace resource: %v", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		defer closeOutput()
+		return provider.Shutdown(ctx)
+	}, nil
+}
+
+// newExporter creates the span exporter for the given OTEL_TRACES_EXPORTER value (nil
+// for none) and a function that closes its output file, if any
+func newExporter(ctx context.Context, name string) (sdktrace.SpanExporter, func(), error) {
+	noop := func() {}
+
+	switch name {
+	case "", "none":
+		return nil, noop, nil
+	case "otlp":
+		exporter, err := otlptracehttp.New(ctx)
+		if err != nil {
+			return nil, noop, fmt.Errorf("error creating OTLP exporter: %v", err)
+		}
+		return exporter, noop, nil
+	case "stdout", "console":
+		exporter, err := stdouttrace.New()
+		if err != nil {
+			return nil, noop, fmt.Errorf("error creating stdout exporter: %v", err)
+		}
+		return exporter, noop, nil
+	case "file":
+		path := os.Getenv("OTEL_TRACES_FILE")
+		if path == "" {
+			path = "traces.json"
+		}
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, noop, fmt.Errorf("error opening trace file: %v", err)
+		}
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(file))
+		if err != nil {
+			file.Close()
+			return nil, noop, fmt.Errorf("error creating file exporter: %v", err)
+		}
+		return exporter, func() { file.Close() }, nil
+	default:
+		return nil, noop, fmt.Errorf("unknown OTEL_TRACES_EXPORTER %q (use none, otlp, stdout or file)", name)
+	}
+}
+
+// Tracer returns the tracer of the application
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Extract returns a copy of ctx with the trace context found in the carrier
+func Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	return propagator.Extract(ctx, carrier)
+}
+
+// TraceParent returns the W3C traceparent of the span in ctx ("" if there is none), so
+// work done later, like replicating a write, can join the same trace
+func TraceParent(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+	return carrier.Get(traceParentHeader)
+}
+
+// WithTraceParent returns a copy of ctx whose parent span is the one described by the
+// W3C traceparent (ctx itself if it is empty or not valid)
+func WithTraceParent(ctx context.Context, traceParent string) context.Context {
+	if traceParent == "" {
+		return ctx
+	}
+	return propagation.TraceContext{}.Extract(ctx, propagation.MapCarrier{traceParentHeader: traceParent})
+}
+
+// Transport wraps an HTTP transport so the requests carry the trace context of their
+// context. It does not create spans: callers start one for the calls worth tracing.
+func Transport(base http.RoundTripper) http.RoundTripper {
+	return transport{base: base}
+}
+
+type transport struct {
+	base http.RoundTripper
+}
+
+func (t transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !trace.SpanContextFromContext(req.Context()).IsValid() {
+		return t.base.RoundTrip(req)
+	}
+
+	// Un RoundTripper no debe modificar la petición original
+	req = req.Clone(req.Context())
+	propagator.Inject(req.Context(), propagation.HeaderCarrier(req.Header))
+	return t.base.RoundTrip(req)
+}